@@ -1,13 +1,21 @@
 package adminapi
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"testing"
 	"time"
 
@@ -15,6 +23,7 @@ import (
 	bolt "go.etcd.io/bbolt"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/rotation"
 )
 
 func setupTestDB(t *testing.T) *persistence.Storage {
@@ -29,6 +38,7 @@ func setupTestDB(t *testing.T) *persistence.Storage {
 	t.Cleanup(func() {
 		storage.Close()
 		os.RemoveAll("images")
+		os.RemoveAll("trash")
 	})
 
 	// Prepopulate status
@@ -58,13 +68,61 @@ func setupTestDB(t *testing.T) *persistence.Storage {
 	return storage
 }
 
+// fakePlayback records the playback calls of the admin API.
+type fakePlayback struct {
+	changes int
+	calls   []string
+	hold    time.Duration
+	jumped  int
+	err     error
+}
+
+func (p *fakePlayback) NotifyChange() {
+	p.changes++
+}
+
+func (p *fakePlayback) Next(hold time.Duration) (model.Image, error) {
+	p.calls = append(p.calls, "next")
+	p.hold = hold
+	return model.Image{}, p.err
+}
+
+func (p *fakePlayback) Previous(hold time.Duration) (model.Image, error) {
+	p.calls = append(p.calls, "previous")
+	p.hold = hold
+	return model.Image{}, p.err
+}
+
+func (p *fakePlayback) Jump(id int, hold time.Duration) (model.Image, error) {
+	p.calls = append(p.calls, "jump")
+	p.jumped = id
+	p.hold = hold
+	return model.Image{Id: id}, p.err
+}
+
+func (p *fakePlayback) Pause() error {
+	p.calls = append(p.calls, "pause")
+	return p.err
+}
+
+func (p *fakePlayback) Resume() error {
+	p.calls = append(p.calls, "resume")
+	return p.err
+}
+
 func setupRouter(storage *persistence.Storage) *gin.Engine {
+	r, _ := setupRouterWithPlayback(storage)
+	return r
+}
+
+func setupRouterWithPlayback(storage *persistence.Storage) (*gin.Engine, *fakePlayback) {
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
 	g := r.Group("/admin/api")
-	handler := NewHandler(storage)
+	playback := &fakePlayback{}
+	handler := NewHandler(storage, playback)
 	handler.RegisterApiEndpoint(g)
-	return r
+	return r, playback
 }
 
 func TestUploadImage(t *testing.T) {
@@ -75,7 +133,7 @@ func TestUploadImage(t *testing.T) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	part, _ := writer.CreateFormFile("image", "test_upload.jpg")
-	part.Write([]byte("fake image content"))
+	jpeg.Encode(part, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil)
 	writer.Close()
 
 	req, _ := http.NewRequest("POST", "/admin/api/image", body)
@@ -101,6 +159,437 @@ func TestUploadImage(t *testing.T) {
 	}
 }
 
+func TestAddUrl(t *testing.T) {
+	storage := setupTestDB(t)
+	r, notifier := setupRouterWithPlayback(storage)
+
+	req, _ := http.NewRequest("POST", "/admin/api/url", bytes.NewBufferString(`{"url": "https://example.com/photo.jpg"}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var ref ImageRef
+	json.Unmarshal(w.Body.Bytes(), &ref)
+	if ref.Path != "https://example.com/photo.jpg" || ref.Type != model.Url {
+		t.Errorf("Expected remote image, got %+v", ref)
+	}
+	if notifier.changes != 1 {
+		t.Errorf("Expected 1 change notification, got %d", notifier.changes)
+	}
+
+	req, _ = http.NewRequest("POST", "/admin/api/url", bytes.NewBufferString(`{"url": "https://example.com/", "type": "PAGE"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &ref)
+	if w.Code != http.StatusOK || ref.Type != model.WebPage {
+		t.Errorf("Expected web page, got %d %+v", w.Code, ref)
+	}
+
+	// Removing a remote item does not require a file on disk
+	req, _ = http.NewRequest("DELETE", "/admin/api/image/"+strconv.Itoa(ref.Id), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 deleting url, got %d", w.Code)
+	}
+}
+
+func TestAddUrlValidation(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+
+	for _, body := range []string{
+		`{}`,
+		`{"url": "example.com/photo.jpg"}`,
+		`{"url": "ftp://example.com/photo.jpg"}`,
+		`{"url": "https://"}`,
+		`{"url": "https://example.com/", "type": "IMAGE"}`,
+		`{"url": "https://example.com/", "type": "VIDEO"}`,
+	} {
+		req, _ := http.NewRequest("POST", "/admin/api/url", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, w.Code)
+		}
+	}
+	if images, _ := storage.LoadImages(); len(images) != 0 {
+		t.Errorf("Expected no images stored, got %d", len(images))
+	}
+}
+
+func uploadImage(r *gin.Engine, name string, content []byte) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("image", name)
+	part.Write(content)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/admin/api/image", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestUploadImageFormats(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+	var pngContent, jpegContent bytes.Buffer
+	png.Encode(&pngContent, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	jpeg.Encode(&jpegContent, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil)
+
+	// The format is detected by content, not by the file name
+	w := uploadImage(r, "graphic.jpg", pngContent.Bytes())
+	var ref ImageRef
+	json.Unmarshal(w.Body.Bytes(), &ref)
+	if w.Code != http.StatusOK || ref.MimeType != "image/png" {
+		t.Errorf("Expected PNG upload, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := uploadImage(r, "notes.jpg", []byte("not an image")); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for text, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join("images", "notes.jpg")); !os.IsNotExist(err) {
+		t.Error("Rejected file must not be stored")
+	}
+
+	// Only configured formats are accepted
+	storage.UpdateConfiguration(model.Config{ImageDuration: 60, AllowedFormats: []string{"image/png"}})
+	if w := uploadImage(r, "photo.jpg", jpegContent.Bytes()); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for JPEG, got %d", w.Code)
+	}
+	pngContent.Reset()
+	png.Encode(&pngContent, image.NewRGBA(image.Rect(0, 0, 8, 8)))
+	if w := uploadImage(r, "other.png", pngContent.Bytes()); w.Code != http.StatusOK {
+		t.Errorf("Expected PNG to be accepted, got %d", w.Code)
+	}
+}
+
+// jpegBytes encodes a square JPEG, different sizes give different content.
+func jpegBytes(size int) []byte {
+	var content bytes.Buffer
+	jpeg.Encode(&content, image.NewRGBA(image.Rect(0, 0, size, size)), nil)
+	return content.Bytes()
+}
+
+func TestUploadImageHardened(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+
+	// The client supplied name cannot escape the image directory or overwrite other images
+	var paths []string
+	for _, size := range []int{4, 8} {
+		w := uploadImage(r, "../../photo.jpg", jpegBytes(size))
+		var ref ImageRef
+		json.Unmarshal(w.Body.Bytes(), &ref)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		paths = append(paths, ref.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"photo.jpg", "photo-1.jpg"}) {
+		t.Errorf("Expected unique sanitized names, got %v", paths)
+	}
+	if _, err := os.Stat(filepath.Join("..", "photo.jpg")); !os.IsNotExist(err) {
+		t.Error("File must not be written outside the image directory")
+	}
+	if w := uploadImage(r, "photo.jpg", jpegBytes(4)); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for duplicate, got %d", w.Code)
+	}
+
+	content := jpegBytes(16)
+	defer func(size int64) { persistence.MaxImageSize = size }(persistence.MaxImageSize)
+	persistence.MaxImageSize = int64(len(content) - 1)
+	if w := uploadImage(r, "large.jpg", content); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join("images", "large.jpg")); !os.IsNotExist(err) {
+		t.Error("Rejected file must not be stored")
+	}
+}
+
+// uploadFiles posts all files as parts of the given field in the given order.
+func uploadFiles(r *gin.Engine, target string, field string, names []string, contents [][]byte) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for i, name := range names {
+		part, _ := writer.CreateFormFile(field, name)
+		part.Write(contents[i])
+	}
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", target, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func assertReport(t *testing.T, w *httptest.ResponseRecorder, expected map[string]UploadStatus) UploadReport {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var report UploadReport
+	json.Unmarshal(w.Body.Bytes(), &report)
+	statuses := map[string]UploadStatus{}
+	for _, result := range report.Files {
+		statuses[result.Name] = result.Status
+		if (result.Status == Rejected) != (result.Image == nil) {
+			t.Errorf("%s: expected image for all but rejected files, got %+v", result.Name, result)
+		}
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected %v, got %v", expected, statuses)
+	}
+	return report
+}
+
+func TestUploadMultipleImages(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+	storage.ImportImage("existing.jpg", bytes.NewReader(jpegBytes(4)))
+
+	w := uploadFiles(r, "/admin/api/image", "image",
+		[]string{"b.jpg", "existing.jpg", "notes.txt", "a.jpg"},
+		[][]byte{jpegBytes(8), jpegBytes(4), []byte("not an image"), jpegBytes(16)})
+	assertReport(t, w, map[string]UploadStatus{
+		"b.jpg":        Created,
+		"existing.jpg": Duplicate,
+		"notes.txt":    Rejected,
+		"a.jpg":        Created,
+	})
+
+	// New images are appended in upload order
+	images, _ := storage.LoadImages()
+	var paths []string
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"existing.jpg", "b.jpg", "a.jpg"}) {
+		t.Errorf("Expected images in upload order, got %v", paths)
+	}
+}
+
+func zipArchive(t *testing.T, names []string, contents [][]byte) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for i, name := range names {
+		entry, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write(contents[i])
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestUploadArchive(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+	archive := zipArchive(t,
+		[]string{"holiday/", "holiday/day2.jpg", "holiday/day1.jpg", "holiday/notes.txt", "__MACOSX/holiday/._day1.jpg", "holiday/.DS_Store", "../day3.jpg", "again/day2.jpg"},
+		[][]byte{nil, jpegBytes(8), jpegBytes(4), []byte("not an image"), []byte("fork"), []byte("store"), jpegBytes(16), jpegBytes(8)})
+
+	w := uploadFiles(r, "/admin/api/image/archive", "archive", []string{"holiday.zip"}, [][]byte{archive})
+	report := assertReport(t, w, map[string]UploadStatus{
+		"holiday/day2.jpg":  Created,
+		"holiday/day1.jpg":  Created,
+		"holiday/notes.txt": Rejected,
+		"../day3.jpg":       Created,
+		"again/day2.jpg":    Duplicate,
+	})
+	if report.Files[4].Image.Path != "day2.jpg" {
+		t.Errorf("Expected duplicate to reference day2.jpg, got %+v", report.Files[4].Image)
+	}
+
+	// The order is extended in archive order
+	images, _ := storage.LoadImages()
+	var paths []string
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"day2.jpg", "day1.jpg", "day3.jpg"}) {
+		t.Errorf("Expected images in archive order, got %v", paths)
+	}
+
+	if w := uploadFiles(r, "/admin/api/image/archive", "archive", []string{"broken.zip"}, [][]byte{[]byte("no archive")}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid archive, got %d", w.Code)
+	}
+}
+
+func TestLoadDuplicates(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+	for _, name := range []string{"first.jpg", "copy.jpg"} {
+		os.WriteFile(filepath.Join("images", name), jpegBytes(4), 0644)
+	}
+	os.WriteFile(filepath.Join("images", "other.jpg"), jpegBytes(8), 0644)
+	first, _ := storage.SaveImageMetadata("first.jpg")
+	storage.SaveImageMetadata("other.jpg")
+	// Libraries from earlier versions may contain duplicates
+	storage.Db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("hashes")).Delete([]byte(first.Hash))
+	})
+	storage.SaveImageMetadata("copy.jpg")
+
+	req, _ := http.NewRequest("GET", "/admin/api/image/duplicates", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var duplicates []DuplicateRef
+	json.Unmarshal(w.Body.Bytes(), &duplicates)
+	if w.Code != http.StatusOK || len(duplicates) != 1 {
+		t.Fatalf("Expected one group of duplicates, got %d: %s", w.Code, w.Body.String())
+	}
+	if duplicates[0].Hash != first.Hash || len(duplicates[0].Images) != 2 || duplicates[0].Images[1].Path != "copy.jpg" {
+		t.Errorf("Expected first.jpg and copy.jpg, got %+v", duplicates[0])
+	}
+
+	// Uploading the content again is rejected as duplicate
+	if w := uploadImage(r, "third.jpg", jpegBytes(8)); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409, got %d", w.Code)
+	}
+}
+
+// gradientJpegBytes returns an image getting darker from left to right, which differs from uniform images in all perceptual hash bits.
+func gradientJpegBytes(size int) []byte {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			img.Pix[y*img.Stride+x] = uint8(255 - x*255/size)
+		}
+	}
+	var content bytes.Buffer
+	jpeg.Encode(&content, img, nil)
+	return content.Bytes()
+}
+
+func TestLoadSimilar(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+	os.WriteFile(filepath.Join("images", "small.jpg"), jpegBytes(16), 0644)
+	os.WriteFile(filepath.Join("images", "gradient.jpg"), gradientJpegBytes(16), 0644)
+	os.WriteFile(filepath.Join("images", "large.jpg"), jpegBytes(32), 0644)
+	for _, name := range []string{"small.jpg", "gradient.jpg", "large.jpg"} {
+		if _, err := storage.SaveImageMetadata(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, query := range []string{"", "?distance=0"} {
+		req, _ := http.NewRequest("GET", "/admin/api/image/similar"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var groups [][]ImageRef
+		json.Unmarshal(w.Body.Bytes(), &groups)
+		if w.Code != http.StatusOK || len(groups) != 1 || len(groups[0]) != 2 {
+			t.Fatalf("%s: expected one group of two images, got %d: %s", query, w.Code, w.Body.String())
+		}
+		if groups[0][0].Path != "small.jpg" || groups[0][1].Path != "large.jpg" || groups[0][0].PerceptualHash == "" {
+			t.Errorf("%s: expected small.jpg and large.jpg, got %+v", query, groups[0])
+		}
+	}
+
+	for _, query := range []string{"?distance=abc", "?distance=-1", "?distance=65"} {
+		req, _ := http.NewRequest("GET", "/admin/api/image/similar"+query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestConfigurationSimilarity(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+
+	req, _ := http.NewRequest("GET", "/admin/api/configuration", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var config ConfigRef
+	json.Unmarshal(w.Body.Bytes(), &config)
+	if config.SimilarityThreshold != model.DefaultSimilarityThreshold || config.CollapseSimilar {
+		t.Errorf("Expected default threshold without collapsing, got %+v", config)
+	}
+
+	body := `{"imageDuration": 10, "similarityThreshold": 4, "collapseSimilar": true}`
+	req, _ = http.NewRequest("PUT", "/admin/api/configuration", bytes.NewBufferString(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	stored, _ := storage.GetConfiguration()
+	if w.Code != http.StatusOK || stored.SimilarityThreshold != 4 || !stored.CollapseSimilar {
+		t.Errorf("Expected stored threshold 4 with collapsing, got %d: %+v", w.Code, stored)
+	}
+
+	body = `{"imageDuration": 10, "similarityThreshold": 65}`
+	req, _ = http.NewRequest("PUT", "/admin/api/configuration", bytes.NewBufferString(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for threshold above 64, got %d", w.Code)
+	}
+}
+
+func TestConfigurationAllowedFormats(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+
+	req, _ := http.NewRequest("GET", "/admin/api/configuration", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var config ConfigRef
+	json.Unmarshal(w.Body.Bytes(), &config)
+	if !reflect.DeepEqual(config.AllowedFormats, model.SupportedFormats) {
+		t.Errorf("Expected all supported formats by default, got %v", config.AllowedFormats)
+	}
+
+	req, _ = http.NewRequest("PUT", "/admin/api/configuration", bytes.NewBufferString(`{"imageDuration": 60, "allowedFormats": ["image/jpeg", "image/png"]}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &config)
+	if w.Code != http.StatusOK || !reflect.DeepEqual(config.AllowedFormats, []string{"image/jpeg", "image/png"}) {
+		t.Errorf("Expected updated formats, got %d %v", w.Code, config.AllowedFormats)
+	}
+
+	req, _ = http.NewRequest("PUT", "/admin/api/configuration", bytes.NewBufferString(`{"imageDuration": 60, "allowedFormats": ["image/tiff"]}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unsupported format, got %d", w.Code)
+	}
+}
+
+func TestUploadImageExtractsMetadata(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("image", "photo.jpg")
+	jpeg.Encode(part, image.NewRGBA(image.Rect(0, 0, 20, 10)), nil)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/admin/api/image", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/admin/api/image", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var images []ImageRef
+	json.Unmarshal(w.Body.Bytes(), &images)
+	if len(images) != 1 || images[0].Metadata.Width != 20 || images[0].Metadata.Height != 10 {
+		t.Errorf("Expected uploaded image with 20x10 metadata, got %s", w.Body.String())
+	}
+}
+
 func TestGetImages(t *testing.T) {
 	storage := setupTestDB(t)
 	storage.SaveImageMetadata("img1.jpg")
@@ -128,7 +617,7 @@ func TestDeleteImage(t *testing.T) {
 	// Create file
 	os.Create("images/del.jpg")
 
-	r := setupRouter(storage)
+	r, notifier := setupRouterWithPlayback(storage)
 
 	req, _ := http.NewRequest("DELETE", "/admin/api/image/1", nil)
 	w := httptest.NewRecorder()
@@ -145,6 +634,44 @@ func TestDeleteImage(t *testing.T) {
 	if _, err := os.Stat("images/del.jpg"); !os.IsNotExist(err) {
 		t.Error("File should be deleted")
 	}
+	if notifier.changes != 1 {
+		t.Errorf("Expected 1 change notification, got %d", notifier.changes)
+	}
+}
+
+func TestReorderImagesNotifiesChange(t *testing.T) {
+	storage := setupTestDB(t)
+	img1, _ := storage.SaveImageMetadata("img1.jpg")
+	img2, _ := storage.SaveImageMetadata("img2.jpg")
+	r, notifier := setupRouterWithPlayback(storage)
+
+	body, _ := json.Marshal([]ImageRef{{Id: img2.Id, Path: img2.Path, Type: img2.Type}, {Id: img1.Id, Path: img1.Path, Type: img1.Type}})
+	req, _ := http.NewRequest("PUT", "/admin/api/image", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	if notifier.changes != 1 {
+		t.Errorf("Expected 1 change notification, got %d", notifier.changes)
+	}
+	images, _ := storage.LoadImages()
+	if images[0].Id != img2.Id {
+		t.Errorf("Expected img2 first after reorder, got img%d", images[0].Id)
+	}
+
+	// Images left out are kept behind the listed ones
+	img3, _ := storage.SaveImageMetadata("img3.jpg")
+	body, _ = json.Marshal([]ImageRef{{Id: img3.Id, Path: img3.Path, Type: img3.Type}})
+	req, _ = http.NewRequest("PUT", "/admin/api/image", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var refs []ImageRef
+	json.Unmarshal(w.Body.Bytes(), &refs)
+	if w.Code != http.StatusOK || len(refs) != 3 || refs[0].Id != img3.Id || refs[1].Id != img2.Id || refs[2].Id != img1.Id {
+		t.Errorf("Expected order img3, img2, img1, got %d: %s", w.Code, w.Body.String())
+	}
 }
 
 func TestConfiguration(t *testing.T) {
@@ -174,3 +701,587 @@ func TestConfiguration(t *testing.T) {
 		t.Errorf("Config not updated")
 	}
 }
+
+func TestConfigurationRotation(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+
+	body, _ := json.Marshal(ConfigRef{ImageDuration: 30, Rotation: model.LeastRecentlyShown})
+	req, _ := http.NewRequest("PUT", "/admin/api/configuration", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("PUT config failed: %d", w.Code)
+	}
+	config, _ := storage.GetConfiguration()
+	if config.Rotation != model.LeastRecentlyShown {
+		t.Errorf("Expected rotation LEAST_RECENTLY_SHOWN, got %s", config.Rotation)
+	}
+
+	// Legacy clients only sending randomOrder get the shuffled strategy
+	body, _ = json.Marshal(map[string]interface{}{"imageDuration": 30, "randomOrder": true})
+	req, _ = http.NewRequest("PUT", "/admin/api/configuration", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var ref ConfigRef
+	json.Unmarshal(w.Body.Bytes(), &ref)
+	if ref.Rotation != model.Shuffled {
+		t.Errorf("Expected rotation SHUFFLED, got %s", ref.Rotation)
+	}
+
+	body, _ = json.Marshal(ConfigRef{ImageDuration: 30, Rotation: "BOGUS"})
+	req, _ = http.NewRequest("PUT", "/admin/api/configuration", bytes.NewBuffer(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown rotation, got %d", w.Code)
+	}
+}
+
+func TestUpdateImageSettings(t *testing.T) {
+	storage := setupTestDB(t)
+	img, _ := storage.SaveImageMetadata("img1.jpg")
+	r := setupRouter(storage)
+
+	req, _ := http.NewRequest("PATCH", "/admin/api/image/"+strconv.Itoa(img.Id), bytes.NewBufferString(`{"weight": 3}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	loaded, _ := storage.LoadImage(img.Id)
+	if loaded.Weight != 3 {
+		t.Errorf("Expected weight 3, got %d", loaded.Weight)
+	}
+
+	req, _ = http.NewRequest("PATCH", "/admin/api/image/"+strconv.Itoa(img.Id), bytes.NewBufferString(`{"weight": -1}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for negative weight, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest("PATCH", "/admin/api/image/99", bytes.NewBufferString(`{"weight": 1}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown image, got %d", w.Code)
+	}
+}
+
+func TestPlaybackControl(t *testing.T) {
+	storage := setupTestDB(t)
+	img, _ := storage.SaveImageMetadata("img1.jpg")
+	r, playback := setupRouterWithPlayback(storage)
+
+	for _, action := range []string{"next", "previous", "pause", "resume"} {
+		req, _ := http.NewRequest("POST", "/admin/api/playback/"+action, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("POST %s: expected 200, got %d", action, w.Code)
+		}
+	}
+	if len(playback.calls) != 4 {
+		t.Errorf("Expected 4 playback calls, got %v", playback.calls)
+	}
+
+	req, _ := http.NewRequest("POST", "/admin/api/playback/jump/"+strconv.Itoa(img.Id)+"?hold=300", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	if playback.jumped != img.Id || playback.hold != 300*time.Second {
+		t.Errorf("Expected jump to %d with hold 300s, got %d with %v", img.Id, playback.jumped, playback.hold)
+	}
+	var ref PlaybackRef
+	if err := json.Unmarshal(w.Body.Bytes(), &ref); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+}
+
+func TestPlaybackControlErrors(t *testing.T) {
+	storage := setupTestDB(t)
+	r, playback := setupRouterWithPlayback(storage)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/admin/api/playback/jump/99", http.StatusNotFound},
+		{"/admin/api/playback/jump/abc", http.StatusBadRequest},
+		{"/admin/api/playback/next?hold=-1", http.StatusBadRequest},
+		{"/admin/api/playback/next?hold=abc", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("POST", test.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.want {
+			t.Errorf("POST %s: expected %d, got %d", test.path, test.want, w.Code)
+		}
+	}
+
+	playback.err = rotation.ErrNoHistory
+	req, _ := http.NewRequest("POST", "/admin/api/playback/previous", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 without history, got %d", w.Code)
+	}
+}
+
+func TestLoadPlayback(t *testing.T) {
+	storage := setupTestDB(t)
+	storage.UpdateStatus(func(status *model.Status) error {
+		status.CurrentImageId = 2
+		status.Paused = true
+		status.History = []int{1}
+		status.OverrideUntil = time.Now().Add(time.Hour)
+		return nil
+	})
+	r := setupRouter(storage)
+
+	req, _ := http.NewRequest("GET", "/admin/api/playback", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	var ref PlaybackRef
+	json.Unmarshal(w.Body.Bytes(), &ref)
+	if ref.CurrentImageId != 2 || !ref.Paused || len(ref.History) != 1 || ref.OverrideUntil == nil {
+		t.Errorf("Unexpected playback state %+v", ref)
+	}
+}
+
+func TestImageDurationOverride(t *testing.T) {
+	storage := setupTestDB(t)
+	img1, _ := storage.SaveImageMetadata("img1.jpg")
+	storage.SaveImageMetadata("img2.jpg")
+	r := setupRouter(storage)
+
+	req, _ := http.NewRequest("PATCH", "/admin/api/image/"+strconv.Itoa(img1.Id), bytes.NewBufferString(`{"duration": 15}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	var ref ImageRef
+	json.Unmarshal(w.Body.Bytes(), &ref)
+	if ref.Duration != 15 || ref.EffectiveDuration != 15 {
+		t.Errorf("Expected duration 15, got %+v", ref)
+	}
+
+	req, _ = http.NewRequest("GET", "/admin/api/image", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var images []ImageRef
+	json.Unmarshal(w.Body.Bytes(), &images)
+	if len(images) != 2 || images[0].EffectiveDuration != 15 || images[1].EffectiveDuration != 60 {
+		t.Errorf("Expected effective durations 15 and 60, got %+v", images)
+	}
+
+	req, _ = http.NewRequest("PATCH", "/admin/api/image/"+strconv.Itoa(img1.Id), bytes.NewBufferString(`{"duration": -5}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for negative duration, got %d", w.Code)
+	}
+}
+
+func TestRescanLibrary(t *testing.T) {
+	storage := setupTestDB(t)
+	r, notifier := setupRouterWithPlayback(storage)
+	os.WriteFile(filepath.Join("images", "kept.jpg"), jpegBytes(2), 0644)
+	storage.SaveImageMetadata("kept.jpg")
+	os.WriteFile(filepath.Join("images", "removed.jpg"), jpegBytes(4), 0644)
+	storage.SaveImageMetadata("removed.jpg")
+	os.Remove(filepath.Join("images", "removed.jpg"))
+	os.WriteFile(filepath.Join("images", "added.jpg"), jpegBytes(8), 0644)
+
+	req, _ := http.NewRequest("POST", "/admin/api/library/rescan", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var report LibraryReportRef
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if w.Code != http.StatusOK || len(report.Imported) != 1 || report.Imported[0].Path != "added.jpg" {
+		t.Fatalf("Expected added.jpg to be imported, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(report.Removed) != 1 || report.Removed[0].Path != "removed.jpg" || report.OrderRepaired {
+		t.Errorf("Expected removed.jpg to be removed, got %+v", report)
+	}
+	if notifier.changes != 1 {
+		t.Errorf("Expected 1 change notification, got %d", notifier.changes)
+	}
+
+	// Nothing changed since the last scan
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != `{"imported":[],"removed":[],"skipped":[],"orderRepaired":false}` || notifier.changes != 1 {
+		t.Errorf("Expected empty report, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Without any file, the image directory is considered unavailable
+	os.Remove(filepath.Join("images", "kept.jpg"))
+	os.Remove(filepath.Join("images", "added.jpg"))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", w.Code)
+	}
+	if images, _ := storage.LoadLibrary(); len(images) != 2 {
+		t.Errorf("Expected the library to stay, got %+v", images)
+	}
+}
+
+func TestTrashApi(t *testing.T) {
+	storage := setupTestDB(t)
+	r, notifier := setupRouterWithPlayback(storage)
+	os.WriteFile(filepath.Join("images", "photo.jpg"), jpegBytes(4), 0644)
+	img, _ := storage.SaveImageMetadata("photo.jpg")
+
+	req, _ := http.NewRequest("DELETE", "/admin/api/image/"+strconv.Itoa(img.Id), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/admin/api/trash", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var trash []TrashRef
+	json.Unmarshal(w.Body.Bytes(), &trash)
+	if w.Code != http.StatusOK || len(trash) != 1 || trash[0].Image.Path != "photo.jpg" {
+		t.Fatalf("Expected photo.jpg in the trash, got %d: %s", w.Code, w.Body.String())
+	}
+	if retention := trash[0].PurgeAt.Sub(trash[0].TrashedAt); retention != model.DefaultTrashRetention*24*time.Hour {
+		t.Errorf("Expected the default retention, got %v", retention)
+	}
+
+	req, _ = http.NewRequest("POST", "/admin/api/trash/"+strconv.Itoa(img.Id)+"/restore", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var restored ImageRef
+	json.Unmarshal(w.Body.Bytes(), &restored)
+	if w.Code != http.StatusOK || restored.Id != img.Id || restored.Path != "photo.jpg" {
+		t.Errorf("Expected restored photo.jpg, got %d: %s", w.Code, w.Body.String())
+	}
+	if notifier.changes != 2 {
+		t.Errorf("Expected 2 change notifications, got %d", notifier.changes)
+	}
+
+	tests := []struct {
+		method   string
+		target   string
+		expected int
+	}{
+		{"POST", "/admin/api/trash/" + strconv.Itoa(img.Id) + "/restore", http.StatusNotFound},
+		{"POST", "/admin/api/trash/abc/restore", http.StatusBadRequest},
+		{"DELETE", "/admin/api/trash/" + strconv.Itoa(img.Id), http.StatusNotFound},
+		{"DELETE", "/admin/api/image/" + strconv.Itoa(img.Id), http.StatusOK},
+		{"DELETE", "/admin/api/image/" + strconv.Itoa(img.Id), http.StatusNotFound},
+		{"DELETE", "/admin/api/trash/" + strconv.Itoa(img.Id), http.StatusNoContent},
+		{"DELETE", "/admin/api/trash", http.StatusNoContent},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.target, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != test.expected {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.target, test.expected, w.Code)
+		}
+	}
+	if images, _ := storage.LoadTrash(); len(images) != 0 {
+		t.Errorf("Expected an empty trash, got %+v", images)
+	}
+}
+
+func TestAlbumApi(t *testing.T) {
+	storage := setupTestDB(t)
+	r, notifier := setupRouterWithPlayback(storage)
+	first, _ := storage.SaveUrlMetadata("https://example.com/1.jpg", model.Url)
+	second, _ := storage.SaveUrlMetadata("https://example.com/2.jpg", model.Url)
+
+	send := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, target, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := send("POST", "/admin/api/album", `{"name": " Vacation 2025 "}`)
+	var album AlbumRef
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if w.Code != http.StatusOK || album.Name != "Vacation 2025" || album.ImageIds == nil {
+		t.Fatalf("Expected the created album, got %d: %s", w.Code, w.Body.String())
+	}
+	albumPath := "/admin/api/album/" + strconv.Itoa(album.Id)
+
+	w = send("PUT", albumPath+"/images", "["+strconv.Itoa(second.Id)+","+strconv.Itoa(first.Id)+"]")
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if w.Code != http.StatusOK || !reflect.DeepEqual(album.ImageIds, []int{second.Id, first.Id}) {
+		t.Errorf("Expected images %d and %d, got %d: %s", second.Id, first.Id, w.Code, w.Body.String())
+	}
+	w = send("DELETE", albumPath+"/images/"+strconv.Itoa(second.Id), "")
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if w.Code != http.StatusOK || !reflect.DeepEqual(album.ImageIds, []int{first.Id}) {
+		t.Errorf("Expected image %d, got %d: %s", first.Id, w.Code, w.Body.String())
+	}
+	if notifier.changes != 2 {
+		t.Errorf("Expected 2 change notifications, got %d", notifier.changes)
+	}
+
+	// The album becomes active through the configuration
+	w = send("PUT", "/admin/api/configuration", `{"imageDuration": 10, "activeAlbum": `+strconv.Itoa(album.Id)+`}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	w = send("GET", albumPath, "")
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if w.Code != http.StatusOK || !album.Active {
+		t.Errorf("Expected the active album, got %d: %s", w.Code, w.Body.String())
+	}
+	// The image list shows the whole library
+	w = send("GET", "/admin/api/image", "")
+	var images []ImageRef
+	json.Unmarshal(w.Body.Bytes(), &images)
+	if len(images) != 2 {
+		t.Errorf("Expected 2 images in the library, got %d", len(images))
+	}
+	// Without album parameter, the active album is reordered, which cannot gain images of the library
+	body, _ := json.Marshal([]ImageRef{images[1], images[0]})
+	if w = send("PUT", "/admin/api/image", string(body)); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for images outside the active album, got %d", w.Code)
+	}
+	body, _ = json.Marshal([]ImageRef{{Id: first.Id, Path: first.Path, Type: first.Type}})
+	w = send("PUT", "/admin/api/image", string(body))
+	json.Unmarshal(w.Body.Bytes(), &images)
+	if w.Code != http.StatusOK || len(images) != 1 || images[0].Id != first.Id {
+		t.Errorf("Expected the images of the active album, got %d: %s", w.Code, w.Body.String())
+	}
+	if album, _ := storage.LoadAlbum(album.Id); !reflect.DeepEqual(album.ImageIds, []int{first.Id}) {
+		t.Errorf("Expected the album to keep image %d, got %v", first.Id, album.ImageIds)
+	}
+	// With an album parameter, the image list shows the album
+	w = send("GET", "/admin/api/image?album="+strconv.Itoa(album.Id), "")
+	json.Unmarshal(w.Body.Bytes(), &images)
+	if w.Code != http.StatusOK || len(images) != 1 || images[0].Id != first.Id {
+		t.Errorf("Expected the album images, got %d: %s", w.Code, w.Body.String())
+	}
+	imageList := func(images ...model.Image) string {
+		var refs []ImageRef
+		for _, image := range images {
+			refs = append(refs, ImageRef{Id: image.Id, Path: image.Path, Type: image.Type})
+		}
+		body, _ := json.Marshal(refs)
+		return string(body)
+	}
+
+	tests := []struct {
+		method   string
+		target   string
+		body     string
+		expected int
+	}{
+		{"POST", "/admin/api/album", `{"name": "  "}`, http.StatusBadRequest},
+		{"PUT", albumPath, `{"name": "Vacation"}`, http.StatusOK},
+		{"PUT", albumPath + "/images", `[99]`, http.StatusBadRequest},
+		{"POST", albumPath + "/images/99", ``, http.StatusBadRequest},
+		{"POST", albumPath + "/images/abc", ``, http.StatusBadRequest},
+		{"GET", "/admin/api/album/99", ``, http.StatusNotFound},
+		{"GET", "/admin/api/image?album=99", ``, http.StatusNotFound},
+		{"GET", "/admin/api/image?album=abc", ``, http.StatusBadRequest},
+		{"PUT", "/admin/api/image?album=" + strconv.Itoa(album.Id), imageList(second, first), http.StatusBadRequest},
+		{"PUT", "/admin/api/image?album=" + strconv.Itoa(album.Id), imageList(first), http.StatusOK},
+		{"PUT", "/admin/api/image?album=99", imageList(first), http.StatusNotFound},
+		{"PUT", "/admin/api/image", imageList(model.Image{Id: 99, Path: "missing.jpg", Type: model.ImageType}), http.StatusBadRequest},
+		{"PUT", "/admin/api/configuration", `{"imageDuration": 10, "activeAlbum": 99}`, http.StatusBadRequest},
+		{"DELETE", albumPath, ``, http.StatusOK},
+		{"DELETE", albumPath, ``, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if w := send(test.method, test.target, test.body); w.Code != test.expected {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.target, test.expected, w.Code)
+		}
+	}
+	if config, _ := storage.GetConfiguration(); config.ActiveAlbum != 0 {
+		t.Errorf("Expected no active album after deletion, got %d", config.ActiveAlbum)
+	}
+	w = send("GET", "/admin/api/album", "")
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("Expected no albums, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTagApi(t *testing.T) {
+	storage := setupTestDB(t)
+	r, notifier := setupRouterWithPlayback(storage)
+	first, _ := storage.SaveUrlMetadata("https://example.com/1.jpg", model.Url)
+	second, _ := storage.SaveUrlMetadata("https://example.com/2.jpg", model.Url)
+	third, _ := storage.SaveUrlMetadata("https://example.com/3.jpg", model.Url)
+
+	send := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, target, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	firstPath := "/admin/api/image/" + strconv.Itoa(first.Id)
+	w := send("POST", firstPath+"/tags", `["Family", "screenshots"]`)
+	var image ImageRef
+	json.Unmarshal(w.Body.Bytes(), &image)
+	if w.Code != http.StatusOK || !reflect.DeepEqual(image.Tags, []string{"family", "screenshots"}) {
+		t.Errorf("Expected tags family and screenshots, got %d: %s", w.Code, w.Body.String())
+	}
+	w = send("DELETE", firstPath+"/tags/Screenshots", "")
+	json.Unmarshal(w.Body.Bytes(), &image)
+	if w.Code != http.StatusOK || !reflect.DeepEqual(image.Tags, []string{"family"}) {
+		t.Errorf("Expected tag family, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = send("POST", "/admin/api/image/99/tags", `["family"]`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing image, got %d", w.Code)
+	}
+	if w = send("POST", firstPath+"/tags", `["two words"]`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid tag, got %d", w.Code)
+	}
+
+	// Bulk changes apply to all images
+	body := fmt.Sprintf(`{"imageIds": [%d, %d], "add": ["family", "screenshots"], "remove": ["beach"]}`, second.Id, third.Id)
+	w = send("POST", "/admin/api/image/tags", body)
+	var images []ImageRef
+	json.Unmarshal(w.Body.Bytes(), &images)
+	if w.Code != http.StatusOK || len(images) != 2 || !reflect.DeepEqual(images[1].Tags, []string{"family", "screenshots"}) {
+		t.Errorf("Expected both images tagged, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = send("POST", "/admin/api/image/tags", `{"imageIds": [99], "add": ["family"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a missing image, got %d", w.Code)
+	}
+	if notifier.changes != 3 {
+		t.Errorf("Expected 3 change notifications, got %d", notifier.changes)
+	}
+
+	w = send("GET", "/admin/api/tag", "")
+	var tags []TagRef
+	json.Unmarshal(w.Body.Bytes(), &tags)
+	if !reflect.DeepEqual(tags, []TagRef{{Name: "family", Count: 3}, {Name: "screenshots", Count: 2}}) {
+		t.Errorf("Unexpected tags %s", w.Body.String())
+	}
+
+	// The image list can be filtered by tags and tag expressions
+	w = send("GET", "/admin/api/image?tag=family&tag=screenshots", "")
+	images = nil
+	json.Unmarshal(w.Body.Bytes(), &images)
+	if len(images) != 2 || images[0].Id != second.Id {
+		t.Errorf("Expected the screenshots, got %s", w.Body.String())
+	}
+	w = send("GET", "/admin/api/image?filter="+url.QueryEscape("family AND NOT screenshots"), "")
+	images = nil
+	json.Unmarshal(w.Body.Bytes(), &images)
+	if len(images) != 1 || images[0].Id != first.Id {
+		t.Errorf("Expected image %d, got %s", first.Id, w.Body.String())
+	}
+	if w = send("GET", "/admin/api/image?filter="+url.QueryEscape("family AND"), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid expression, got %d", w.Code)
+	}
+
+	// The rotation is restricted through the configuration
+	if w = send("PUT", "/admin/api/configuration", `{"imageDuration": 10, "tagFilter": "NOT"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid tag filter, got %d", w.Code)
+	}
+	w = send("PUT", "/admin/api/configuration", `{"imageDuration": 10, "tagFilter": "family AND NOT screenshots"}`)
+	var config ConfigRef
+	json.Unmarshal(w.Body.Bytes(), &config)
+	if w.Code != http.StatusOK || config.TagFilter != "family AND NOT screenshots" {
+		t.Errorf("Expected the stored tag filter, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSmartAlbumApi(t *testing.T) {
+	storage := setupTestDB(t)
+	r, notifier := setupRouterWithPlayback(storage)
+	first, _ := storage.SaveUrlMetadata("https://example.com/1.jpg", model.Url)
+	second, _ := storage.SaveUrlMetadata("https://example.com/2.jpg", model.Url)
+
+	send := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, target, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := send("POST", "/admin/api/album", `{"name": "Best", "rules": {"minRating": 6}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid rules, got %d", w.Code)
+	}
+	w := send("POST", "/admin/api/album", `{"name": "Best", "rules": {"minRating": 4}}`)
+	var album AlbumRef
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if w.Code != http.StatusOK || album.Rules == nil || album.Rules.MinRating != 4 || len(album.ImageIds) != 0 {
+		t.Fatalf("Expected an empty smart album, got %d: %s", w.Code, w.Body.String())
+	}
+	albumPath := "/admin/api/album/" + strconv.Itoa(album.Id)
+
+	// Rating an image adds it to the album
+	w = send("PATCH", "/admin/api/image/"+strconv.Itoa(second.Id), `{"rating": 5}`)
+	var image ImageRef
+	json.Unmarshal(w.Body.Bytes(), &image)
+	if w.Code != http.StatusOK || image.Rating != 5 || image.UploadedAt.IsZero() {
+		t.Errorf("Expected a rated image with upload time, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = send("PATCH", "/admin/api/image/"+strconv.Itoa(first.Id), `{"rating": 6}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a rating above 5, got %d", w.Code)
+	}
+	w = send("GET", albumPath, "")
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if !reflect.DeepEqual(album.ImageIds, []int{second.Id}) {
+		t.Errorf("Expected image %d, got %s", second.Id, w.Body.String())
+	}
+	if w = send("POST", albumPath+"/images/"+strconv.Itoa(first.Id), ""); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for adding to a smart album, got %d", w.Code)
+	}
+	body := `[{"id": ` + strconv.Itoa(second.Id) + `, "path": "` + second.Path + `", "type": "URL"}]`
+	if w = send("PUT", "/admin/api/image?album="+strconv.Itoa(album.Id), body); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for reordering a smart album, got %d", w.Code)
+	}
+
+	if w = send("PUT", albumPath+"/rules", `{"orientation": "DIAGONAL"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown orientation, got %d", w.Code)
+	}
+	w = send("PUT", albumPath+"/rules", `{"uploadedFrom": "2000-01-01T00:00:00Z"}`)
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if w.Code != http.StatusOK || !reflect.DeepEqual(album.ImageIds, []int{second.Id, first.Id}) {
+		t.Errorf("Expected both images, got %d: %s", w.Code, w.Body.String())
+	}
+	w = send("DELETE", albumPath+"/rules", "")
+	album = AlbumRef{}
+	json.Unmarshal(w.Body.Bytes(), &album)
+	if w.Code != http.StatusOK || album.Rules != nil || len(album.ImageIds) != 2 {
+		t.Errorf("Expected a manual album keeping both images, got %d: %s", w.Code, w.Body.String())
+	}
+	if notifier.changes != 3 {
+		t.Errorf("Expected 3 change notifications, got %d", notifier.changes)
+	}
+}
+
+func TestConfigurationMemories(t *testing.T) {
+	storage := setupTestDB(t)
+	r := setupRouter(storage)
+
+	body := `{"imageDuration": 10, "rotation": "ON_THIS_DAY", "memoryWindow": 3}`
+	req, _ := http.NewRequest("PUT", "/admin/api/configuration", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var config ConfigRef
+	json.Unmarshal(w.Body.Bytes(), &config)
+	if w.Code != http.StatusOK || config.Rotation != model.OnThisDay || config.MemoryWindow != 3 || config.MinMemories != model.DefaultMinMemories {
+		t.Errorf("Expected the ON_THIS_DAY rotation with a 3 day window, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body = `{"imageDuration": 10, "rotation": "ON_THIS_DAY", "memoryWindow": 32}`
+	req, _ = http.NewRequest("PUT", "/admin/api/configuration", bytes.NewBufferString(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a window above 31 days, got %d", w.Code)
+	}
+}
@@ -0,0 +1,236 @@
+package adminapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/smartalbum"
+)
+
+// AlbumRef represents an album for the admin API.
+type AlbumRef struct {
+	// Id is the unique identifier of the album (read-only).
+	Id int `json:"id"`
+	// Name is the name of the album.
+	Name string `json:"name" binding:"required"`
+	// ImageIds are the IDs of the images of the album, in their defined order (read-only, see PUT /album/:id/images).
+	ImageIds []int `json:"imageIds"`
+	// Rules select the images of a smart album (optional on creation, see PUT /album/:id/rules). Omitted for albums whose images are chosen by hand.
+	Rules *model.AlbumRules `json:"rules,omitempty"`
+	// Active indicates whether the rotation shows the album (read-only, see the activeAlbum configuration).
+	Active bool `json:"active"`
+}
+
+func toAlbumRef(album model.Album, config model.Config) AlbumRef {
+	return AlbumRef{
+		Id:       album.Id,
+		Name:     album.Name,
+		ImageIds: album.ImageIds,
+		Rules:    album.Rules,
+		Active:   album.Id == config.ActiveAlbum,
+	}
+}
+
+func (h *Handler) loadAlbums(context *gin.Context) {
+	albums, err := h.storage.LoadAlbums()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	config, err := h.storage.GetConfiguration()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	refs := []AlbumRef{}
+	for _, album := range albums {
+		refs = append(refs, toAlbumRef(album, config))
+	}
+	context.JSON(http.StatusOK, refs)
+}
+
+func (h *Handler) loadAlbum(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	album, err := h.storage.LoadAlbum(id)
+	h.respondWithAlbum(context, album, err)
+}
+
+func (h *Handler) createAlbum(context *gin.Context) {
+	ref, ok := bindAlbum(context)
+	if !ok {
+		return
+	}
+	album, err := h.storage.CreateAlbum(ref.Name)
+	if err == nil && ref.Rules != nil {
+		album, err = h.storage.SetAlbumRules(album.Id, ref.Rules)
+	}
+	h.respondWithAlbum(context, album, err)
+}
+
+func (h *Handler) renameAlbum(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	ref, ok := bindAlbum(context)
+	if !ok {
+		return
+	}
+	album, err := h.storage.RenameAlbum(id, ref.Name)
+	h.respondWithAlbum(context, album, err)
+}
+
+func (h *Handler) deleteAlbum(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	err := h.storage.DeleteAlbum(id)
+	if errors.Is(err, persistence.ErrAlbumNotFound) {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.playback.NotifyChange()
+	context.Status(http.StatusOK)
+}
+
+func (h *Handler) setAlbumImages(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	var imageIds []int
+	if err := context.ShouldBindJSON(&imageIds); err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	album, err := h.storage.SetAlbumImages(id, imageIds)
+	h.respondWithChangedAlbum(context, album, err)
+}
+
+func (h *Handler) addToAlbum(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	imageId, ok := parseId(context, "imageId")
+	if !ok {
+		return
+	}
+	album, err := h.storage.AddToAlbum(id, imageId)
+	h.respondWithChangedAlbum(context, album, err)
+}
+
+func (h *Handler) removeFromAlbum(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	imageId, ok := parseId(context, "imageId")
+	if !ok {
+		return
+	}
+	album, err := h.storage.RemoveFromAlbum(id, imageId)
+	h.respondWithChangedAlbum(context, album, err)
+}
+
+func (h *Handler) setAlbumRules(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	var rules model.AlbumRules
+	if err := context.ShouldBindJSON(&rules); err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if _, err := smartalbum.Compile(rules); err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	album, err := h.storage.SetAlbumRules(id, &rules)
+	h.respondWithChangedAlbum(context, album, err)
+}
+
+func (h *Handler) removeAlbumRules(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	album, err := h.storage.SetAlbumRules(id, nil)
+	h.respondWithChangedAlbum(context, album, err)
+}
+
+// respondWithChangedAlbum responds with an album whose images changed. The rotation is notified, as the album may be active.
+func (h *Handler) respondWithChangedAlbum(context *gin.Context, album model.Album, err error) {
+	if err == nil {
+		h.playback.NotifyChange()
+	}
+	h.respondWithAlbum(context, album, err)
+}
+
+// respondWithAlbum responds with the album, or the status matching the error of loading or changing it.
+func (h *Handler) respondWithAlbum(context *gin.Context, album model.Album, err error) {
+	if errors.Is(err, persistence.ErrAlbumNotFound) {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, persistence.ErrImageNotFound) || errors.Is(err, smartalbum.ErrInvalidRules) {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, persistence.ErrSmartAlbum) {
+		context.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	config, err := h.storage.GetConfiguration()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	context.JSON(http.StatusOK, toAlbumRef(album, config))
+}
+
+// bindAlbum reads the name and rules of the album from the request. Names must not be blank and rules must be valid.
+func bindAlbum(context *gin.Context) (AlbumRef, bool) {
+	var album AlbumRef
+	if err := context.ShouldBindJSON(&album); err != nil || strings.TrimSpace(album.Name) == "" {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return album, false
+	}
+	if album.Rules != nil {
+		if _, err := smartalbum.Compile(*album.Rules); err != nil {
+			context.AbortWithStatus(http.StatusBadRequest)
+			return album, false
+		}
+	}
+	album.Name = strings.TrimSpace(album.Name)
+	return album, true
+}
+
+// parseId reads a numeric path parameter. Invalid values abort the request with 400.
+func parseId(context *gin.Context, name string) (int, bool) {
+	id, err := strconv.Atoi(context.Param(name))
+	if err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
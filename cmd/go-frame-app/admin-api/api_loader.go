@@ -22,24 +22,56 @@ func init() {
 
 // Handler holds dependencies for the admin API.
 type Handler struct {
-	storage model.AdminStorage
+	storage  model.AdminStorage
+	playback model.Playback
 }
 
 // NewHandler creates a new admin API handler with the given storage.
-func NewHandler(storage model.AdminStorage) *Handler {
-	return &Handler{storage: storage}
+// The playback steers the displayed image and is notified whenever images or the configuration change.
+func NewHandler(storage model.AdminStorage, playback model.Playback) *Handler {
+	return &Handler{storage: storage, playback: playback}
 }
 
 // RegisterApiEndpoint registers the admin API endpoints on the provided router group.
-// It sets up routes for image management (CRUD) and configuration.
+// It sets up routes for image management (CRUD), configuration and playback control.
 //
 // Parameters:
 //   - router: The Gin router group to attach the endpoints to.
 func (h *Handler) RegisterApiEndpoint(router *gin.RouterGroup) {
 	router.GET("/image", h.loadAllImageData)
+	router.GET("/image/duplicates", h.loadDuplicates)
+	router.GET("/image/similar", h.loadSimilar)
 	router.PUT("/image", h.updateImageOrder)
+	router.PATCH("/image/:id", h.updateImageSettings)
 	router.DELETE("/image/:id", h.deleteImage)
 	router.POST("/image", h.addImage)
+	router.POST("/image/archive", h.addArchive)
+	router.POST("/image/tags", h.tagImages)
+	router.POST("/image/:id/tags", h.addImageTags)
+	router.DELETE("/image/:id/tags/:tag", h.removeImageTag)
+	router.GET("/tag", h.loadTags)
+	router.POST("/url", h.addUrl)
+	router.POST("/library/rescan", h.rescanLibrary)
+	router.GET("/album", h.loadAlbums)
+	router.POST("/album", h.createAlbum)
+	router.GET("/album/:id", h.loadAlbum)
+	router.PUT("/album/:id", h.renameAlbum)
+	router.DELETE("/album/:id", h.deleteAlbum)
+	router.PUT("/album/:id/images", h.setAlbumImages)
+	router.POST("/album/:id/images/:imageId", h.addToAlbum)
+	router.DELETE("/album/:id/images/:imageId", h.removeFromAlbum)
+	router.PUT("/album/:id/rules", h.setAlbumRules)
+	router.DELETE("/album/:id/rules", h.removeAlbumRules)
+	router.GET("/trash", h.loadTrash)
+	router.POST("/trash/:id/restore", h.restoreImage)
+	router.DELETE("/trash/:id", h.purgeImage)
+	router.DELETE("/trash", h.emptyTrash)
 	router.GET("/configuration", h.loadConfiguration)
 	router.PUT("/configuration", h.updateConfiguration)
+	router.GET("/playback", h.loadPlayback)
+	router.POST("/playback/next", h.playNext)
+	router.POST("/playback/previous", h.playPrevious)
+	router.POST("/playback/pause", h.pausePlayback)
+	router.POST("/playback/resume", h.resumePlayback)
+	router.POST("/playback/jump/:id", h.jumpToImage)
 }
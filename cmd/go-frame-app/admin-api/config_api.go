@@ -2,9 +2,13 @@ package adminapi
 
 import (
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/rotation"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/tagging"
 )
 
 // ConfigRef represents the configuration data structure for the API.
@@ -13,6 +17,24 @@ type ConfigRef struct {
 	ImageDuration int `json:"imageDuration" binding:"required"`
 	// RandomOrder indicates whether images should be shown in random order.
 	RandomOrder bool `json:"randomOrder"`
+	// Rotation selects the strategy used to choose the next image (optional, derived from RandomOrder if empty).
+	Rotation model.RotationMode `json:"rotation"`
+	// AllowedFormats are the MIME types of the image formats accepted for import and upload (optional, empty allows all supported formats).
+	AllowedFormats []string `json:"allowedFormats"`
+	// SimilarityThreshold is the maximum number of differing perceptual hash bits of near-duplicate images (optional, zero uses the default).
+	SimilarityThreshold int `json:"similarityThreshold"`
+	// CollapseSimilar indicates whether only one image of each group of near-duplicates is shown per rotation cycle.
+	CollapseSimilar bool `json:"collapseSimilar"`
+	// TrashRetention is the number of days deleted images are kept in the trash (optional, zero uses the default).
+	TrashRetention int `json:"trashRetention"`
+	// ActiveAlbum is the ID of the album shown by the rotation (optional, zero shows all images).
+	ActiveAlbum int `json:"activeAlbum"`
+	// TagFilter is a tag expression, such as "family AND NOT screenshots", restricting the rotation to matching images (optional, empty shows all images).
+	TagFilter string `json:"tagFilter"`
+	// MemoryWindow is the number of days around today's date, photos taken in previous years are shown as memories by the ON_THIS_DAY rotation (0-31, zero matches the same day only).
+	MemoryWindow int `json:"memoryWindow"`
+	// MinMemories is the number of memories needed for the ON_THIS_DAY rotation to show them instead of all images (optional, zero uses the default).
+	MinMemories int `json:"minMemories"`
 }
 
 func (h *Handler) loadConfiguration(context *gin.Context) {
@@ -22,8 +44,17 @@ func (h *Handler) loadConfiguration(context *gin.Context) {
 		return
 	}
 	var config = ConfigRef{
-		ImageDuration: loadedConfig.ImageDuration,
-		RandomOrder:   loadedConfig.RandomOrder,
+		ImageDuration:       loadedConfig.ImageDuration,
+		RandomOrder:         loadedConfig.RandomOrder,
+		Rotation:            rotation.ModeOf(loadedConfig),
+		AllowedFormats:      loadedConfig.Formats(),
+		SimilarityThreshold: loadedConfig.Similarity(),
+		CollapseSimilar:     loadedConfig.CollapseSimilar,
+		TrashRetention:      int(loadedConfig.Retention().Hours() / 24),
+		ActiveAlbum:         loadedConfig.ActiveAlbum,
+		TagFilter:           loadedConfig.TagFilter,
+		MemoryWindow:        loadedConfig.MemoryWindow,
+		MinMemories:         loadedConfig.Memories(),
 	}
 	context.JSON(http.StatusOK, config)
 }
@@ -35,20 +66,58 @@ func (h *Handler) updateConfiguration(context *gin.Context) {
 		return
 	}
 
-	if config.ImageDuration < 0 {
+	if config.ImageDuration < 0 || config.TrashRetention < 0 || config.SimilarityThreshold < 0 || config.SimilarityThreshold > model.MaxSimilarityThreshold {
 		context.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
+	if config.MemoryWindow < 0 || config.MemoryWindow > model.MaxMemoryWindow || config.MinMemories < 0 {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if config.ActiveAlbum != 0 {
+		if _, err := h.storage.LoadAlbum(config.ActiveAlbum); err != nil {
+			context.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+	if strings.TrimSpace(config.TagFilter) != "" {
+		if _, err := tagging.Parse(config.TagFilter); err != nil {
+			context.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+	for _, format := range config.AllowedFormats {
+		if !slices.Contains(model.SupportedFormats, format) {
+			context.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
 
 	var dbConfig = model.Config{
-		ImageDuration: config.ImageDuration,
-		RandomOrder:   config.RandomOrder,
+		ImageDuration:       config.ImageDuration,
+		RandomOrder:         config.RandomOrder,
+		Rotation:            config.Rotation,
+		AllowedFormats:      config.AllowedFormats,
+		SimilarityThreshold: config.SimilarityThreshold,
+		CollapseSimilar:     config.CollapseSimilar,
+		TrashRetention:      config.TrashRetention,
+		ActiveAlbum:         config.ActiveAlbum,
+		TagFilter:           strings.TrimSpace(config.TagFilter),
+		MemoryWindow:        config.MemoryWindow,
+		MinMemories:         config.MinMemories,
+	}
+	dbConfig.Rotation = rotation.ModeOf(dbConfig)
+	if !rotation.IsValidMode(dbConfig.Rotation) {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
 	}
+	dbConfig.RandomOrder = dbConfig.Rotation == model.Shuffled
 
 	if err := h.storage.UpdateConfiguration(dbConfig); err != nil {
 		context.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
+	h.playback.NotifyChange()
 
 	h.loadConfiguration(context)
 }
@@ -1,71 +1,250 @@
 package adminapi
 
 import (
+	"errors"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/rotation"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/similarity"
 )
 
 // ImageRef represents an image object for the admin API.
 type ImageRef struct {
 	// Id is the unique identifier of the image.
 	Id int `json:"id" binding:"required"`
-	// Path is the filename of the image in the storage.
+	// Path is the filename of the image in the storage, or the URL for remote items.
 	Path string `json:"path" binding:"required"`
-	// Type indicates the content type (e.g. IMAGE).
+	// Type indicates the content type (e.g. IMAGE, URL or PAGE).
 	Type model.Type `json:"type" binding:"required"`
-	// Metadata stores optional metadata about the image.
-	Metadata string `json:"metadata"`
+	// MimeType is the format of the image file, detected from its content (read-only).
+	MimeType string `json:"mimeType"`
+	// Metadata contains the information extracted from the image file (read-only).
+	Metadata model.Metadata `json:"metadata"`
+	// Hash is the hex encoded SHA-256 hash of the image file (read-only).
+	Hash string `json:"hash,omitempty"`
+	// PerceptualHash is the hex encoded difference hash of the image content, similar images have similar hashes (read-only).
+	PerceptualHash string `json:"perceptualHash,omitempty"`
+	// Weight is the relative probability of the image in weighted random rotation.
+	Weight int `json:"weight"`
+	// Duration overrides the configured display duration in seconds (optional, zero uses the configured duration).
+	Duration int `json:"duration"`
+	// EffectiveDuration is the time in seconds the image is displayed (read-only).
+	EffectiveDuration int `json:"effectiveDuration"`
+	// Tags are the normalized tags of the image (read-only, see the tag endpoints).
+	Tags []string `json:"tags,omitempty"`
+	// Rating is the rating of the image from 1 to 5 stars, zero for unrated images.
+	Rating int `json:"rating"`
+	// UploadedAt is the time the image was added to the library (read-only).
+	UploadedAt time.Time `json:"uploadedAt,omitzero"`
+}
+
+// UrlRef represents a remote item to add to the frame.
+type UrlRef struct {
+	// Url is the absolute http(s) URL of the remote content.
+	Url string `json:"url" binding:"required"`
+	// Type is URL for remote images or PAGE for web pages (optional, defaults to URL).
+	Type model.Type `json:"type"`
+}
+
+// DuplicateRef represents a group of images with the same file content.
+type DuplicateRef struct {
+	// Hash is the hex encoded SHA-256 hash shared by the images.
+	Hash string `json:"hash"`
+	// Images are the images sharing the content, in the defined order.
+	Images []ImageRef `json:"images"`
+}
+
+// ImageSettingsRef represents the changeable settings of an image. Omitted settings stay unchanged.
+type ImageSettingsRef struct {
+	// Weight is the relative probability of the image in weighted random rotation.
+	Weight *int `json:"weight"`
+	// Duration overrides the configured display duration in seconds. Zero removes the override.
+	Duration *int `json:"duration"`
+	// Rating is the rating of the image from 1 to 5 stars. Zero removes the rating.
+	Rating *int `json:"rating"`
+}
+
+func toImageRef(image model.Image, config model.Config) ImageRef {
+	return ImageRef{
+		Id:                image.Id,
+		Path:              image.Path,
+		Type:              image.Type,
+		MimeType:          image.MimeType,
+		Metadata:          image.Metadata,
+		Hash:              image.Hash,
+		PerceptualHash:    image.PerceptualHash,
+		Weight:            image.Weight,
+		Duration:          image.Duration,
+		EffectiveDuration: int(rotation.Duration(image, config).Seconds()),
+		Tags:              image.Tags,
+		Rating:            image.Rating,
+		UploadedAt:        image.UploadedAt,
+	}
 }
 
 func (h *Handler) loadAllImageData(context *gin.Context) {
+	album, ok := albumQuery(context)
+	if !ok {
+		return
+	}
+	load, ok := h.tagQuery(context, album)
+	if !ok {
+		return
+	}
+	h.respondWithImages(context, load)
+}
+
+// respondWithImages responds with the loaded images.
+func (h *Handler) respondWithImages(context *gin.Context, load func() ([]model.Image, error)) {
 	var images []ImageRef
 
-	loadedImages, err := h.storage.LoadImages()
+	loadedImages, err := load()
+	if errors.Is(err, persistence.ErrAlbumNotFound) {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	config, err := h.storage.GetConfiguration()
 	if err != nil {
 		context.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
 
 	for _, loadedImage := range loadedImages {
-		var image = ImageRef{
-			Id:       loadedImage.Id,
-			Path:     loadedImage.Path,
-			Type:     loadedImage.Type,
-			Metadata: loadedImage.Metadata,
-		}
-		images = append(images, image)
+		images = append(images, toImageRef(loadedImage, config))
 	}
 	context.JSON(http.StatusOK, images)
 }
 
+func (h *Handler) loadDuplicates(context *gin.Context) {
+	groups, err := h.storage.FindDuplicates()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	config, err := h.storage.GetConfiguration()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	duplicates := []DuplicateRef{}
+	for _, group := range groups {
+		duplicate := DuplicateRef{Hash: group[0].Hash}
+		for _, image := range group {
+			duplicate.Images = append(duplicate.Images, toImageRef(image, config))
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+	context.JSON(http.StatusOK, duplicates)
+}
+
+func (h *Handler) loadSimilar(context *gin.Context) {
+	config, err := h.storage.GetConfiguration()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	distance := config.Similarity()
+	if value, found := context.GetQuery("distance"); found {
+		distance, err = strconv.Atoi(value)
+		if err != nil || distance < 0 || distance > model.MaxSimilarityThreshold {
+			context.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+	}
+	images, err := h.storage.LoadLibrary()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	groups := [][]ImageRef{}
+	for _, group := range similarity.Groups(images, distance) {
+		var refs []ImageRef
+		for _, image := range group {
+			refs = append(refs, toImageRef(image, config))
+		}
+		groups = append(groups, refs)
+	}
+	context.JSON(http.StatusOK, groups)
+}
+
+// updateImageOrder updates the order of the rotation, i.e. of the active album or the library, or with an "album"
+// parameter, of the album. The images stay the same, images not part of the reordered images are rejected. Smart albums cannot be reordered.
 func (h *Handler) updateImageOrder(context *gin.Context) {
+	album, ok := albumQuery(context)
+	if !ok {
+		return
+	}
 	var images []ImageRef
 	if err := context.ShouldBindJSON(&images); err != nil {
 		context.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
-	var dbImages []model.Image
-	for _, image := range images {
-		var dbImage = model.Image{
-			Id:       image.Id,
-			Path:     image.Path,
-			Type:     image.Type,
-			Metadata: image.Metadata,
+	var err error
+	if album > 0 {
+		var imageIds []int
+		for _, image := range images {
+			imageIds = append(imageIds, image.Id)
 		}
-		dbImages = append(dbImages, dbImage)
+		_, err = h.storage.ReorderAlbum(album, imageIds)
+	} else {
+		var dbImages []model.Image
+		for _, image := range images {
+			dbImages = append(dbImages, model.Image{Id: image.Id})
+		}
+		err = h.storage.ReorderImages(dbImages)
+	}
+	if errors.Is(err, persistence.ErrAlbumNotFound) {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
 	}
-	if err := h.storage.ReorderImages(dbImages); err != nil {
+	if errors.Is(err, persistence.ErrImageNotFound) {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, persistence.ErrSmartAlbum) {
+		context.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	if err != nil {
 		context.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
+	h.playback.NotifyChange()
+
+	if album > 0 {
+		h.respondWithImages(context, func() ([]model.Image, error) {
+			return h.storage.LoadAlbumImages(album)
+		})
+		return
+	}
+	h.respondWithImages(context, h.storage.LoadImages)
+}
 
-	h.loadAllImageData(context)
+// albumQuery reads the ID of the album selected by the "album" parameter of the request, zero selects the library.
+func albumQuery(context *gin.Context) (int, bool) {
+	value, found := context.GetQuery("album")
+	if !found {
+		return 0, true
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
 }
 
 func (h *Handler) deleteImage(context *gin.Context) {
@@ -76,36 +255,94 @@ func (h *Handler) deleteImage(context *gin.Context) {
 		return
 	}
 	err = h.storage.DeleteImage(intId)
+	if errors.Is(err, persistence.ErrImageNotFound) {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		context.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
+	h.playback.NotifyChange()
 	context.Status(http.StatusOK)
 }
 
-func (h *Handler) addImage(context *gin.Context) {
-	form, err := context.FormFile("image")
-	if err != nil || form == nil {
+func (h *Handler) addUrl(context *gin.Context) {
+	var ref UrlRef
+	if err := context.ShouldBindJSON(&ref); err != nil {
 		context.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	err = context.SaveUploadedFile(form, persistence.ImageDir+string(os.PathSeparator)+form.Filename)
+	if ref.Type == "" {
+		ref.Type = model.Url
+	}
+	if !ref.Type.IsRemote() || !isValidUrl(ref.Url) {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	loadedImage, err := h.storage.SaveUrlMetadata(ref.Url, ref.Type)
 	if err != nil {
 		context.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
+	h.playback.NotifyChange()
+	h.respondWithImage(context, loadedImage)
+}
 
-	loadedImage, err := h.storage.SaveImageMetadata(form.Filename)
+func isValidUrl(rawUrl string) bool {
+	parsed, err := url.Parse(rawUrl)
 	if err != nil {
-		context.AbortWithError(http.StatusInternalServerError, err)
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func (h *Handler) updateImageSettings(context *gin.Context) {
+	intId, err := strconv.Atoi(context.Param("id"))
+	if err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-	var image = ImageRef{
-		Id:       loadedImage.Id,
-		Path:     loadedImage.Path,
-		Type:     loadedImage.Type,
-		Metadata: loadedImage.Metadata,
+	var settings ImageSettingsRef
+	if err := context.ShouldBindJSON(&settings); err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if (settings.Weight != nil && *settings.Weight < 0) || (settings.Duration != nil && *settings.Duration < 0) ||
+		(settings.Rating != nil && (*settings.Rating < 0 || *settings.Rating > model.MaxRating)) {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
 	}
 
-	context.JSON(http.StatusOK, image)
+	image, err := h.storage.LoadImage(intId)
+	if err != nil {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if settings.Weight != nil {
+		image.Weight = *settings.Weight
+	}
+	if settings.Duration != nil {
+		image.Duration = *settings.Duration
+	}
+	if settings.Rating != nil {
+		image.Rating = *settings.Rating
+	}
+	if err := h.storage.UpdateImage(image); err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.playback.NotifyChange()
+
+	h.respondWithImage(context, image)
+}
+
+func (h *Handler) respondWithImage(context *gin.Context, image model.Image) {
+	config, err := h.storage.GetConfiguration()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	context.JSON(http.StatusOK, toImageRef(image, config))
 }
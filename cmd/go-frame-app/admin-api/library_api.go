@@ -0,0 +1,56 @@
+package adminapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+)
+
+// LibraryReportRef describes the changes made by a rescan of the image directory.
+type LibraryReportRef struct {
+	// Imported are the images created for files found in the image directory.
+	Imported []ImageRef `json:"imported"`
+	// Removed are the images moved to the trash because their files are missing.
+	Removed []ImageRef `json:"removed"`
+	// Skipped are the names of files that were not imported, because of their format or as duplicates of stored images.
+	Skipped []string `json:"skipped"`
+	// OrderRepaired indicates whether the display order was inconsistent and has been rebuilt.
+	OrderRepaired bool `json:"orderRepaired"`
+}
+
+func (h *Handler) rescanLibrary(context *gin.Context) {
+	report, err := h.storage.Reconcile()
+	if errors.Is(err, persistence.ErrImageDirUnavailable) {
+		context.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	config, err := h.storage.GetConfiguration()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if report.Changed() {
+		h.playback.NotifyChange()
+	}
+
+	response := LibraryReportRef{
+		Imported:      []ImageRef{},
+		Removed:       []ImageRef{},
+		Skipped:       []string{},
+		OrderRepaired: report.OrderRepaired,
+	}
+	for _, image := range report.Imported {
+		response.Imported = append(response.Imported, toImageRef(image, config))
+	}
+	for _, image := range report.Removed {
+		response.Removed = append(response.Removed, toImageRef(image, config))
+	}
+	response.Skipped = append(response.Skipped, report.Skipped...)
+	context.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,120 @@
+package adminapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/rotation"
+)
+
+// PlaybackRef represents the playback state of the frame for the API.
+type PlaybackRef struct {
+	// CurrentImageId is the ID of the currently displayed image.
+	CurrentImageId int `json:"currentImageId"`
+	// Paused indicates whether the rotation is paused.
+	Paused bool `json:"paused"`
+	// History contains the IDs of previously displayed images, the most recent one last.
+	History []int `json:"history"`
+	// OverrideUntil is the time until which a manually selected image stays on screen (optional).
+	OverrideUntil *time.Time `json:"overrideUntil,omitempty"`
+}
+
+func (h *Handler) loadPlayback(context *gin.Context) {
+	status, err := h.storage.GetCurrentStatus()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	var playback = PlaybackRef{
+		CurrentImageId: status.CurrentImageId,
+		Paused:         status.Paused,
+		History:        status.History,
+	}
+	if time.Now().Before(status.OverrideUntil) {
+		playback.OverrideUntil = &status.OverrideUntil
+	}
+	context.JSON(http.StatusOK, playback)
+}
+
+func (h *Handler) playNext(context *gin.Context) {
+	hold, ok := parseHold(context)
+	if !ok {
+		return
+	}
+	if _, err := h.playback.Next(hold); err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.loadPlayback(context)
+}
+
+func (h *Handler) playPrevious(context *gin.Context) {
+	hold, ok := parseHold(context)
+	if !ok {
+		return
+	}
+	if _, err := h.playback.Previous(hold); err != nil {
+		if errors.Is(err, rotation.ErrNoHistory) {
+			context.AbortWithStatus(http.StatusConflict)
+			return
+		}
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.loadPlayback(context)
+}
+
+func (h *Handler) jumpToImage(context *gin.Context) {
+	id, err := strconv.Atoi(context.Param("id"))
+	if err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	hold, ok := parseHold(context)
+	if !ok {
+		return
+	}
+	if _, err := h.storage.LoadImage(id); err != nil {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if _, err := h.playback.Jump(id, hold); err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.loadPlayback(context)
+}
+
+func (h *Handler) pausePlayback(context *gin.Context) {
+	if err := h.playback.Pause(); err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.loadPlayback(context)
+}
+
+func (h *Handler) resumePlayback(context *gin.Context) {
+	if err := h.playback.Resume(); err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.loadPlayback(context)
+}
+
+// parseHold reads the optional "hold" query parameter, given in seconds.
+// It aborts the request if the parameter is invalid.
+func parseHold(context *gin.Context) (time.Duration, bool) {
+	value := context.Query("hold")
+	if value == "" {
+		return 0, true
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
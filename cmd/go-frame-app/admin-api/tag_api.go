@@ -0,0 +1,159 @@
+package adminapi
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/tagging"
+)
+
+// TagRef represents a tag in use for the admin API.
+type TagRef struct {
+	// Name is the normalized tag.
+	Name string `json:"name"`
+	// Count is the number of images carrying the tag.
+	Count int `json:"count"`
+}
+
+// TagChangeRef represents tags to add to and remove from several images at once.
+type TagChangeRef struct {
+	// ImageIds are the IDs of the images to change.
+	ImageIds []int `json:"imageIds" binding:"required"`
+	// Add are the tags to add to every image (optional).
+	Add []string `json:"add"`
+	// Remove are the tags to remove from every image (optional).
+	Remove []string `json:"remove"`
+}
+
+func (h *Handler) loadTags(context *gin.Context) {
+	tags, err := h.storage.LoadTags()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	refs := []TagRef{}
+	for name, count := range tags {
+		refs = append(refs, TagRef{Name: name, Count: count})
+	}
+	slices.SortFunc(refs, func(a, b TagRef) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	context.JSON(http.StatusOK, refs)
+}
+
+func (h *Handler) addImageTags(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	var tags []string
+	if err := context.ShouldBindJSON(&tags); err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	images, err := h.storage.TagImages([]int{id}, tags, nil)
+	h.respondWithTaggedImage(context, images, err)
+}
+
+func (h *Handler) removeImageTag(context *gin.Context) {
+	id, ok := parseId(context, "id")
+	if !ok {
+		return
+	}
+	images, err := h.storage.TagImages([]int{id}, nil, []string{context.Param("tag")})
+	h.respondWithTaggedImage(context, images, err)
+}
+
+// respondWithTaggedImage responds with the single image changed by TagImages.
+func (h *Handler) respondWithTaggedImage(context *gin.Context, images []model.Image, err error) {
+	if errors.Is(err, persistence.ErrImageNotFound) {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, tagging.ErrInvalidTag) {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.playback.NotifyChange()
+	h.respondWithImage(context, images[0])
+}
+
+func (h *Handler) tagImages(context *gin.Context) {
+	var change TagChangeRef
+	if err := context.ShouldBindJSON(&change); err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	images, err := h.storage.TagImages(change.ImageIds, change.Add, change.Remove)
+	if errors.Is(err, persistence.ErrImageNotFound) || errors.Is(err, tagging.ErrInvalidTag) {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.playback.NotifyChange()
+	h.respondWithImages(context, func() ([]model.Image, error) {
+		return images, nil
+	})
+}
+
+// tagQuery returns the function loading the images selected by the query of the request, out of the library or,
+// with an album ID, out of the album. Images carrying all "tag" parameters are selected, a "filter" parameter
+// restricts the images to those matching the tag expression. Without parameters, all images are loaded.
+func (h *Handler) tagQuery(context *gin.Context, album int) (func() ([]model.Image, error), bool) {
+	load := h.storage.LoadLibrary
+	if album > 0 {
+		load = func() ([]model.Image, error) {
+			return h.storage.LoadAlbumImages(album)
+		}
+	}
+	if tags := context.QueryArray("tag"); len(tags) > 0 {
+		normalized, err := tagging.NormalizeAll(tags)
+		if err != nil {
+			context.AbortWithStatus(http.StatusBadRequest)
+			return nil, false
+		}
+		if album > 0 {
+			loadAlbum := load
+			load = func() ([]model.Image, error) {
+				images, err := loadAlbum()
+				return slices.DeleteFunc(images, func(image model.Image) bool {
+					return slices.ContainsFunc(normalized, func(tag string) bool {
+						return !slices.Contains(image.Tags, tag)
+					})
+				}), err
+			}
+		} else {
+			load = func() ([]model.Image, error) {
+				return h.storage.FindByTags(tags)
+			}
+		}
+	}
+	filter := context.Query("filter")
+	if filter == "" {
+		return load, true
+	}
+	expression, err := tagging.Parse(filter)
+	if err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return nil, false
+	}
+	return func() ([]model.Image, error) {
+		images, err := load()
+		return slices.DeleteFunc(images, func(image model.Image) bool {
+			return !expression.Matches(image.Tags)
+		}), err
+	}, true
+}
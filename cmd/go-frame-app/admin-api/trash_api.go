@@ -0,0 +1,94 @@
+package adminapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+)
+
+// TrashRef represents a deleted image for the admin API.
+type TrashRef struct {
+	// Image is the deleted image, as it was before the deletion.
+	Image ImageRef `json:"image"`
+	// TrashedAt is the time the image was deleted.
+	TrashedAt time.Time `json:"trashedAt"`
+	// PurgeAt is the time the image is deleted permanently, according to the configured retention period.
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+func (h *Handler) loadTrash(context *gin.Context) {
+	images, err := h.storage.LoadTrash()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	config, err := h.storage.GetConfiguration()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	trash := []TrashRef{}
+	for _, image := range images {
+		trash = append(trash, TrashRef{
+			Image:     toImageRef(image, config),
+			TrashedAt: image.TrashedAt,
+			PurgeAt:   image.TrashedAt.Add(config.Retention()),
+		})
+	}
+	context.JSON(http.StatusOK, trash)
+}
+
+func (h *Handler) restoreImage(context *gin.Context) {
+	id, err := strconv.Atoi(context.Param("id"))
+	if err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	image, err := h.storage.RestoreImage(id)
+	if errors.Is(err, persistence.ErrNotInTrash) {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, persistence.ErrDuplicateImage) || errors.Is(err, persistence.ErrFileMissing) {
+		// The content has been stored again since the deletion, or has to return to the image directory first
+		context.AbortWithStatus(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.playback.NotifyChange()
+	h.respondWithImage(context, image)
+}
+
+func (h *Handler) purgeImage(context *gin.Context) {
+	id, err := strconv.Atoi(context.Param("id"))
+	if err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	err = h.storage.PurgeImage(id)
+	if errors.Is(err, persistence.ErrNotInTrash) {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	context.Status(http.StatusNoContent)
+}
+
+func (h *Handler) emptyTrash(context *gin.Context) {
+	if _, err := h.storage.PurgeTrash(time.Now()); err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	context.Status(http.StatusNoContent)
+}
@@ -0,0 +1,207 @@
+package adminapi
+
+import (
+	"archive/zip"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+)
+
+// MaxUploadSize is the maximum size of an upload request in bytes. Each contained image is
+// additionally limited by persistence.MaxImageSize.
+var MaxUploadSize int64 = 1 << 30
+
+// UploadStatus is the outcome of importing a single file.
+type UploadStatus string
+
+const (
+	// Created means the file was stored as a new image.
+	Created UploadStatus = "CREATED"
+	// Duplicate means the file was skipped, because the same image is already stored.
+	Duplicate UploadStatus = "DUPLICATE"
+	// Rejected means the file was not stored, e.g. because its format is not allowed.
+	Rejected UploadStatus = "REJECTED"
+)
+
+// UploadResult reports the outcome of importing a single file of a bulk upload.
+type UploadResult struct {
+	// Name is the file name in the request or the path in the archive.
+	Name string `json:"name"`
+	// Status is the outcome of the import.
+	Status UploadStatus `json:"status"`
+	// Image is the created image, or the existing image for duplicates.
+	Image *ImageRef `json:"image,omitempty"`
+	// Error describes why the file was rejected.
+	Error string `json:"error,omitempty"`
+}
+
+// UploadReport lists the outcome of a bulk upload in the order of the uploaded files.
+type UploadReport struct {
+	// Files contains one result per uploaded file.
+	Files []UploadResult `json:"files"`
+}
+
+// addImage imports the files of all "image" parts. A single file is answered with the created image,
+// multiple files with an upload report.
+func (h *Handler) addImage(context *gin.Context) {
+	context.Request.Body = http.MaxBytesReader(context.Writer, context.Request.Body, MaxUploadSize)
+	form, err := context.MultipartForm()
+	if err != nil {
+		abortWithFormError(context, err)
+		return
+	}
+	files := form.File["image"]
+	if len(files) == 0 {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if len(files) > 1 {
+		h.addImages(context, files)
+		return
+	}
+
+	loadedImage, err := importUploadedFile(h.storage, files[0])
+	switch {
+	case errors.Is(err, persistence.ErrImageTooLarge):
+		context.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, persistence.ErrFormatNotAllowed):
+		context.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, persistence.ErrDuplicateImage):
+		context.AbortWithStatus(http.StatusConflict)
+		return
+	case err != nil:
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	h.playback.NotifyChange()
+	h.respondWithImage(context, loadedImage)
+}
+
+// addImages imports multiple uploaded files in request order and responds with the upload report.
+func (h *Handler) addImages(context *gin.Context, files []*multipart.FileHeader) {
+	config, err := h.storage.GetConfiguration()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	report := UploadReport{Files: []UploadResult{}}
+	for _, file := range files {
+		image, err := importUploadedFile(h.storage, file)
+		report.Files = append(report.Files, toUploadResult(file.Filename, image, err, config))
+	}
+	h.respondWithReport(context, report)
+}
+
+// addArchive imports all images of the uploaded ZIP archive in archive order and responds with the upload report.
+// Directories and hidden files are ignored.
+func (h *Handler) addArchive(context *gin.Context) {
+	context.Request.Body = http.MaxBytesReader(context.Writer, context.Request.Body, MaxUploadSize)
+	form, err := context.FormFile("archive")
+	if err != nil {
+		abortWithFormError(context, err)
+		return
+	}
+	file, err := form.Open()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+	archive, err := zip.NewReader(file, form.Size)
+	if err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	config, err := h.storage.GetConfiguration()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+
+	report := UploadReport{Files: []UploadResult{}}
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || isHiddenEntry(entry.Name) {
+			continue
+		}
+		image, err := importArchiveEntry(h.storage, entry)
+		report.Files = append(report.Files, toUploadResult(entry.Name, image, err, config))
+	}
+	h.respondWithReport(context, report)
+}
+
+func (h *Handler) respondWithReport(context *gin.Context, report UploadReport) {
+	for _, result := range report.Files {
+		if result.Status == Created {
+			h.playback.NotifyChange()
+			break
+		}
+	}
+	context.JSON(http.StatusOK, report)
+}
+
+func importUploadedFile(storage model.ImageAdminStorage, file *multipart.FileHeader) (model.Image, error) {
+	content, err := file.Open()
+	if err != nil {
+		return model.Image{}, err
+	}
+	defer content.Close()
+	return storage.ImportImage(file.Filename, content)
+}
+
+func importArchiveEntry(storage model.ImageAdminStorage, entry *zip.File) (model.Image, error) {
+	content, err := entry.Open()
+	if err != nil {
+		return model.Image{}, err
+	}
+	defer content.Close()
+	return storage.ImportImage(path.Base(entry.Name), content)
+}
+
+func toUploadResult(name string, image model.Image, err error, config model.Config) UploadResult {
+	result := UploadResult{Name: name}
+	switch {
+	case err == nil:
+		result.Status = Created
+	case errors.Is(err, persistence.ErrDuplicateImage):
+		result.Status = Duplicate
+	default:
+		if !errors.Is(err, persistence.ErrImageTooLarge) && !errors.Is(err, persistence.ErrFormatNotAllowed) {
+			ErrorLogger.Println("Cannot import", name, ":", err)
+		}
+		result.Status = Rejected
+		result.Error = err.Error()
+		return result
+	}
+	ref := toImageRef(image, config)
+	result.Image = &ref
+	return result
+}
+
+// isHiddenEntry reports whether the archive entry is a hidden file or lies in a hidden directory,
+// e.g. the resource forks macOS adds to archives.
+func isHiddenEntry(name string) bool {
+	for _, element := range strings.Split(name, "/") {
+		if (strings.HasPrefix(element, ".") && element != "..") || element == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// abortWithFormError answers requests exceeding MaxUploadSize with 413 and other malformed requests with 400.
+func abortWithFormError(context *gin.Context, err error) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		context.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		return
+	}
+	context.AbortWithStatus(http.StatusBadRequest)
+}
@@ -22,19 +22,26 @@ func init() {
 
 // Handler holds dependencies for the API.
 type Handler struct {
-	storage model.ImageStorage
+	display model.Display
+	events  *broadcaster
 }
 
-// NewHandler creates a new API handler with the given storage.
-func NewHandler(storage model.ImageStorage) *Handler {
-	return &Handler{storage: storage}
+// NewHandler creates a new API handler serving the image of the given display.
+// Changes of the display are pushed to all stream clients.
+func NewHandler(display model.Display) *Handler {
+	h := &Handler{display: display, events: newBroadcaster()}
+	display.OnChange(func(image model.Image) {
+		h.events.publish(h.toImageRef(image))
+	})
+	return h
 }
 
 // RegisterApiEndpoint registers the public API endpoints on the provided router group.
-// It sets up the route for getting the current image.
+// It sets up the routes for getting the current image and streaming image changes.
 //
 // Parameters:
 //   - router: The Gin router group to attach the endpoints to.
 func (h *Handler) RegisterApiEndpoint(router *gin.RouterGroup) {
 	router.GET("/image/current", h.getCurrentImageData)
+	router.GET("/image/stream", h.streamImages)
 }
@@ -1,11 +1,13 @@
 package api
 
 import (
+	"bufio"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	bolt "go.etcd.io/bbolt"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/rotation"
 )
 
 func setupTestDB(t *testing.T) *persistence.Storage {
@@ -59,71 +62,30 @@ func setupTestDB(t *testing.T) *persistence.Storage {
 	return storage
 }
 
-func TestCalculateCurrentImage(t *testing.T) {
-	storage := setupTestDB(t)
-	handler := NewHandler(storage)
-
-	// 1. Initial state, no images.
-	path, err := handler.calculateCurrentImage()
-	if err != nil {
-		// If it errors, that's acceptable too in case of fix, but currently it doesn't.
-	}
-	if path != "" {
-		t.Errorf("Expected empty path when no images, got %s", path)
-	}
-
-	// 2. Add an image
-	img1, err := storage.SaveImageMetadata("img1.jpg")
-	if err != nil {
-		t.Fatalf("Failed to save image: %v", err)
-	}
-
-	// 3. Current ID is -1 (from reset status), so should load first image
-	path, err = handler.calculateCurrentImage()
-	if err != nil {
-		t.Fatalf("calculateCurrentImage failed: %v", err)
-	}
-	if path != "img1.jpg" {
-		t.Errorf("Expected img1.jpg, got %s", path)
-	}
-
-	// 4. Verify status updated
-	status, _ := storage.GetCurrentStatus()
-	if status.CurrentImageId != img1.Id {
-		t.Errorf("Expected status ID %d, got %d", img1.Id, status.CurrentImageId)
-	}
+// fakeDisplay serves a fixed image and lets tests trigger change notifications.
+type fakeDisplay struct {
+	image     model.Image
+	listeners []func(image model.Image)
+	// memories maps image IDs to the number of years the images were taken ago.
+	memories map[int]int
+}
 
-	// 5. Add second image
-	_, _ = storage.SaveImageMetadata("img2.jpg")
+func (d *fakeDisplay) CurrentImage() (model.Image, error) {
+	return d.image, nil
+}
 
-	// 6. Call again immediately. Duration is 60s. Should still be img1.
-	path, err = handler.calculateCurrentImage()
-	if err != nil {
-		t.Fatalf("calculateCurrentImage failed: %v", err)
-	}
-	if path != "img1.jpg" {
-		t.Errorf("Expected img1.jpg (not switched yet), got %s", path)
-	}
+func (d *fakeDisplay) OnChange(listener func(image model.Image)) {
+	d.listeners = append(d.listeners, listener)
+}
 
-	// 7. Manipulate LastSwitch to force switch
-	storage.UpdateImageStatus(img1.Id) // Resets time to Now
-	// Use explicit DB update to set timeback
-	storage.Db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("status"))
-		status := model.Status{
-			CurrentImageId: img1.Id,
-			LastSwitch:     time.Now().Add(-61 * time.Second),
-		}
-		bytes, _ := json.Marshal(status)
-		return b.Put([]byte("status"), bytes)
-	})
+func (d *fakeDisplay) YearsAgo(image model.Image) int {
+	return d.memories[image.Id]
+}
 
-	path, err = handler.calculateCurrentImage()
-	if err != nil {
-		t.Fatalf("calculateCurrentImage failed: %v", err)
-	}
-	if path != "img2.jpg" {
-		t.Errorf("Expected img2.jpg, got %s", path)
+func (d *fakeDisplay) change(image model.Image) {
+	d.image = image
+	for _, listener := range d.listeners {
+		listener(image)
 	}
 }
 
@@ -131,7 +93,7 @@ func TestGetCurrentImageData(t *testing.T) {
 	storage := setupTestDB(t)
 	storage.SaveImageMetadata("test.jpg")
 
-	handler := NewHandler(storage)
+	handler := NewHandler(rotation.NewEngine(storage, rotation.SystemClock))
 
 	// Setup Gin
 	gin.SetMode(gin.TestMode)
@@ -164,4 +126,170 @@ func TestGetCurrentImageData(t *testing.T) {
 	if ref.Type != model.ImageType {
 		t.Errorf("Expected type IMAGE, got %s", ref.Type)
 	}
+
+	// Reading the current image must not advance the rotation
+	status, _ := storage.GetCurrentStatus()
+	if status.CurrentImageId != -1 {
+		t.Errorf("Expected unchanged status, got current image %d", status.CurrentImageId)
+	}
+}
+
+func TestGetCurrentImageDataWithoutImages(t *testing.T) {
+	storage := setupTestDB(t)
+	handler := NewHandler(rotation.NewEngine(storage, rotation.SystemClock))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler.RegisterApiEndpoint(r.Group("/"))
+
+	req, _ := http.NewRequest("GET", "/image/current", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+}
+
+func TestGetCurrentImageDataWithMetadata(t *testing.T) {
+	takenAt := time.Date(2021, 7, 14, 16, 30, 0, 0, time.UTC)
+	display := &fakeDisplay{image: model.Image{Id: 1, Path: "img1.jpg", Type: model.ImageType, Metadata: model.Metadata{
+		TakenAt:     takenAt,
+		CameraModel: "EOS 5D",
+		Location:    &model.Location{Latitude: 48.21, Longitude: 16.37},
+	}}}
+	handler := NewHandler(display)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler.RegisterApiEndpoint(r.Group("/"))
+
+	req, _ := http.NewRequest("GET", "/image/current", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response map[string]any
+	json.Unmarshal(w.Body.Bytes(), &response)
+	meta, _ := response["metadata"].(map[string]any)
+	if meta["takenAt"] != "2021-07-14T16:30:00Z" || meta["cameraModel"] != "EOS 5D" || meta["location"] == nil {
+		t.Errorf("Expected metadata in response, got %s", w.Body.String())
+	}
+	if _, ok := meta["cameraMake"]; ok {
+		t.Errorf("Expected missing metadata to be omitted, got %s", w.Body.String())
+	}
+	if _, ok := response["memoryLabel"]; ok {
+		t.Errorf("Expected no memory label, got %s", w.Body.String())
+	}
+}
+
+func TestGetCurrentImageDataWithMemory(t *testing.T) {
+	display := &fakeDisplay{image: model.Image{Id: 1, Path: "img1.jpg", Type: model.ImageType}, memories: map[int]int{1: 3, 2: 1}}
+	handler := NewHandler(display)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler.RegisterApiEndpoint(r.Group("/"))
+
+	req, _ := http.NewRequest("GET", "/image/current", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var ref ImageRef
+	json.Unmarshal(w.Body.Bytes(), &ref)
+	if ref.YearsAgo != 3 || ref.MemoryLabel != "3 years ago" {
+		t.Errorf("Expected a memory of 3 years ago, got %s", w.Body.String())
+	}
+	display.image = model.Image{Id: 2, Path: "img2.jpg", Type: model.ImageType}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &ref)
+	if ref.MemoryLabel != "1 year ago" {
+		t.Errorf("Expected a memory of 1 year ago, got %s", w.Body.String())
+	}
+}
+
+func readStreamEvent(t *testing.T, reader *bufio.Reader) ImageRef {
+	t.Helper()
+	var event, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimPrefix(line, "data:")
+		case line == "" && data != "":
+			if event != "image" {
+				t.Errorf("Expected image event, got %s", event)
+			}
+			var ref ImageRef
+			if err := json.Unmarshal([]byte(data), &ref); err != nil {
+				t.Fatalf("Failed to parse event: %v", err)
+			}
+			return ref
+		}
+	}
+}
+
+func TestStreamImages(t *testing.T) {
+	display := &fakeDisplay{image: model.Image{Id: 1, Path: "img1.jpg", Type: model.ImageType}}
+	handler := NewHandler(display)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler.RegisterApiEndpoint(r.Group("/"))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/image/stream")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/event-stream") {
+		t.Errorf("Expected event stream, got %s", contentType)
+	}
+	reader := bufio.NewReader(response.Body)
+
+	// The current image is sent right away
+	ref := readStreamEvent(t, reader)
+	if ref.Path != "img1.jpg" {
+		t.Errorf("Expected img1.jpg, got %s", ref.Path)
+	}
+
+	// Changes of the display are pushed
+	display.change(model.Image{Id: 2, Path: "img2.jpg", Type: model.ImageType})
+	ref = readStreamEvent(t, reader)
+	if ref.Path != "img2.jpg" {
+		t.Errorf("Expected img2.jpg, got %s", ref.Path)
+	}
+}
+
+func TestBroadcasterPublish(t *testing.T) {
+	events := newBroadcaster()
+	updates := events.subscribe()
+
+	events.publish(ImageRef{Path: "a.jpg"})
+	events.publish(ImageRef{Path: "b.jpg"})
+	// Slow subscribers only get the latest image
+	if ref := <-updates; ref.Path != "b.jpg" {
+		t.Errorf("Expected b.jpg, got %s", ref.Path)
+	}
+	select {
+	case ref := <-updates:
+		t.Errorf("Unexpected update %s", ref.Path)
+	default:
+	}
+
+	events.unsubscribe(updates)
+	events.publish(ImageRef{Path: "c.jpg"})
+	select {
+	case ref := <-updates:
+		t.Errorf("Unsubscribed channel received %s", ref.Path)
+	default:
+	}
 }
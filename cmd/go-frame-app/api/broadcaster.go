@@ -0,0 +1,41 @@
+package api
+
+import "sync"
+
+// broadcaster distributes image changes to all subscribed stream clients.
+type broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan ImageRef]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subscribers: make(map[chan ImageRef]struct{})}
+}
+
+// subscribe registers a new subscriber. Slow subscribers only receive the latest image.
+func (b *broadcaster) subscribe() chan ImageRef {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	updates := make(chan ImageRef, 1)
+	b.subscribers[updates] = struct{}{}
+	return updates
+}
+
+func (b *broadcaster) unsubscribe(updates chan ImageRef) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, updates)
+}
+
+// publish sends the image to all subscribers without blocking.
+func (b *broadcaster) publish(ref ImageRef) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for updates := range b.subscribers {
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- ref
+	}
+}
@@ -2,7 +2,7 @@ package api
 
 import (
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
@@ -10,49 +10,38 @@ import (
 
 // ImageRef represents a reference to an image or content to be displayed.
 type ImageRef struct {
+	// Id is the unique identifier of the content. Remote images are served from /static/remote/:id.
+	Id int `json:"id"`
 	// Path is the filename or URL of the content.
 	Path string `json:"path" binding:"required"`
-	// Type indicates the type of content (e.g. IMAGE or URL).
+	// Type indicates the type of content (IMAGE, URL for remote images or PAGE for web pages).
 	Type model.Type `json:"type" binding:"required"`
-	// Metadata contains additional information about the image (optional).
-	Metadata string `json:"metadata"`
+	// Metadata contains the information extracted from the image file (e.g. date taken, camera, location).
+	Metadata model.Metadata `json:"metadata"`
+	// YearsAgo is the number of years since the photo was taken, if it is shown as a memory of this day.
+	YearsAgo int `json:"yearsAgo,omitempty"`
+	// MemoryLabel describes the memory for display, e.g. "3 years ago". Empty for images shown as no memory.
+	MemoryLabel string `json:"memoryLabel,omitempty"`
 }
 
-func (h *Handler) getCurrentImageData(context *gin.Context) {
-	fileName, err := h.calculateCurrentImage()
-	if err != nil {
-		context.AbortWithError(http.StatusInternalServerError, err)
-		return
+func (h *Handler) toImageRef(image model.Image) ImageRef {
+	ref := ImageRef{Id: image.Id, Path: image.Path, Type: image.Type, Metadata: image.Metadata}
+	ref.YearsAgo = h.display.YearsAgo(image)
+	switch {
+	case ref.YearsAgo == 1:
+		ref.MemoryLabel = "1 year ago"
+	case ref.YearsAgo > 1:
+		ref.MemoryLabel = strconv.Itoa(ref.YearsAgo) + " years ago"
 	}
-
-	ref := ImageRef{Path: fileName, Type: model.ImageType}
-	context.JSON(http.StatusOK, ref)
+	return ref
 }
 
-func (h *Handler) calculateCurrentImage() (path string, err error) {
-	status, err := h.storage.GetCurrentStatus()
-	if err != nil {
-		ErrorLogger.Println("Cannot read current status")
-		return "", err
-	}
-	config, err := h.storage.GetConfiguration()
-	if err != nil {
-		ErrorLogger.Println("Cannot read configuration")
-		return "", err
-	}
-	var image model.Image
-	if time.Since(status.LastSwitch).Seconds() > float64(config.ImageDuration) {
-		image, err = h.storage.LoadNextImage(status.CurrentImageId)
-		if err == nil {
-			// Update status with new image ID
-			err = h.storage.UpdateImageStatus(image.Id)
-		}
-	} else {
-		image, err = h.storage.LoadImage(status.CurrentImageId)
-	}
+func (h *Handler) getCurrentImageData(context *gin.Context) {
+	image, err := h.display.CurrentImage()
 	if err != nil {
 		ErrorLogger.Println("Cannot read Image")
-		return "", err
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
 	}
-	return image.Path, err
+	context.JSON(http.StatusOK, h.toImageRef(image))
 }
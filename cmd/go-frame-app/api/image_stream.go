@@ -0,0 +1,35 @@
+package api
+
+import (
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const keepAliveInterval = 15 * time.Second
+
+func (h *Handler) streamImages(context *gin.Context) {
+	updates := h.events.subscribe()
+	defer h.events.unsubscribe(updates)
+
+	if image, err := h.display.CurrentImage(); err == nil {
+		context.SSEvent("image", h.toImageRef(image))
+		context.Writer.Flush()
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	context.Stream(func(w io.Writer) bool {
+		select {
+		case ref := <-updates:
+			context.SSEvent("image", ref)
+			return true
+		case <-keepAlive.C:
+			_, err := w.Write([]byte(": keepalive\n\n"))
+			return err == nil
+		case <-context.Request.Context().Done():
+			return false
+		}
+	})
+}
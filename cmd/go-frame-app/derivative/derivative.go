@@ -0,0 +1,389 @@
+package derivative
+
+import (
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/metadata"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	WarningLogger *log.Logger
+	InfoLogger    *log.Logger
+	ErrorLogger   *log.Logger
+)
+
+func init() {
+	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	WarningLogger = log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+}
+
+// CacheDir is the default directory where derivatives are cached on disk.
+const CacheDir = "cache/derivatives"
+
+// uprightDir is the cache subdirectory holding the full size upright derivatives.
+const uprightDir = "upright"
+
+// DefaultWidths are the default widths of the resized derivatives in pixels.
+var DefaultWidths = []int{320, 640, 1280, 1920, 2560, 3840}
+
+// DefaultMaxPixels is the default limit of the pixel count of originals decoded for a derivative.
+// Decoded, an image takes four bytes per pixel.
+const DefaultMaxPixels = 50_000_000
+
+// ErrTooLarge is returned if an original exceeds the pixel limit. Such originals are served as they are.
+var ErrTooLarge = errors.New("Image exceeds the pixel limit")
+
+// Options configures the derivative cache. Zero values use the defaults.
+type Options struct {
+	// CacheDir is the directory holding the derivatives.
+	CacheDir string
+	// Widths are the widths of the resized derivatives in ascending order.
+	// Requested widths are rounded up to the next configured width.
+	Widths []int
+	// MaxPixels is the largest pixel count of an original decoded for a derivative.
+	MaxPixels int64
+}
+
+// Cache creates derivatives of the original images and caches them on disk.
+// Derivatives are upright according to the EXIF orientation and optionally resized, the original files stay untouched.
+type Cache struct {
+	root      string
+	cacheDir  string
+	widths    []int
+	maxPixels int64
+	mu        sync.Mutex
+	targets   map[string]*targetLock
+	sources   map[string]source
+}
+
+// source is the metadata of an original, kept until the original is modified.
+type source struct {
+	modTime time.Time
+	size    int64
+	meta    model.Metadata
+	err     error
+}
+
+// targetLock serializes the creation of one derivative. It is dropped once nobody waits for it.
+type targetLock struct {
+	sync.Mutex
+	waiting int
+}
+
+// NewCache creates a new derivative cache for the images in the given directory.
+//
+// Parameters:
+//   - root: The local directory holding the original images.
+//   - options: The cache configuration.
+//
+// Returns:
+//   - *Cache: The derivative cache.
+func NewCache(root string, options Options) *Cache {
+	if options.CacheDir == "" {
+		options.CacheDir = CacheDir
+	}
+	if len(options.Widths) == 0 {
+		options.Widths = DefaultWidths
+	}
+	if options.MaxPixels <= 0 {
+		options.MaxPixels = DefaultMaxPixels
+	}
+	return &Cache{
+		root:      root,
+		cacheDir:  options.CacheDir,
+		widths:    options.Widths,
+		maxPixels: options.MaxPixels,
+		targets:   map[string]*targetLock{},
+		sources:   map[string]source{},
+	}
+}
+
+// Serve returns a middleware handler serving derivatives of the images below the URL prefix.
+// The optional query parameter w requests a resized JPEG of the given width, or a PNG for images with transparency. Images with an EXIF orientation
+// other than normal are served upright. All other requests are passed on, so the originals are served by
+// the following handlers.
+//
+// Parameters:
+//   - urlPrefix: The URL prefix of the images.
+//
+// Returns:
+//   - gin.HandlerFunc: The middleware handler.
+func (c *Cache) Serve(urlPrefix string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if context.Request.Method != "GET" && context.Request.Method != "HEAD" {
+			return
+		}
+		name, found := strings.CutPrefix(context.Request.URL.Path, urlPrefix+"/")
+		if !found {
+			return
+		}
+		width := 0
+		if requested := context.Query("w"); requested != "" {
+			var err error
+			width, err = strconv.Atoi(requested)
+			if err != nil || width <= 0 {
+				context.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+		}
+		derived, err := c.derive(name, width)
+		if err != nil {
+			WarningLogger.Println("Cannot create derivative of", name, ":", err)
+			return
+		}
+		if derived != "" {
+			context.File(derived)
+			context.Abort()
+		}
+	}
+}
+
+// Remove deletes all cached derivatives of the image with the given name.
+//
+// Parameters:
+//   - name: The filename of the original image.
+func (c *Cache) Remove(name string) {
+	name = cleanName(name)
+	if name == "" {
+		return
+	}
+	c.mu.Lock()
+	delete(c.sources, name)
+	c.mu.Unlock()
+	unlock := c.lock(c.uprightPath(name))
+	os.Remove(c.uprightPath(name))
+	unlock()
+	for _, width := range c.widths {
+		unlock := c.lock(c.resizedPath(name, width, "jpeg"))
+		os.Remove(c.resizedPath(name, width, "jpeg"))
+		os.Remove(c.resizedPath(name, width, "png"))
+		unlock()
+	}
+}
+
+// derive returns the path of the derivative of the image with the given name and requested width.
+// An empty path is returned if the original can be served as is.
+func (c *Cache) derive(name string, requestedWidth int) (string, error) {
+	name = cleanName(name)
+	if name == "" {
+		return "", nil
+	}
+	sourcePath := filepath.Join(c.root, filepath.FromSlash(name))
+	sourceInfo, err := os.Stat(sourcePath)
+	if err != nil || sourceInfo.IsDir() {
+		return "", nil
+	}
+	meta, err := c.inspect(name, sourcePath, sourceInfo)
+	if err != nil {
+		return "", nil
+	}
+
+	width := 0
+	if requestedWidth > 0 {
+		width = c.snapWidth(requestedWidth)
+		uprightWidth := meta.Width
+		if needsOrientation(meta.Orientation) && meta.Orientation >= orientationTranspose {
+			uprightWidth = meta.Height
+		}
+		// Never scale up, larger requests get the full size image
+		if uprightWidth > 0 && uprightWidth <= width {
+			width = 0
+		}
+	}
+	// The format of a resized derivative is only known once the image is decoded, so both formats are looked up
+	var candidates []string
+	switch {
+	case width > 0:
+		candidates = []string{c.resizedPath(name, width, "jpeg"), c.resizedPath(name, width, "png")}
+	case needsOrientation(meta.Orientation):
+		candidates = []string{c.uprightPath(name)}
+	default:
+		return "", nil
+	}
+
+	// Only requests of the same derivative wait for each other, other images are derived in parallel
+	unlock := c.lock(candidates[0])
+	defer unlock()
+	for _, candidate := range candidates {
+		if targetInfo, err := os.Stat(candidate); err == nil && !targetInfo.ModTime().Before(sourceInfo.ModTime()) {
+			return candidate, nil
+		}
+	}
+	InfoLogger.Println("Creating derivative of", name, "with width", width)
+	derived, format, err := render(sourcePath, meta.Orientation, width, c.maxPixels)
+	if err != nil {
+		return "", err
+	}
+	target := candidates[0]
+	if width > 0 {
+		target = c.resizedPath(name, width, format)
+	}
+	if err := write(target, derived, format); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// inspect returns the metadata of the original. It is only read again once the original is modified,
+// so originals served as they are do not parse their EXIF data on every request.
+func (c *Cache) inspect(name string, sourcePath string, info os.FileInfo) (model.Metadata, error) {
+	c.mu.Lock()
+	cached, ok := c.sources[name]
+	c.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.meta, cached.err
+	}
+	// Failures are kept as well, e.g. for formats without metadata
+	meta, err := metadata.Extract(sourcePath)
+	c.mu.Lock()
+	c.sources[name] = source{modTime: info.ModTime(), size: info.Size(), meta: meta, err: err}
+	c.mu.Unlock()
+	return meta, err
+}
+
+// lock acquires the lock of the derivative at the given path and returns the function releasing it.
+func (c *Cache) lock(target string) func() {
+	c.mu.Lock()
+	held, ok := c.targets[target]
+	if !ok {
+		held = &targetLock{}
+		c.targets[target] = held
+	}
+	held.waiting++
+	c.mu.Unlock()
+
+	held.Lock()
+	return func() {
+		held.Unlock()
+		c.mu.Lock()
+		held.waiting--
+		if held.waiting == 0 {
+			delete(c.targets, target)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// snapWidth rounds the requested width up to the next configured width.
+func (c *Cache) snapWidth(requested int) int {
+	for _, width := range c.widths {
+		if width >= requested {
+			return width
+		}
+	}
+	return c.widths[len(c.widths)-1]
+}
+
+func (c *Cache) uprightPath(name string) string {
+	return filepath.Join(c.cacheDir, uprightDir, filepath.FromSlash(name))
+}
+
+func (c *Cache) resizedPath(name string, width int, format string) string {
+	suffix := ".jpg"
+	if format == "png" {
+		suffix = ".png"
+	}
+	return filepath.Join(c.cacheDir, "w"+strconv.Itoa(width), filepath.FromSlash(name)+suffix)
+}
+
+// cleanName resolves the name relative to the image directory, so it cannot point outside of it.
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// render decodes the original and turns it upright. A width of zero keeps the size and the format of the original,
+// resized images are JPEGs, unless they have transparency, which is kept in a PNG.
+// Originals with more than maxPixels pixels are rejected with ErrTooLarge before they are decoded.
+func render(source string, orientation int, width int, maxPixels int64) (image.Image, string, error) {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return nil, "", err
+	}
+	defer sourceFile.Close()
+	config, _, err := image.DecodeConfig(sourceFile)
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, "", ErrTooLarge
+	}
+	if _, err := sourceFile.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+	decoded, format, err := image.Decode(sourceFile)
+	if err != nil {
+		return nil, "", err
+	}
+	derived := upright(decoded, orientation)
+	if width > 0 {
+		if width < derived.Bounds().Dx() {
+			derived = resize(derived, width)
+		}
+		format = "jpeg"
+		if hasAlpha(derived) {
+			format = "png"
+		}
+	}
+	return derived, format, nil
+}
+
+// hasAlpha reports whether the image has pixels that are not fully opaque.
+func hasAlpha(img image.Image) bool {
+	opaque, ok := img.(interface{ Opaque() bool })
+	return ok && !opaque.Opaque()
+}
+
+// write writes the derivative to a temporary file first, so a cached derivative is always complete.
+func write(target string, derived image.Image, format string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(target), "derivative-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	err = encode(temp, derived, format)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), target)
+}
+
+// resize scales the image to the given width, keeping the aspect ratio.
+func resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+func encode(file *os.File, img image.Image, format string) error {
+	if format == "jpeg" {
+		return jpeg.Encode(file, img, &jpeg.Options{Quality: 90})
+	}
+	return png.Encode(file, img)
+}
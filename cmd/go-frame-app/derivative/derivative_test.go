@@ -0,0 +1,337 @@
+package derivative
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/static"
+)
+
+var (
+	red  = color.NRGBA{R: 255, A: 255}
+	blue = color.NRGBA{B: 255, A: 255}
+)
+
+// redBlue returns a 2x1 image with a red pixel left of a blue one.
+func redBlue() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+	return img
+}
+
+func TestUpright(t *testing.T) {
+	tests := []struct {
+		orientation int
+		width       int
+		height      int
+		red         image.Point
+	}{
+		{orientationNormal, 2, 1, image.Pt(0, 0)},
+		{orientationFlipH, 2, 1, image.Pt(1, 0)},
+		{orientationRotate180, 2, 1, image.Pt(1, 0)},
+		{orientationFlipV, 2, 1, image.Pt(0, 0)},
+		{orientationTranspose, 1, 2, image.Pt(0, 0)},
+		{orientationRotate90, 1, 2, image.Pt(0, 0)},
+		{orientationTransverse, 1, 2, image.Pt(0, 1)},
+		{orientationRotate270, 1, 2, image.Pt(0, 1)},
+	}
+	for _, test := range tests {
+		result := upright(redBlue(), test.orientation)
+		bounds := result.Bounds()
+		if bounds.Dx() != test.width || bounds.Dy() != test.height {
+			t.Errorf("Orientation %d: expected %dx%d, got %dx%d", test.orientation, test.width, test.height, bounds.Dx(), bounds.Dy())
+			continue
+		}
+		if result.At(test.red.X, test.red.Y) != color.Color(red) {
+			t.Errorf("Orientation %d: expected red at %v", test.orientation, test.red)
+		}
+	}
+}
+
+// jpegWithOrientation encodes the image as JPEG with an EXIF segment holding only the orientation.
+func jpegWithOrientation(t *testing.T, img image.Image, orientation uint16) []byte {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, buffer.Bytes()[2:]...)
+}
+
+func setupRouter(t *testing.T) (*gin.Engine, string, string) {
+	r, root, cacheDir, _ := setupCache(t)
+	return r, root, cacheDir
+}
+
+func setupCache(t *testing.T) (*gin.Engine, string, string, *Cache) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+	cache := NewCache(root, Options{CacheDir: cacheDir, Widths: []int{8, 16}})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(cache.Serve("/static/images"))
+	r.Use(static.ServeRoot("/static/images", root))
+	return r, root, cacheDir, cache
+}
+
+func TestServeUpright(t *testing.T) {
+	r, root, cacheDir := setupRouter(t)
+	original := jpegWithOrientation(t, image.NewNRGBA(image.Rect(0, 0, 32, 16)), orientationRotate90)
+	os.WriteFile(filepath.Join(root, "photo.jpg"), original, 0644)
+
+	req, _ := http.NewRequest("GET", "/static/images/photo.jpg", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	served, err := jpeg.DecodeConfig(w.Body)
+	if err != nil {
+		t.Fatalf("Expected JPEG: %v", err)
+	}
+	if served.Width != 16 || served.Height != 32 {
+		t.Errorf("Expected upright 16x32, got %dx%d", served.Width, served.Height)
+	}
+
+	// The original stays untouched, the derivative is cached
+	if stored, _ := os.ReadFile(filepath.Join(root, "photo.jpg")); !bytes.Equal(stored, original) {
+		t.Error("Original file was modified")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "upright", "photo.jpg")); err != nil {
+		t.Errorf("Expected cached derivative: %v", err)
+	}
+}
+
+func TestServeNormalOrientation(t *testing.T) {
+	r, root, cacheDir := setupRouter(t)
+	original := jpegWithOrientation(t, image.NewNRGBA(image.Rect(0, 0, 32, 16)), orientationNormal)
+	os.WriteFile(filepath.Join(root, "photo.jpg"), original, 0644)
+	var plain bytes.Buffer
+	png.Encode(&plain, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	os.WriteFile(filepath.Join(root, "plain.png"), plain.Bytes(), 0644)
+
+	for name, content := range map[string][]byte{"photo.jpg": original, "plain.png": plain.Bytes()} {
+		req, _ := http.NewRequest("GET", "/static/images/"+name, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+			t.Errorf("Expected original %s to be served, got %d", name, w.Code)
+		}
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 0 {
+		t.Errorf("Expected no derivatives, got %d", len(entries))
+	}
+}
+
+func TestServeRejectsTraversal(t *testing.T) {
+	r, _, _ := setupRouter(t)
+	req, _ := http.NewRequest("GET", "/static/images/../../etc/passwd", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Error("Expected files outside the image directory not to be served")
+	}
+}
+
+func TestServeResized(t *testing.T) {
+	r, root, cacheDir, cache := setupCache(t)
+	var original bytes.Buffer
+	png.Encode(&original, image.NewGray(image.Rect(0, 0, 32, 16)))
+	os.WriteFile(filepath.Join(root, "photo.png"), original.Bytes(), 0644)
+
+	tests := []struct {
+		query  string
+		width  int
+		height int
+	}{
+		// Requested widths are rounded up to the next configured width
+		{"?w=5", 8, 4},
+		{"?w=16", 16, 8},
+		// Larger widths than configured get the largest derivative
+		{"?w=20", 16, 8},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/static/images/photo.png"+test.query, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		config, err := jpeg.DecodeConfig(w.Body)
+		if err != nil {
+			t.Errorf("%s: expected JPEG: %v", test.query, err)
+			continue
+		}
+		if config.Width != test.width || config.Height != test.height {
+			t.Errorf("%s: expected %dx%d, got %dx%d", test.query, test.width, test.height, config.Width, config.Height)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "w8", "photo.png.jpg")); err != nil {
+		t.Errorf("Expected cached derivative: %v", err)
+	}
+
+	// Removing the original removes all derivatives
+	cache.Remove("photo.png")
+	for _, dir := range []string{"w8", "w16"} {
+		if _, err := os.Stat(filepath.Join(cacheDir, dir, "photo.png.jpg")); !os.IsNotExist(err) {
+			t.Errorf("Expected derivative in %s to be removed", dir)
+		}
+	}
+}
+
+func TestServeResizedKeepsTransparency(t *testing.T) {
+	r, root, cacheDir, cache := setupCache(t)
+	transparent := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+	transparent.Set(0, 0, red)
+	var original bytes.Buffer
+	png.Encode(&original, transparent)
+	os.WriteFile(filepath.Join(root, "logo.png"), original.Bytes(), 0644)
+
+	req, _ := http.NewRequest("GET", "/static/images/logo.png?w=8", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	resized, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Expected PNG: %v", err)
+	}
+	if resized.Bounds().Dx() != 8 {
+		t.Errorf("Expected width 8, got %d", resized.Bounds().Dx())
+	}
+	if _, _, _, alpha := resized.At(7, 7).RGBA(); alpha != 0 {
+		t.Errorf("Expected a transparent pixel, got alpha %d", alpha)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "image/png" {
+		t.Errorf("Expected image/png, got %s", contentType)
+	}
+
+	cache.Remove("logo.png")
+	if _, err := os.Stat(filepath.Join(cacheDir, "w8", "logo.png.png")); !os.IsNotExist(err) {
+		t.Error("Expected the derivative to be removed")
+	}
+}
+
+func TestServeResizedConcurrently(t *testing.T) {
+	r, root, _, _ := setupCache(t)
+	original := jpegWithOrientation(t, image.NewNRGBA(image.Rect(0, 0, 32, 16)), orientationRotate90)
+	os.WriteFile(filepath.Join(root, "photo.jpg"), original, 0644)
+
+	// Requests of the same derivative wait for each other, requests of other derivatives do not
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		query := []string{"?w=8", "?w=16"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/static/images/photo.jpg"+query, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if _, err := jpeg.DecodeConfig(w.Body); w.Code != http.StatusOK || err != nil {
+				t.Errorf("%s: expected JPEG, got %d: %v", query, w.Code, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestServeResizedNeverScalesUp(t *testing.T) {
+	r, root, _, _ := setupCache(t)
+	original := jpegWithOrientation(t, image.NewNRGBA(image.Rect(0, 0, 4, 12)), orientationRotate90)
+	os.WriteFile(filepath.Join(root, "photo.jpg"), original, 0644)
+
+	// The upright image is 12 wide, so a resize to 16 serves the full size upright image
+	req, _ := http.NewRequest("GET", "/static/images/photo.jpg?w=16", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	config, err := jpeg.DecodeConfig(w.Body)
+	if err != nil {
+		t.Fatalf("Expected JPEG: %v", err)
+	}
+	if config.Width != 12 || config.Height != 4 {
+		t.Errorf("Expected upright 12x4, got %dx%d", config.Width, config.Height)
+	}
+
+	// Rotated images are resized after being turned upright
+	req, _ = http.NewRequest("GET", "/static/images/photo.jpg?w=8", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	config, _ = jpeg.DecodeConfig(w.Body)
+	if config.Width != 8 {
+		t.Errorf("Expected width 8, got %d", config.Width)
+	}
+}
+
+func TestServeInvalidWidth(t *testing.T) {
+	r, _, _ := setupRouter(t)
+	req, _ := http.NewRequest("GET", "/static/images/photo.jpg?w=abc", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
+
+func TestServeKeepsMetadataUntilModified(t *testing.T) {
+	r, root, _, cache := setupCache(t)
+	os.WriteFile(filepath.Join(root, "photo.jpg"), jpegWithOrientation(t, image.NewNRGBA(image.Rect(0, 0, 32, 16)), orientationNormal), 0644)
+	serve := func() image.Config {
+		req, _ := http.NewRequest("GET", "/static/images/photo.jpg", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		config, _ := jpeg.DecodeConfig(w.Body)
+		return config
+	}
+
+	if config := serve(); config.Width != 32 || len(cache.sources) != 1 {
+		t.Errorf("Expected the original with its metadata kept, got %dx%d and %d entries", config.Width, config.Height, len(cache.sources))
+	}
+	// A modified original is inspected again
+	os.WriteFile(filepath.Join(root, "photo.jpg"), jpegWithOrientation(t, image.NewNRGBA(image.Rect(0, 0, 30, 16)), orientationRotate90), 0644)
+	if config := serve(); config.Width != 16 || config.Height != 30 {
+		t.Errorf("Expected upright 16x30, got %dx%d", config.Width, config.Height)
+	}
+	cache.Remove("photo.jpg")
+	if len(cache.sources) != 0 {
+		t.Errorf("Expected the metadata to be dropped, got %d entries", len(cache.sources))
+	}
+}
+
+func TestServeOversizedOriginal(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+	cache := NewCache(root, Options{CacheDir: cacheDir, Widths: []int{8, 16}, MaxPixels: 100})
+	r := gin.New()
+	r.Use(cache.Serve("/static/images"))
+	r.Use(static.ServeRoot("/static/images", root))
+	original := jpegWithOrientation(t, image.NewNRGBA(image.Rect(0, 0, 32, 16)), orientationRotate90)
+	os.WriteFile(filepath.Join(root, "photo.jpg"), original, 0644)
+
+	// Originals above the pixel limit are not decoded, but served as they are
+	req, _ := http.NewRequest("GET", "/static/images/photo.jpg?w=8", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), original) {
+		t.Errorf("Expected the original, got %d", w.Code)
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 0 {
+		t.Errorf("Expected no derivatives, got %d", len(entries))
+	}
+	if _, _, err := render(filepath.Join(root, "photo.jpg"), orientationRotate90, 8, 100); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+}
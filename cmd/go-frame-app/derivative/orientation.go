@@ -0,0 +1,68 @@
+package derivative
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Orientation values defined by EXIF.
+const (
+	orientationNormal     = 1
+	orientationFlipH      = 2
+	orientationRotate180  = 3
+	orientationFlipV      = 4
+	orientationTranspose  = 5
+	orientationRotate90   = 6
+	orientationTransverse = 7
+	orientationRotate270  = 8
+)
+
+// needsOrientation reports whether an image with the given EXIF orientation must be transformed to be upright.
+func needsOrientation(orientation int) bool {
+	return orientation > orientationNormal && orientation <= orientationRotate270
+}
+
+// upright rotates and flips the image according to its EXIF orientation.
+func upright(src image.Image, orientation int) image.Image {
+	if !needsOrientation(orientation) {
+		return src
+	}
+	bounds := src.Bounds()
+	source := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(source, source.Bounds(), src, bounds.Min, draw.Src)
+
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= orientationTranspose {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := transform(x, y, width, height, orientation)
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], source.Pix[source.PixOffset(x, y):source.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+// transform maps a pixel of the stored image to its position in the upright image.
+func transform(x, y, width, height, orientation int) (int, int) {
+	switch orientation {
+	case orientationFlipH:
+		return width - 1 - x, y
+	case orientationRotate180:
+		return width - 1 - x, height - 1 - y
+	case orientationFlipV:
+		return x, height - 1 - y
+	case orientationTranspose:
+		return y, x
+	case orientationRotate90:
+		return height - 1 - y, x
+	case orientationTransverse:
+		return height - 1 - y, width - 1 - x
+	case orientationRotate270:
+		return y, width - 1 - x
+	}
+	return x, y
+}
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"github.com/gin-gonic/gin"
 	adminapi "go.evodicka.dev/go-frame/cmd/go-frame-app/admin-api"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/api"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/derivative"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/remote"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/rotation"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/static"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/trash"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/upload"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/watcher"
 )
 
 var (
@@ -30,7 +38,11 @@ func main() {
 	router := gin.Default()
 	apiEndpoint := router.Group("/api")
 	adminEndpoint := router.Group("/admin/api")
-	router.Use(static.ServeRoot("/static/images", "images"))
+	uploadEndpoint := router.Group("/admin/api/uploads")
+	remoteEndpoint := router.Group("/static/remote")
+	derivatives := derivative.NewCache(persistence.ImageDir, derivative.Options{})
+	router.Use(derivatives.Serve("/static/images"))
+	router.Use(static.ServeRoot("/static/images", persistence.ImageDir))
 	router.Use(static.Serve("/", EmbeddedWebViewFileSystem("web-view")))
 
 	storage, err := persistence.NewStorage("my.db")
@@ -38,12 +50,39 @@ func main() {
 		ErrorLogger.Fatal(err)
 	}
 	defer storage.Close()
+	storage.OnImageRemoved(func(image model.Image) {
+		derivatives.Remove(image.Path)
+	})
+	// Files may have been added or removed by hand while the frame was down
+	if report, err := storage.Reconcile(); err != nil {
+		ErrorLogger.Println("Cannot reconcile image library:", err)
+	} else if report.Changed() {
+		InfoLogger.Printf("Reconciled image library: %d imported, %d removed", len(report.Imported), len(report.Removed))
+	}
 
-	apiHandler := api.NewHandler(storage)
-	adminHandler := adminapi.NewHandler(storage)
+	engine := rotation.NewEngine(storage, rotation.SystemClock)
+	apiHandler := api.NewHandler(engine)
+	adminHandler := adminapi.NewHandler(storage, engine)
+	remoteHandler := remote.NewHandler(storage, remote.Options{})
+	storage.OnImageRemoved(remoteHandler.Remove)
+	uploadHandler := upload.NewHandler(storage, engine, upload.Options{})
+	libraryWatcher := watcher.NewWatcher(storage, engine, watcher.Options{})
+	trashCleaner := trash.NewCleaner(storage)
 
 	apiHandler.RegisterApiEndpoint(apiEndpoint)
 	adminHandler.RegisterApiEndpoint(adminEndpoint)
+	remoteHandler.RegisterApiEndpoint(remoteEndpoint)
+	uploadHandler.RegisterApiEndpoint(uploadEndpoint)
+
+	InfoLogger.Println("Starting image rotation")
+	go engine.Run(context.Background())
+	go uploadHandler.Run(context.Background())
+	go trashCleaner.Run(context.Background())
+	go func() {
+		if err := libraryWatcher.Run(context.Background()); err != nil {
+			ErrorLogger.Println("Cannot watch image directory:", err)
+		}
+	}()
 
 	router.Run(":8080")
 }
@@ -0,0 +1,206 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// EXIF tags read from the image file directory (IFD0), the EXIF sub IFD and the GPS sub IFD.
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIfd          = 0x8769
+	tagGpsIfd           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagOffsetOriginal   = 0x9011
+	tagPixelXDimension  = 0xA002
+	tagPixelYDimension  = 0xA003
+	tagLatitudeRef      = 0x0001
+	tagLatitude         = 0x0002
+	tagLongitudeRef     = 0x0003
+	tagLongitude        = 0x0004
+)
+
+// typeSizes maps the TIFF field types to the size of a single value in bytes.
+var typeSizes = map[uint16]uint32{
+	1:  1, // BYTE
+	2:  1, // ASCII
+	3:  2, // SHORT
+	4:  4, // LONG
+	5:  8, // RATIONAL
+	7:  1, // UNDEFINED
+	9:  4, // SLONG
+	10: 8, // SRATIONAL
+}
+
+var errInvalidExif = errors.New("Invalid EXIF data")
+
+// tiff reads the directories of a TIFF structure, which is how EXIF data is encoded.
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type field struct {
+	kind  uint16
+	count uint32
+	value []byte
+}
+
+// parseExif reads the supported tags from the TIFF structure in data into meta.
+// Dimensions are only taken from EXIF if the container did not provide them.
+func parseExif(data []byte, meta *model.Metadata) error {
+	if len(data) < 8 {
+		return errInvalidExif
+	}
+	t := tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return errInvalidExif
+	}
+	if t.order.Uint16(data[2:4]) != 42 {
+		return errInvalidExif
+	}
+
+	ifd0, err := t.readIfd(t.order.Uint32(data[4:8]))
+	if err != nil {
+		return err
+	}
+	meta.CameraMake = t.ascii(ifd0[tagMake])
+	meta.CameraModel = t.ascii(ifd0[tagModel])
+	if orientation, ok := t.uint(ifd0[tagOrientation]); ok && orientation >= 1 && orientation <= 8 {
+		meta.Orientation = int(orientation)
+	}
+	takenAt := parseTime(t.ascii(ifd0[tagDateTime]), "")
+
+	if offset, ok := t.uint(ifd0[tagExifIfd]); ok {
+		exif, err := t.readIfd(offset)
+		if err != nil {
+			return err
+		}
+		if original := parseTime(t.ascii(exif[tagDateTimeOriginal]), t.ascii(exif[tagOffsetOriginal])); !original.IsZero() {
+			takenAt = original
+		}
+		width, widthOk := t.uint(exif[tagPixelXDimension])
+		height, heightOk := t.uint(exif[tagPixelYDimension])
+		if meta.Width == 0 && widthOk && heightOk {
+			meta.Width = int(width)
+			meta.Height = int(height)
+		}
+	}
+	meta.TakenAt = takenAt
+
+	if offset, ok := t.uint(ifd0[tagGpsIfd]); ok {
+		gps, err := t.readIfd(offset)
+		if err != nil {
+			return err
+		}
+		latitude, latitudeOk := t.degrees(gps[tagLatitude], t.ascii(gps[tagLatitudeRef]), "S")
+		longitude, longitudeOk := t.degrees(gps[tagLongitude], t.ascii(gps[tagLongitudeRef]), "W")
+		if latitudeOk && longitudeOk {
+			meta.Location = &model.Location{Latitude: latitude, Longitude: longitude}
+		}
+	}
+	return nil
+}
+
+// readIfd reads all fields of the image file directory at the given offset.
+func (t tiff) readIfd(offset uint32) (map[uint16]field, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, errInvalidExif
+	}
+	count := uint64(t.order.Uint16(t.data[offset:]))
+	start := uint64(offset) + 2
+	if start+count*12 > uint64(len(t.data)) {
+		return nil, errInvalidExif
+	}
+	fields := make(map[uint16]field, count)
+	for i := uint64(0); i < count; i++ {
+		entry := t.data[start+i*12 : start+i*12+12]
+		kind := t.order.Uint16(entry[2:4])
+		valueCount := t.order.Uint32(entry[4:8])
+		typeSize, known := typeSizes[kind]
+		if !known {
+			continue
+		}
+		size := uint64(typeSize) * uint64(valueCount)
+		// Values up to four bytes are stored inline, larger ones at an offset
+		var value []byte
+		if size <= 4 {
+			value = entry[8 : 8+size]
+		} else {
+			valueOffset := uint64(t.order.Uint32(entry[8:12]))
+			if valueOffset+size > uint64(len(t.data)) {
+				continue
+			}
+			value = t.data[valueOffset : valueOffset+size]
+		}
+		fields[t.order.Uint16(entry[0:2])] = field{kind: kind, count: valueCount, value: value}
+	}
+	return fields, nil
+}
+
+func (t tiff) ascii(f field) string {
+	if f.kind != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(f.value), "\x00"))
+}
+
+func (t tiff) uint(f field) (uint32, bool) {
+	switch {
+	case f.kind == 3 && f.count > 0:
+		return uint32(t.order.Uint16(f.value)), true
+	case f.kind == 4 && f.count > 0:
+		return t.order.Uint32(f.value), true
+	}
+	return 0, false
+}
+
+// degrees converts a GPS coordinate of degrees, minutes and seconds into decimal degrees.
+func (t tiff) degrees(f field, ref string, negativeRef string) (float64, bool) {
+	if f.kind != 5 || f.count != 3 {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		numerator := t.order.Uint32(f.value[i*8:])
+		denominator := t.order.Uint32(f.value[i*8+4:])
+		if denominator == 0 {
+			return 0, false
+		}
+		parts[i] = float64(numerator) / float64(denominator)
+	}
+	degrees := parts[0] + parts[1]/60 + parts[2]/3600
+	if ref == negativeRef {
+		degrees = -degrees
+	}
+	return degrees, true
+}
+
+// parseTime parses an EXIF date. Without offset, the wall clock time is returned as UTC.
+func parseTime(value string, offset string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	if offset != "" {
+		if parsed, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset); err == nil {
+			return parsed
+		}
+	}
+	parsed, err := time.Parse("2006:01:02 15:04:05", value)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed
+}
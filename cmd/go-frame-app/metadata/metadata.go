@@ -0,0 +1,271 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// ErrUnsupportedFormat is returned for files that are neither JPEG, PNG nor WebP.
+var ErrUnsupportedFormat = errors.New("Unsupported image format")
+
+// maxChunkSize limits the size of a header chunk read into memory.
+const maxChunkSize = 16 << 20
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader    = []byte("Exif\x00\x00")
+)
+
+// Extract reads the metadata of the image file at the given path.
+//
+// Parameters:
+//   - path: The path of a JPEG, PNG or WebP file.
+//
+// Returns:
+//   - Metadata: The extracted metadata. Malformed files still return everything read up to the error.
+//   - error: An error if the file cannot be read or the format is not supported.
+func Extract(path string) (model.Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return model.Metadata{}, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// Read reads the metadata of a JPEG, PNG or WebP image.
+//
+// Parameters:
+//   - r: The reader providing the image file.
+//
+// Returns:
+//   - Metadata: The extracted metadata. Malformed images still return everything read up to the error.
+//   - error: An error if the image cannot be read or the format is not supported.
+func Read(r io.Reader) (model.Metadata, error) {
+	var meta model.Metadata
+	reader := bufio.NewReader(r)
+	header, _ := reader.Peek(12)
+	var err error
+	switch {
+	case bytes.HasPrefix(header, jpegSignature):
+		err = readJpeg(reader, &meta)
+	case bytes.HasPrefix(header, pngSignature):
+		err = readPng(reader, &meta)
+	case len(header) == 12 && string(header[:4]) == "RIFF" && string(header[8:]) == "WEBP":
+		err = readWebp(reader, &meta)
+	default:
+		err = ErrUnsupportedFormat
+	}
+	return meta, err
+}
+
+// readJpeg walks the JPEG segments up to the image data, reading the EXIF segment and the frame header.
+func readJpeg(r *bufio.Reader, meta *model.Metadata) error {
+	if _, err := r.Discard(len(jpegSignature)); err != nil {
+		return err
+	}
+	for {
+		marker, err := readJpegMarker(r)
+		if err != nil {
+			return err
+		}
+		// Start of scan, no more headers follow
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		// Markers without payload
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return err
+		}
+		if length < 2 {
+			return errors.New("Invalid JPEG segment")
+		}
+		size := int(length) - 2
+		switch {
+		case marker == 0xE1:
+			segment := make([]byte, size)
+			if _, err := io.ReadFull(r, segment); err != nil {
+				return err
+			}
+			if bytes.HasPrefix(segment, exifHeader) {
+				if err := parseExif(segment[len(exifHeader):], meta); err != nil {
+					return err
+				}
+			}
+		case isStartOfFrame(marker):
+			frame := make([]byte, size)
+			if _, err := io.ReadFull(r, frame); err != nil {
+				return err
+			}
+			if len(frame) >= 5 {
+				meta.Height = int(binary.BigEndian.Uint16(frame[1:3]))
+				meta.Width = int(binary.BigEndian.Uint16(frame[3:5]))
+			}
+		default:
+			if _, err := r.Discard(size); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func readJpegMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, errors.New("Invalid JPEG marker")
+	}
+	// Markers may be preceded by any number of fill bytes
+	for b == 0xFF {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+func isStartOfFrame(marker byte) bool {
+	return marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC
+}
+
+// readPng walks the PNG chunks, reading the header and the eXIf chunk.
+func readPng(r *bufio.Reader, meta *model.Metadata) error {
+	if _, err := r.Discard(len(pngSignature)); err != nil {
+		return err
+	}
+	for {
+		var chunk struct {
+			Length uint32
+			Type   [4]byte
+		}
+		if err := binary.Read(r, binary.BigEndian, &chunk); err != nil {
+			return err
+		}
+		switch string(chunk.Type[:]) {
+		case "IHDR", "eXIf":
+			if chunk.Length > maxChunkSize {
+				return errors.New("PNG chunk too large")
+			}
+			data := make([]byte, chunk.Length)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return err
+			}
+			if string(chunk.Type[:]) == "eXIf" {
+				if err := parseExif(data, meta); err != nil {
+					return err
+				}
+			} else if len(data) >= 8 {
+				meta.Width = int(binary.BigEndian.Uint32(data[0:4]))
+				meta.Height = int(binary.BigEndian.Uint32(data[4:8]))
+			}
+		case "IEND":
+			return nil
+		default:
+			if _, err := r.Discard(int(chunk.Length)); err != nil {
+				return err
+			}
+		}
+		// Skip the CRC
+		if _, err := r.Discard(4); err != nil {
+			return err
+		}
+	}
+}
+
+// readWebp walks the RIFF chunks of a WebP file, reading the canvas size and the EXIF chunk.
+func readWebp(r *bufio.Reader, meta *model.Metadata) error {
+	var header struct {
+		Riff   [4]byte
+		Length uint32
+		Webp   [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+	// The chunks follow the WEBP signature within the RIFF payload. Sizes are kept in 64 bits, so lengths of up
+	// to 4 GiB cannot overflow on 32 bit platforms.
+	remaining := int64(header.Length) - 4
+	for remaining >= 8 {
+		var chunk struct {
+			Type   [4]byte
+			Length uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		// Chunks are padded to an even size
+		size := int64(chunk.Length) + int64(chunk.Length&1)
+		remaining -= 8 + size
+		if remaining < 0 {
+			return errors.New("WebP chunk exceeds the file")
+		}
+		// Only the headers of the bitstream chunks are needed
+		read := size
+		switch string(chunk.Type[:]) {
+		case "VP8 ", "VP8L":
+			read = min(size, 10)
+		case "VP8X", "EXIF":
+			if chunk.Length > maxChunkSize {
+				return errors.New("WebP chunk too large")
+			}
+		default:
+			read = 0
+		}
+		data := make([]byte, read)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if err := readWebpChunk(string(chunk.Type[:]), data[:min(read, int64(chunk.Length))], meta); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(io.Discard, r, size-read); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readWebpChunk(chunkType string, data []byte, meta *model.Metadata) error {
+	switch chunkType {
+	case "VP8X":
+		if len(data) >= 10 {
+			meta.Width = int(uint24(data[4:7])) + 1
+			meta.Height = int(uint24(data[7:10])) + 1
+		}
+	case "VP8 ":
+		// Simple lossy format, the frame header follows the start code
+		if meta.Width == 0 && len(data) >= 10 && bytes.Equal(data[3:6], []byte{0x9D, 0x01, 0x2A}) {
+			meta.Width = int(binary.LittleEndian.Uint16(data[6:8]) & 0x3FFF)
+			meta.Height = int(binary.LittleEndian.Uint16(data[8:10]) & 0x3FFF)
+		}
+	case "VP8L":
+		// Simple lossless format, 14 bit dimensions follow the signature
+		if meta.Width == 0 && len(data) >= 5 && data[0] == 0x2F {
+			bits := binary.LittleEndian.Uint32(data[1:5])
+			meta.Width = int(bits&0x3FFF) + 1
+			meta.Height = int(bits>>14&0x3FFF) + 1
+		}
+	case "EXIF":
+		return parseExif(bytes.TrimPrefix(data, exifHeader), meta)
+	}
+	return nil
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
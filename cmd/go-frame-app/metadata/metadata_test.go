@@ -0,0 +1,273 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+)
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type exifTag struct {
+	id    uint16
+	kind  uint16
+	count uint32
+	value []byte
+}
+
+func asciiTag(id uint16, value string) exifTag {
+	return exifTag{id: id, kind: 2, count: uint32(len(value) + 1), value: append([]byte(value), 0)}
+}
+
+func shortTag(order byteOrder, id uint16, value uint16) exifTag {
+	return exifTag{id: id, kind: 3, count: 1, value: order.AppendUint16(nil, value)}
+}
+
+func longTag(order byteOrder, id uint16, value uint32) exifTag {
+	return exifTag{id: id, kind: 4, count: 1, value: order.AppendUint32(nil, value)}
+}
+
+func rationalTag(order byteOrder, id uint16, values ...uint32) exifTag {
+	var value []byte
+	for _, v := range values {
+		value = order.AppendUint32(value, v)
+		value = order.AppendUint32(value, 1)
+	}
+	return exifTag{id: id, kind: 5, count: uint32(len(values)), value: value}
+}
+
+// buildTiff lays out IFD0 followed by the EXIF and GPS sub IFDs and a data area for large values.
+func buildTiff(order byteOrder, ifd0, exif, gps []exifTag) []byte {
+	ifdSize := func(tags []exifTag) int { return 2 + 12*len(tags) + 4 }
+	ifd0Size := ifdSize(ifd0) + 24
+	exifOffset := 8 + ifd0Size
+	gpsOffset := exifOffset + ifdSize(exif)
+	dataOffset := gpsOffset + ifdSize(gps)
+	ifd0 = append(ifd0, longTag(order, tagExifIfd, uint32(exifOffset)), longTag(order, tagGpsIfd, uint32(gpsOffset)))
+
+	out := []byte("II*\x00")
+	if order.String() == binary.BigEndian.String() {
+		out = []byte("MM\x00*")
+	}
+	out = order.AppendUint32(out, 8)
+	var data []byte
+	for _, tags := range [][]exifTag{ifd0, exif, gps} {
+		out = order.AppendUint16(out, uint16(len(tags)))
+		for _, tag := range tags {
+			out = order.AppendUint16(out, tag.id)
+			out = order.AppendUint16(out, tag.kind)
+			out = order.AppendUint32(out, tag.count)
+			if len(tag.value) <= 4 {
+				out = append(out, tag.value...)
+				out = append(out, make([]byte, 4-len(tag.value))...)
+			} else {
+				out = order.AppendUint32(out, uint32(dataOffset+len(data)))
+				data = append(data, tag.value...)
+			}
+		}
+		out = order.AppendUint32(out, 0)
+	}
+	return append(out, data...)
+}
+
+func sampleExif(order byteOrder) []byte {
+	return buildTiff(order,
+		[]exifTag{
+			asciiTag(tagMake, "Canon"),
+			asciiTag(tagModel, "EOS 5D"),
+			shortTag(order, tagOrientation, 6),
+			asciiTag(tagDateTime, "2022:01:01 00:00:00"),
+		},
+		[]exifTag{
+			asciiTag(tagDateTimeOriginal, "2021:07:14 16:30:00"),
+			asciiTag(tagOffsetOriginal, "+02:00"),
+			longTag(order, tagPixelXDimension, 4000),
+			longTag(order, tagPixelYDimension, 3000),
+		},
+		[]exifTag{
+			asciiTag(tagLatitudeRef, "N"),
+			rationalTag(order, tagLatitude, 48, 12, 36),
+			asciiTag(tagLongitudeRef, "W"),
+			rationalTag(order, tagLongitude, 16, 22, 12),
+		})
+}
+
+func encodeJpeg(t *testing.T) []byte {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 16, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func jpegWithExif(t *testing.T, tiffData []byte) []byte {
+	plain := encodeJpeg(t)
+	segment := append([]byte("Exif\x00\x00"), tiffData...)
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, plain[2:]...)
+}
+
+func pngWithExif(t *testing.T, tiffData []byte) []byte {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 16, 8))); err != nil {
+		t.Fatal(err)
+	}
+	plain := buffer.Bytes()
+	chunk := append([]byte("eXIf"), tiffData...)
+	out := append([]byte{}, plain[:len(plain)-12]...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(tiffData)))
+	out = append(out, chunk...)
+	out = binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(chunk))
+	return append(out, plain[len(plain)-12:]...)
+}
+
+func webpWithExif(tiffData []byte) []byte {
+	var body []byte
+	appendChunk := func(chunkType string, data []byte) {
+		body = append(body, chunkType...)
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(data)))
+		body = append(body, data...)
+		if len(data)%2 == 1 {
+			body = append(body, 0)
+		}
+	}
+	// Extended header with EXIF flag and a 640x480 canvas
+	appendChunk("VP8X", []byte{0x08, 0, 0, 0, 0x7F, 0x02, 0, 0xDF, 0x01, 0})
+	appendChunk("EXIF", append([]byte("Exif\x00\x00"), tiffData...))
+	out := []byte("RIFF")
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(body)+4))
+	out = append(out, "WEBP"...)
+	return append(out, body...)
+}
+
+func assertSample(t *testing.T, width int, height int, data []byte) {
+	t.Helper()
+	meta, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if meta.CameraMake != "Canon" || meta.CameraModel != "EOS 5D" {
+		t.Errorf("Expected Canon EOS 5D, got %q %q", meta.CameraMake, meta.CameraModel)
+	}
+	if meta.Orientation != 6 {
+		t.Errorf("Expected orientation 6, got %d", meta.Orientation)
+	}
+	expected := time.Date(2021, 7, 14, 14, 30, 0, 0, time.UTC)
+	if !meta.TakenAt.Equal(expected) {
+		t.Errorf("Expected taken at %v, got %v", expected, meta.TakenAt)
+	}
+	if meta.Width != width || meta.Height != height {
+		t.Errorf("Expected %dx%d, got %dx%d", width, height, meta.Width, meta.Height)
+	}
+	if meta.Location == nil {
+		t.Fatal("Expected location")
+	}
+	if math.Abs(meta.Location.Latitude-48.21) > 1e-9 || math.Abs(meta.Location.Longitude+16.37) > 1e-9 {
+		t.Errorf("Expected 48.21,-16.37, got %v,%v", meta.Location.Latitude, meta.Location.Longitude)
+	}
+}
+
+func TestReadJpeg(t *testing.T) {
+	// The frame header wins over the EXIF dimensions
+	assertSample(t, 16, 8, jpegWithExif(t, sampleExif(binary.BigEndian)))
+}
+
+func TestReadPng(t *testing.T) {
+	assertSample(t, 16, 8, pngWithExif(t, sampleExif(binary.LittleEndian)))
+}
+
+func TestReadWebp(t *testing.T) {
+	assertSample(t, 640, 480, webpWithExif(sampleExif(binary.LittleEndian)))
+}
+
+func TestReadWithoutExif(t *testing.T) {
+	meta, err := Read(bytes.NewReader(encodeJpeg(t)))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if meta.Width != 16 || meta.Height != 8 {
+		t.Errorf("Expected 16x8, got %dx%d", meta.Width, meta.Height)
+	}
+	if !meta.TakenAt.IsZero() || meta.CameraMake != "" || meta.Location != nil {
+		t.Errorf("Expected no EXIF data, got %+v", meta)
+	}
+}
+
+func TestReadWithoutOffset(t *testing.T) {
+	order := binary.LittleEndian
+	tiffData := buildTiff(order, nil, []exifTag{asciiTag(tagDateTimeOriginal, "2021:07:14 16:30:00")}, nil)
+	meta, err := Read(bytes.NewReader(jpegWithExif(t, tiffData)))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	// The wall clock time is kept
+	if expected := time.Date(2021, 7, 14, 16, 30, 0, 0, time.UTC); !meta.TakenAt.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, meta.TakenAt)
+	}
+}
+
+func TestReadWebpOversizedChunk(t *testing.T) {
+	for _, riffLength := range []uint32{32, 0xFFFFFFF0} {
+		data := []byte("RIFF")
+		data = binary.LittleEndian.AppendUint32(data, riffLength)
+		data = append(data, "WEBPVP8 "...)
+		data = binary.LittleEndian.AppendUint32(data, 0x80000000)
+		data = append(data, make([]byte, 20)...)
+		// Lengths beyond the RIFF payload or the file fail without allocating them
+		if _, err := Read(bytes.NewReader(data)); err == nil {
+			t.Errorf("Expected error for chunk length 0x80000000 in RIFF payload of %d bytes", riffLength)
+		}
+	}
+}
+
+func TestReadUnsupported(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte("GIF89a......"))); err != ErrUnsupportedFormat {
+		t.Errorf("Expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestReadMalformedExif(t *testing.T) {
+	valid := sampleExif(binary.LittleEndian)
+	for _, tiffData := range [][]byte{
+		[]byte("garbage"),
+		[]byte("II*\x00\xff\xff\xff\xff"),
+		valid[:20],
+	} {
+		if _, err := Read(bytes.NewReader(jpegWithExif(t, tiffData))); err == nil {
+			t.Errorf("Expected error for malformed EXIF %q", tiffData)
+		}
+	}
+	// Truncated files must not cause a panic
+	data := jpegWithExif(t, valid)
+	for i := range data {
+		Read(bytes.NewReader(data[:i]))
+	}
+}
+
+func TestDetectMimeType(t *testing.T) {
+	tests := map[string][]byte{
+		"image/jpeg":               encodeJpeg(t),
+		"image/png":                pngWithExif(t, sampleExif(binary.LittleEndian)),
+		"image/webp":               append(webpWithExif(sampleExif(binary.LittleEndian))[:12], "VP8 "...),
+		"image/gif":                []byte("GIF89a\x01\x00\x01\x00"),
+		"application/octet-stream": {0x00, 0x01, 0x02},
+		"text/plain":               []byte("not an image"),
+	}
+	for expected, data := range tests {
+		mimeType, err := DetectMimeType(bytes.NewReader(data))
+		if err != nil || mimeType != expected {
+			t.Errorf("Expected %s, got %s (%v)", expected, mimeType, err)
+		}
+	}
+}
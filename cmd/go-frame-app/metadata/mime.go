@@ -0,0 +1,43 @@
+package metadata
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+)
+
+// DetectMimeType detects the format of a file by sniffing its content, regardless of the file name.
+//
+// Parameters:
+//   - r: The reader providing the beginning of the file.
+//
+// Returns:
+//   - string: The MIME type without parameters, application/octet-stream if the format is unknown.
+//   - error: An error if the content cannot be read.
+func DetectMimeType(r io.Reader) (string, error) {
+	header := make([]byte, 512)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	mimeType, _, err := mime.ParseMediaType(http.DetectContentType(header[:n]))
+	return mimeType, err
+}
+
+// DetectFileMimeType detects the format of the file at the given path by sniffing its content.
+//
+// Parameters:
+//   - path: The path of the file.
+//
+// Returns:
+//   - string: The MIME type without parameters, application/octet-stream if the format is unknown.
+//   - error: An error if the file cannot be read.
+func DetectFileMimeType(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return DetectMimeType(file)
+}
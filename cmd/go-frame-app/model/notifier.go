@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// ChangeNotifier is informed whenever the image library changes in a way that affects the displayed image.
+type ChangeNotifier interface {
+	// NotifyChange signals that images were added, deleted or reordered, or that the configuration changed.
+	NotifyChange()
+}
+
+// Playback steers the image displayed by the frame.
+// A hold greater than zero keeps a manually selected image on screen for at least the given duration.
+type Playback interface {
+	ChangeNotifier
+	Next(hold time.Duration) (Image, error)
+	Previous(hold time.Duration) (Image, error)
+	Jump(id int, hold time.Duration) (Image, error)
+	Pause() error
+	Resume() error
+}
+
+// Display provides the image currently shown by the frame.
+type Display interface {
+	// CurrentImage returns the displayed image without advancing the rotation.
+	CurrentImage() (Image, error)
+	// OnChange registers a listener, called whenever the displayed image or the image library changes.
+	OnChange(listener func(image Image))
+	// YearsAgo returns how many years ago the image was taken, if the rotation shows it as a memory of this day.
+	// Zero for all other images.
+	YearsAgo(image Image) int
+}
@@ -1,17 +1,34 @@
 package model
 
+import (
+	"io"
+	"time"
+)
+
 type ImageStorage interface {
 	// Status Operations
 	GetCurrentStatus() (Status, error)
-	UpdateImageStatus(newId int) error
+	Transition(transition func(view RotationView, status *Status) error) error
+
+	RotationView
+}
 
+// RotationView gives read access to images and configuration while choosing the next image.
+type RotationView interface {
 	// Configuration Operations
 	GetConfiguration() (Config, error)
-	UpdateConfiguration(config Config) error
 
 	// Image Operations
 	LoadImage(id int) (Image, error)
+	RotationStorage
+}
+
+type RotationStorage interface {
+	// Image Operations
+	LoadImages() ([]Image, error)
 	LoadNextImage(id int) (Image, error)
+	LoadNextShuffledImage(id int) (Image, error)
+	LoadLastShown() (map[int]time.Time, error)
 }
 
 type ConfigurationAdminStorage interface {
@@ -23,12 +40,82 @@ type ConfigurationAdminStorage interface {
 type ImageAdminStorage interface {
 	// Image Operations
 	LoadImages() ([]Image, error)
+	LoadLibrary() ([]Image, error)
+	LoadImage(id int) (Image, error)
+	UpdateImage(image Image) error
 	ReorderImages(images []Image) error
 	DeleteImage(id int) error
 	SaveImageMetadata(name string) (Image, error)
+	ImportImage(name string, content io.Reader) (Image, error)
+	FindDuplicates() ([][]Image, error)
+	SaveUrlMetadata(url string, contentType Type) (Image, error)
+	Reconcile() (LibraryReport, error)
+}
+
+// UploadStorage imports the files completed by resumable uploads.
+type UploadStorage interface {
+	// Image Operations
+	ImportImage(name string, content io.Reader) (Image, error)
+}
+
+// AlbumStorage manages the albums, named and ordered collections of images.
+type AlbumStorage interface {
+	// Album Operations
+	LoadAlbums() ([]Album, error)
+	LoadAlbum(id int) (Album, error)
+	LoadAlbumImages(id int) ([]Image, error)
+	CreateAlbum(name string) (Album, error)
+	RenameAlbum(id int, name string) (Album, error)
+	DeleteAlbum(id int) error
+	SetAlbumImages(id int, imageIds []int) (Album, error)
+	ReorderAlbum(id int, imageIds []int) (Album, error)
+	AddToAlbum(id int, imageId int) (Album, error)
+	RemoveFromAlbum(id int, imageId int) (Album, error)
+	SetAlbumRules(id int, rules *AlbumRules) (Album, error)
+}
+
+// TagStorage manages the tags of the images.
+type TagStorage interface {
+	// Tag Operations
+	LoadTags() (map[string]int, error)
+	FindByTags(tags []string) ([]Image, error)
+	TagImages(ids []int, add []string, remove []string) ([]Image, error)
+}
+
+// TrashStorage gives access to deleted images until they are purged.
+type TrashStorage interface {
+	// Configuration Operations
+	GetConfiguration() (Config, error)
+
+	// Trash Operations
+	LoadTrash() ([]Image, error)
+	RestoreImage(id int) (Image, error)
+	PurgeImage(id int) error
+	PurgeTrash(before time.Time) ([]Image, error)
+}
+
+// LibraryStorage reconciles the database with the image directory.
+type LibraryStorage interface {
+	// Image Operations
+	Reconcile() (LibraryReport, error)
+}
+
+// RemoteStorage gives access to the remote items served through the caching proxy.
+type RemoteStorage interface {
+	// Image Operations
+	LoadImage(id int) (Image, error)
+}
+
+type StatusAdminStorage interface {
+	// Status Operations
+	GetCurrentStatus() (Status, error)
 }
 
 type AdminStorage interface {
+	StatusAdminStorage
 	ConfigurationAdminStorage
 	ImageAdminStorage
+	AlbumStorage
+	TrashStorage
+	TagStorage
 }
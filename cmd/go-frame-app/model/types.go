@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
 
 // Type represents the content type of a frame item (e.g. Image or URL).
 type Type string
@@ -8,28 +12,258 @@ type Type string
 const (
 	// ImageType indicates that the item is a local image file.
 	ImageType Type = "IMAGE"
-	// Url indicates that the item is a remote URL.
+	// Url indicates that the item is a remote image, referenced by its URL.
 	Url Type = "URL"
+	// WebPage indicates that the item is a remote web page, referenced by its URL.
+	WebPage Type = "PAGE"
 )
 
+// IsRemote reports whether items of this type are referenced by URL instead of stored on disk.
+func (t Type) IsRemote() bool {
+	return t == Url || t == WebPage
+}
+
 // Image represents the metadata of an image stored in the database.
 type Image struct {
 	// Id is the unique identifier of the image.
 	Id int
-	// Path is the filename of the image.
+	// Path is the filename of the image, or the URL for remote items.
 	Path string
-	// Type indicates the media type (e.g. IMAGE).
+	// Type indicates the media type (e.g. IMAGE, URL or PAGE).
 	Type Type
-	// Metadata contains additional info about the image.
-	Metadata string
+	// MimeType is the format of the image file, detected from its content. Empty for remote items.
+	MimeType string
+	// Metadata contains information extracted from the image file.
+	Metadata Metadata
+	// Hash is the hex encoded SHA-256 hash of the image file. Empty for remote items.
+	Hash string
+	// PerceptualHash is the hex encoded difference hash of the image content, similar images have similar hashes.
+	// Empty for remote items and images that cannot be decoded.
+	PerceptualHash string
+	// Hashed reports whether the hashes were computed from the file. Hashes that cannot be computed stay empty and
+	// are not computed again.
+	Hashed bool
+	// Weight is the relative probability of the image in weighted random rotation. Zero counts as one.
+	Weight int
+	// Duration overrides the configured display duration in seconds. Zero uses the configured duration.
+	Duration int
+	// TrashedAt is the time the image was moved to the trash. Zero for images in the library.
+	TrashedAt time.Time
+	// Albums are the IDs of the albums chosen by hand the image was part of before it was moved to the trash,
+	// so it rejoins them when restored. Empty for images in the library.
+	Albums []int `json:",omitempty"`
+	// Tags are free-form, normalized labels of the image, sorted and without duplicates.
+	Tags []string
+	// Rating is the rating of the image from 1 to MaxRating stars. Zero for unrated images.
+	Rating int
+	// UploadedAt is the time the image was added to the library. Zero for images stored by earlier versions.
+	UploadedAt time.Time
+}
+
+// MaxRating is the highest rating of an image.
+const MaxRating = 5
+
+// Metadata contains the information extracted from the EXIF data and the header of an image file.
+// Missing information is left empty.
+type Metadata struct {
+	// TakenAt is the time the picture was taken. Without recorded offset, the wall clock time is stored as UTC.
+	TakenAt time.Time `json:"takenAt,omitzero"`
+	// CameraMake is the manufacturer of the camera.
+	CameraMake string `json:"cameraMake,omitempty"`
+	// CameraModel is the model of the camera.
+	CameraModel string `json:"cameraModel,omitempty"`
+	// Width is the width of the stored image in pixels, before applying the orientation.
+	Width int `json:"width,omitempty"`
+	// Height is the height of the stored image in pixels, before applying the orientation.
+	Height int `json:"height,omitempty"`
+	// Orientation is the EXIF orientation (1-8) describing how the stored image must be rotated and flipped.
+	Orientation int `json:"orientation,omitempty"`
+	// Location is the position the picture was taken at.
+	Location *Location `json:"location,omitempty"`
 }
 
+// Location is a GPS position in decimal degrees.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// UnmarshalJSON decodes the metadata. Images stored by earlier versions carry an empty string,
+// which is read as empty metadata.
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*m = Metadata{}
+		return nil
+	}
+	type plain Metadata
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+// RotationMode selects the strategy used to choose the next image.
+type RotationMode string
+
+const (
+	// Sequential shows the images in the defined order.
+	Sequential RotationMode = "SEQUENTIAL"
+	// Shuffled shows every image once in random order before repeating any.
+	Shuffled RotationMode = "SHUFFLED"
+	// WeightedRandom picks images randomly, proportional to their weight.
+	WeightedRandom RotationMode = "WEIGHTED_RANDOM"
+	// LeastRecentlyShown picks the image that has not been displayed for the longest time.
+	LeastRecentlyShown RotationMode = "LEAST_RECENTLY_SHOWN"
+	// OnThisDay shows the photos taken around today's date in previous years, and the images in the defined order
+	// if there are too few of them.
+	OnThisDay RotationMode = "ON_THIS_DAY"
+)
+
 // Config represents the application configuration stored in the database.
 type Config struct {
 	// ImageDuration is the time in seconds each image is displayed.
 	ImageDuration int
-	// RandomOrder toggles random image shuffling.
+	// RandomOrder toggles random image shuffling. Only used if Rotation is not set.
 	RandomOrder bool
+	// Rotation selects the strategy used to choose the next image.
+	Rotation RotationMode
+	// AllowedFormats are the MIME types of the image formats accepted for import and upload.
+	// Empty allows all SupportedFormats.
+	AllowedFormats []string
+	// SimilarityThreshold is the maximum number of differing perceptual hash bits of near-duplicate images.
+	// Zero uses DefaultSimilarityThreshold.
+	SimilarityThreshold int
+	// CollapseSimilar shows only one image of each group of near-duplicates per rotation cycle.
+	CollapseSimilar bool
+	// TrashRetention is the number of days deleted images are kept in the trash. Zero uses DefaultTrashRetention.
+	TrashRetention int
+	// ActiveAlbum is the ID of the album shown by the rotation. Zero shows all images of the library.
+	ActiveAlbum int
+	// TagFilter is a tag expression, such as "family AND NOT screenshots", restricting the rotation to matching images.
+	// Empty shows all images.
+	TagFilter string
+	// MemoryWindow is the number of days before and after today's date, photos taken in previous years
+	// count as memories in the OnThisDay rotation. Zero matches the same month and day only.
+	MemoryWindow int
+	// MinMemories is the number of memories needed for the OnThisDay rotation to show them instead of
+	// the images in the defined order. Zero uses DefaultMinMemories.
+	MinMemories int
+}
+
+// DefaultMinMemories is the default number of memories needed for the OnThisDay rotation to show them.
+const DefaultMinMemories = 3
+
+// MaxMemoryWindow is the largest number of days around today's date photos count as memories.
+const MaxMemoryWindow = 31
+
+// Memories returns the number of memories needed for the OnThisDay rotation to show them.
+func (c Config) Memories() int {
+	if c.MinMemories <= 0 {
+		return DefaultMinMemories
+	}
+	return c.MinMemories
+}
+
+// DefaultTrashRetention is the default number of days deleted images are kept in the trash.
+const DefaultTrashRetention = 30
+
+// Retention returns the time deleted images are kept in the trash.
+func (c Config) Retention() time.Duration {
+	days := c.TrashRetention
+	if days <= 0 {
+		days = DefaultTrashRetention
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// DefaultSimilarityThreshold is the default maximum number of differing perceptual hash bits of near-duplicate images.
+const DefaultSimilarityThreshold = 10
+
+// MaxSimilarityThreshold is the largest meaningful threshold, the number of bits of a perceptual hash.
+const MaxSimilarityThreshold = 64
+
+// Similarity returns the maximum number of differing perceptual hash bits of near-duplicate images.
+func (c Config) Similarity() int {
+	if c.SimilarityThreshold <= 0 {
+		return DefaultSimilarityThreshold
+	}
+	return c.SimilarityThreshold
+}
+
+// SupportedFormats are the MIME types of the image formats the frame can display.
+var SupportedFormats = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// Formats returns the MIME types of the image formats accepted for import and upload.
+func (c Config) Formats() []string {
+	if len(c.AllowedFormats) == 0 {
+		return SupportedFormats
+	}
+	return c.AllowedFormats
+}
+
+// IsFormatAllowed reports whether images of the given MIME type are accepted for import and upload.
+func (c Config) IsFormatAllowed(mimeType string) bool {
+	return slices.Contains(c.Formats(), mimeType)
+}
+
+// Album is a named, ordered collection of images. An image can belong to several albums.
+type Album struct {
+	// Id is the unique identifier of the album.
+	Id int
+	// Name is the name of the album, e.g. "Vacation 2025".
+	Name string
+	// ImageIds are the IDs of the images of the album, in their defined order.
+	ImageIds []int
+	// Rules define the images of a smart album, which follow the rules as images are added or edited.
+	// Nil for albums whose images are chosen by hand.
+	Rules *AlbumRules
+}
+
+// Orientation is the orientation of an image as displayed, after applying its EXIF orientation.
+type Orientation string
+
+const (
+	// Landscape images are wider than high.
+	Landscape Orientation = "LANDSCAPE"
+	// Portrait images are higher than wide.
+	Portrait Orientation = "PORTRAIT"
+	// Square images are as wide as high.
+	Square Orientation = "SQUARE"
+)
+
+// AlbumRules select the images of a smart album. An image belongs to the album if it satisfies all rules,
+// rules left empty are not checked. Images lacking the information a rule checks, e.g. the date taken, do not satisfy it.
+type AlbumRules struct {
+	// TakenFrom is the earliest time the pictures were taken.
+	TakenFrom time.Time `json:"takenFrom,omitzero"`
+	// TakenUntil is the time the pictures were taken before.
+	TakenUntil time.Time `json:"takenUntil,omitzero"`
+	// Tags is a tag expression, such as "family AND NOT screenshots", the tags of the images must match.
+	Tags string `json:"tags,omitempty"`
+	// Orientation is the orientation of the images.
+	Orientation Orientation `json:"orientation,omitempty"`
+	// Camera is part of the make or model of the camera, compared regardless of case.
+	Camera string `json:"camera,omitempty"`
+	// MinRating is the lowest rating of the images.
+	MinRating int `json:"minRating,omitempty"`
+	// UploadedFrom is the earliest time the images were added to the library.
+	UploadedFrom time.Time `json:"uploadedFrom,omitzero"`
+	// UploadedUntil is the time the images were added to the library before.
+	UploadedUntil time.Time `json:"uploadedUntil,omitzero"`
+}
+
+// LibraryReport describes the changes made while reconciling the database with the image directory.
+type LibraryReport struct {
+	// Imported are the entries created for files found in the image directory.
+	Imported []Image
+	// Removed are the entries removed because their files are missing.
+	Removed []Image
+	// Skipped are the names of files that were not imported, because of their format or as duplicates of stored images.
+	Skipped []string
+	// OrderRepaired tells whether the defined order referenced missing or duplicate entries or lacked entries, and was rebuilt.
+	OrderRepaired bool
+}
+
+// Changed reports whether the reconciliation changed the library.
+func (r LibraryReport) Changed() bool {
+	return len(r.Imported) > 0 || len(r.Removed) > 0 || r.OrderRepaired
 }
 
 // Status represents the runtime status of the frame (current image, last switch time).
@@ -38,4 +272,10 @@ type Status struct {
 	CurrentImageId int
 	// LastSwitch is the timestamp when the image was last switched.
 	LastSwitch time.Time
+	// Paused keeps the current image on screen until the rotation is resumed.
+	Paused bool
+	// History contains the IDs of previously displayed images, the most recent one last.
+	History []int
+	// OverrideUntil is the time until which a manually selected image stays on screen.
+	OverrideUntil time.Time
 }
@@ -0,0 +1,493 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/smartalbum"
+)
+
+// albumBucketName is the bucket holding one nested bucket per album, keyed by the album ID.
+// Each album bucket stores the album under albumKey and its images in the nested albumOrderKey bucket,
+// which is structured like the order bucket of the library.
+var albumBucketName = []byte("albums")
+var albumKey = []byte("album")
+var albumOrderKey = []byte("order")
+
+var (
+	// ErrAlbumNotFound is returned if no album with the given ID exists.
+	ErrAlbumNotFound = errors.New("Album not found")
+	// ErrSmartAlbum is returned if the images of a smart album are changed by hand.
+	ErrSmartAlbum = errors.New("Images of smart albums follow their rules")
+)
+
+func initAlbumBucket(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(albumBucketName)
+	return err
+}
+
+// activeOrder returns the order bucket of the active album, or the order bucket of the library
+// if no album is active or the active album does not exist.
+func activeOrder(tx *bolt.Tx) *bolt.Bucket {
+	config, err := loadConfiguration(tx)
+	if err == nil && config.ActiveAlbum > 0 {
+		if album := tx.Bucket(albumBucketName).Bucket(itob(config.ActiveAlbum)); album != nil {
+			return album.Bucket(albumOrderKey)
+		}
+	}
+	return tx.Bucket(orderBucketName)
+}
+
+// isActiveAlbumSmart reports whether the active album is a smart album, whose images follow its rules.
+func isActiveAlbumSmart(tx *bolt.Tx) (bool, error) {
+	config, err := loadConfiguration(tx)
+	if err != nil || config.ActiveAlbum <= 0 {
+		return false, err
+	}
+	albumBucket := tx.Bucket(albumBucketName).Bucket(itob(config.ActiveAlbum))
+	if albumBucket == nil {
+		return false, nil
+	}
+	album, err := loadAlbum(albumBucket)
+	return album.Rules != nil, err
+}
+
+// forEachAlbum calls the function with the bucket of every album.
+func forEachAlbum(tx *bolt.Tx, apply func(album *bolt.Bucket) error) error {
+	albumsBucket := tx.Bucket(albumBucketName)
+	return albumsBucket.ForEach(func(key, value []byte) error {
+		if value != nil {
+			return nil
+		}
+		return apply(albumsBucket.Bucket(key))
+	})
+}
+
+// loadAlbum reads an album together with the IDs of its images.
+func loadAlbum(albumBucket *bolt.Bucket) (model.Album, error) {
+	var album model.Album
+	if err := json.Unmarshal(albumBucket.Get(albumKey), &album); err != nil {
+		return album, err
+	}
+	album.ImageIds = []int{}
+	err := albumBucket.Bucket(albumOrderKey).ForEach(func(key, value []byte) error {
+		album.ImageIds = append(album.ImageIds, int(binary.BigEndian.Uint64(value)))
+		return nil
+	})
+	return album, err
+}
+
+// LoadAlbums retrieves all albums, ordered by their ID.
+//
+// Returns:
+//   - []Album: The albums with the IDs of their images.
+//   - error: An error if the database read fails.
+func (s *Storage) LoadAlbums() ([]model.Album, error) {
+	albums := []model.Album{}
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		return forEachAlbum(tx, func(albumBucket *bolt.Bucket) error {
+			album, err := loadAlbum(albumBucket)
+			albums = append(albums, album)
+			return err
+		})
+	})
+	return albums, err
+}
+
+// LoadAlbum retrieves a specific album by its ID.
+//
+// Parameters:
+//   - id: The ID of the album.
+//
+// Returns:
+//   - Album: The album with the IDs of its images.
+//   - error: ErrAlbumNotFound or an error if the database read fails.
+func (s *Storage) LoadAlbum(id int) (model.Album, error) {
+	var album model.Album
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		albumBucket := tx.Bucket(albumBucketName).Bucket(itob(id))
+		if albumBucket == nil {
+			return ErrAlbumNotFound
+		}
+		var err error
+		album, err = loadAlbum(albumBucket)
+		return err
+	})
+	return album, err
+}
+
+// LoadAlbumImages retrieves the images of an album, in the defined order of the album.
+//
+// Parameters:
+//   - id: The ID of the album.
+//
+// Returns:
+//   - []Image: A slice of Image objects.
+//   - error: ErrAlbumNotFound or an error if the database read fails.
+func (s *Storage) LoadAlbumImages(id int) ([]model.Image, error) {
+	var images []model.Image
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		albumBucket := tx.Bucket(albumBucketName).Bucket(itob(id))
+		if albumBucket == nil {
+			return ErrAlbumNotFound
+		}
+		var err error
+		images, err = loadOrderedImages(tx, albumBucket.Bucket(albumOrderKey))
+		return err
+	})
+	return images, err
+}
+
+// CreateAlbum creates a new, empty album.
+//
+// Parameters:
+//   - name: The name of the album.
+//
+// Returns:
+//   - Album: The created album with assigned ID.
+//   - error: An error if the database update fails.
+func (s *Storage) CreateAlbum(name string) (model.Album, error) {
+	album := model.Album{Name: name, ImageIds: []int{}}
+	err := s.Db.Update(func(tx *bolt.Tx) error {
+		albumsBucket := tx.Bucket(albumBucketName)
+		sequence, err := albumsBucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		album.Id = int(sequence)
+		albumBucket, err := albumsBucket.CreateBucket(itob(album.Id))
+		if err != nil {
+			return err
+		}
+		if _, err := albumBucket.CreateBucket(albumOrderKey); err != nil {
+			return err
+		}
+		return putAlbum(albumBucket, album)
+	})
+	return album, err
+}
+
+func putAlbum(albumBucket *bolt.Bucket, album model.Album) error {
+	album.ImageIds = nil
+	albumJson, _ := json.Marshal(album)
+	return albumBucket.Put(albumKey, albumJson)
+}
+
+// RenameAlbum changes the name of an album.
+//
+// Parameters:
+//   - id: The ID of the album.
+//   - name: The new name of the album.
+//
+// Returns:
+//   - Album: The renamed album.
+//   - error: ErrAlbumNotFound or an error if the database update fails.
+func (s *Storage) RenameAlbum(id int, name string) (model.Album, error) {
+	return s.updateAlbum(id, func(tx *bolt.Tx, albumBucket *bolt.Bucket, album *model.Album) error {
+		album.Name = name
+		return putAlbum(albumBucket, *album)
+	})
+}
+
+// DeleteAlbum deletes an album. Its images stay in the library. If the album is active,
+// the rotation returns to all images of the library.
+//
+// Parameters:
+//   - id: The ID of the album.
+//
+// Returns:
+//   - error: ErrAlbumNotFound or an error if the database update fails.
+func (s *Storage) DeleteAlbum(id int) error {
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		albumsBucket := tx.Bucket(albumBucketName)
+		if albumsBucket.Bucket(itob(id)) == nil {
+			return ErrAlbumNotFound
+		}
+		if err := albumsBucket.DeleteBucket(itob(id)); err != nil {
+			return err
+		}
+		config, err := loadConfiguration(tx)
+		if err != nil || config.ActiveAlbum != id {
+			return err
+		}
+		config.ActiveAlbum = 0
+		configBytes, _ := json.Marshal(config)
+		if err := tx.Bucket(configBucketName).Put([]byte(ConfigKey), configBytes); err != nil {
+			return err
+		}
+		return invalidateDeck(tx)
+	})
+}
+
+// SetAlbumImages replaces the images of an album. The order of the IDs becomes the defined order of the album,
+// IDs given more than once are only added at their first position.
+//
+// Parameters:
+//   - id: The ID of the album.
+//   - imageIds: The IDs of the images of the album, in their defined order.
+//
+// Returns:
+//   - Album: The updated album.
+//   - error: ErrAlbumNotFound, ErrSmartAlbum, ErrImageNotFound if an image does not exist, or an error if the database update fails.
+func (s *Storage) SetAlbumImages(id int, imageIds []int) (model.Album, error) {
+	return s.updateAlbum(id, func(tx *bolt.Tx, albumBucket *bolt.Bucket, album *model.Album) error {
+		if album.Rules != nil {
+			return ErrSmartAlbum
+		}
+		var sequences []int
+		added := map[int]bool{}
+		for _, imageId := range imageIds {
+			if tx.Bucket(metadataBucketName).Get(itob(imageId)) == nil {
+				return ErrImageNotFound
+			}
+			if !added[imageId] {
+				added[imageId] = true
+				sequences = append(sequences, imageId)
+			}
+		}
+		album.ImageIds = sequences
+		return persistImageOrder(albumBucket.Bucket(albumOrderKey), sequences)
+	})
+}
+
+// ReorderAlbum updates the defined order of an album without changing its images.
+// Images left out keep their relative order behind the given images. Smart albums keep the order of their rules.
+//
+// Parameters:
+//   - id: The ID of the album.
+//   - imageIds: The IDs of images of the album, in their desired order.
+//
+// Returns:
+//   - Album: The updated album.
+//   - error: ErrAlbumNotFound, ErrSmartAlbum, ErrImageNotFound if an image is not part of the album, or an error if the database update fails.
+func (s *Storage) ReorderAlbum(id int, imageIds []int) (model.Album, error) {
+	return s.updateAlbum(id, func(tx *bolt.Tx, albumBucket *bolt.Bucket, album *model.Album) error {
+		if album.Rules != nil {
+			return ErrSmartAlbum
+		}
+		sequences, err := reorder(albumBucket.Bucket(albumOrderKey), imageIds)
+		album.ImageIds = sequences
+		return err
+	})
+}
+
+// AddToAlbum appends an image to an album. Images already in the album keep their position.
+//
+// Parameters:
+//   - id: The ID of the album.
+//   - imageId: The ID of the image to add.
+//
+// Returns:
+//   - Album: The updated album.
+//   - error: ErrAlbumNotFound, ErrSmartAlbum, ErrImageNotFound or an error if the database update fails.
+func (s *Storage) AddToAlbum(id int, imageId int) (model.Album, error) {
+	return s.updateAlbum(id, func(tx *bolt.Tx, albumBucket *bolt.Bucket, album *model.Album) error {
+		if album.Rules != nil {
+			return ErrSmartAlbum
+		}
+		if tx.Bucket(metadataBucketName).Get(itob(imageId)) == nil {
+			return ErrImageNotFound
+		}
+		orderBucket := albumBucket.Bucket(albumOrderKey)
+		found := false
+		orderBucket.ForEach(func(key, value []byte) error {
+			found = found || bytes.Equal(value, itob(imageId))
+			return nil
+		})
+		if found {
+			return nil
+		}
+		album.ImageIds = append(album.ImageIds, imageId)
+		return appendToOrderBucket(orderBucket, imageId)
+	})
+}
+
+// RemoveFromAlbum removes an image from an album. The image stays in the library.
+//
+// Parameters:
+//   - id: The ID of the album.
+//   - imageId: The ID of the image to remove.
+//
+// Returns:
+//   - Album: The updated album.
+//   - error: ErrAlbumNotFound, ErrSmartAlbum or an error if the database update fails.
+func (s *Storage) RemoveFromAlbum(id int, imageId int) (model.Album, error) {
+	return s.updateAlbum(id, func(tx *bolt.Tx, albumBucket *bolt.Bucket, album *model.Album) error {
+		if album.Rules != nil {
+			return ErrSmartAlbum
+		}
+		if err := removeFromOrderBucket(albumBucket.Bucket(albumOrderKey), imageId); err != nil {
+			return err
+		}
+		updated, err := loadAlbum(albumBucket)
+		*album = updated
+		return err
+	})
+}
+
+// SetAlbumRules turns an album into a smart album, whose images are the images of the library satisfying the rules.
+// The images follow the rules as images are added or edited. Without rules, the album keeps its current images,
+// which can be chosen by hand from then on.
+//
+// Parameters:
+//   - id: The ID of the album.
+//   - rules: The rules selecting the images of the album, or nil to choose them by hand.
+//
+// Returns:
+//   - Album: The updated album.
+//   - error: ErrAlbumNotFound, smartalbum.ErrInvalidRules or an error if the database update fails.
+func (s *Storage) SetAlbumRules(id int, rules *model.AlbumRules) (model.Album, error) {
+	var rule smartalbum.Rule
+	if rules != nil {
+		var err error
+		if rule, err = smartalbum.Compile(*rules); err != nil {
+			return model.Album{}, err
+		}
+	}
+	return s.updateAlbum(id, func(tx *bolt.Tx, albumBucket *bolt.Bucket, album *model.Album) error {
+		album.Rules = rules
+		if err := putAlbum(albumBucket, *album); err != nil {
+			return err
+		}
+		if rules == nil {
+			return nil
+		}
+		if _, err := refreshSmartAlbum(tx, albumBucket, rule); err != nil {
+			return err
+		}
+		updated, err := loadAlbum(albumBucket)
+		*album = updated
+		return err
+	})
+}
+
+// refreshSmartAlbums updates the smart albums after an image has been added or edited. Only the image is checked
+// against the rules: it joins the end of the albums whose rules it satisfies and leaves the albums whose rules
+// it no longer satisfies. If the image joined or left an album, the shuffled deck is discarded, as it may hold
+// the images of the album.
+func refreshSmartAlbums(tx *bolt.Tx, image model.Image) error {
+	changed := false
+	err := forEachAlbum(tx, func(albumBucket *bolt.Bucket) error {
+		album, err := loadAlbum(albumBucket)
+		if err != nil || album.Rules == nil {
+			return err
+		}
+		rule, err := smartalbum.Compile(*album.Rules)
+		if err != nil {
+			WarningLogger.Println("Skipping smart album", album.Id, "with invalid rules:", err)
+			return nil
+		}
+		matches := rule.Matches(image)
+		if matches == slices.Contains(album.ImageIds, image.Id) {
+			return nil
+		}
+		changed = true
+		if matches {
+			return appendToOrderBucket(albumBucket.Bucket(albumOrderKey), image.Id)
+		}
+		return removeFromOrderBucket(albumBucket.Bucket(albumOrderKey), image.Id)
+	})
+	if err != nil || !changed {
+		return err
+	}
+	return invalidateDeck(tx)
+}
+
+// refreshSmartAlbum updates the images of a smart album to the images of the library satisfying the rule.
+// Images staying in the album keep their position, images joining the album are appended in the defined order of the library.
+func refreshSmartAlbum(tx *bolt.Tx, albumBucket *bolt.Bucket, rule smartalbum.Rule) (bool, error) {
+	library, err := loadOrderedImages(tx, tx.Bucket(orderBucketName))
+	if err != nil {
+		return false, err
+	}
+	matching := map[int]bool{}
+	for _, image := range library {
+		if rule.Matches(image) {
+			matching[image.Id] = true
+		}
+	}
+	album, err := loadAlbum(albumBucket)
+	if err != nil {
+		return false, err
+	}
+	var sequences []int
+	for _, id := range album.ImageIds {
+		if matching[id] {
+			sequences = append(sequences, id)
+			delete(matching, id)
+		}
+	}
+	for _, image := range library {
+		if matching[image.Id] {
+			sequences = append(sequences, image.Id)
+		}
+	}
+	if slices.Equal(sequences, album.ImageIds) {
+		return false, nil
+	}
+	return true, persistImageOrder(albumBucket.Bucket(albumOrderKey), sequences)
+}
+
+// albumsOf returns the IDs of the albums chosen by hand that contain the image.
+func albumsOf(tx *bolt.Tx, imageId int) ([]int, error) {
+	var ids []int
+	err := forEachAlbum(tx, func(albumBucket *bolt.Bucket) error {
+		album, err := loadAlbum(albumBucket)
+		if err != nil {
+			return err
+		}
+		if album.Rules == nil && slices.Contains(album.ImageIds, imageId) {
+			ids = append(ids, album.Id)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// rejoinAlbums appends a restored image to the albums it was part of.
+// Albums deleted or turned into smart albums in the meantime are skipped.
+func rejoinAlbums(tx *bolt.Tx, imageId int, albumIds []int) error {
+	for _, id := range albumIds {
+		albumBucket := tx.Bucket(albumBucketName).Bucket(itob(id))
+		if albumBucket == nil {
+			continue
+		}
+		album, err := loadAlbum(albumBucket)
+		if err != nil {
+			return err
+		}
+		if album.Rules != nil || slices.Contains(album.ImageIds, imageId) {
+			continue
+		}
+		if err := appendToOrderBucket(albumBucket.Bucket(albumOrderKey), imageId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateAlbum applies a modification to an album within a single transaction and discards the shuffled deck,
+// which may hold the images of the album.
+func (s *Storage) updateAlbum(id int, update func(tx *bolt.Tx, albumBucket *bolt.Bucket, album *model.Album) error) (model.Album, error) {
+	var album model.Album
+	err := s.Db.Update(func(tx *bolt.Tx) error {
+		albumBucket := tx.Bucket(albumBucketName).Bucket(itob(id))
+		if albumBucket == nil {
+			return ErrAlbumNotFound
+		}
+		var err error
+		if album, err = loadAlbum(albumBucket); err != nil {
+			return err
+		}
+		if err := update(tx, albumBucket, &album); err != nil {
+			return err
+		}
+		return invalidateDeck(tx)
+	})
+	return album, err
+}
@@ -29,6 +29,7 @@ func prepopulateConfiguration(bucket *bolt.Bucket) error {
 	var config = model.Config{
 		ImageDuration: 60,
 		RandomOrder:   false,
+		Rotation:      model.Sequential,
 	}
 	configBytes, _ := json.Marshal(config)
 	return bucket.Put([]byte(ConfigKey), configBytes)
@@ -42,13 +43,20 @@ func prepopulateConfiguration(bucket *bolt.Bucket) error {
 func (s *Storage) GetConfiguration() (model.Config, error) {
 	var config model.Config
 	err := s.Db.View(func(tx *bolt.Tx) error {
-		configBucket := tx.Bucket(configBucketName)
-		configBytes := configBucket.Get([]byte(ConfigKey))
-		return json.Unmarshal(configBytes, &config)
+		var err error
+		config, err = loadConfiguration(tx)
+		return err
 	})
 	return config, err
 }
 
+func loadConfiguration(tx *bolt.Tx) (model.Config, error) {
+	var config model.Config
+	configBytes := tx.Bucket(configBucketName).Get([]byte(ConfigKey))
+	err := json.Unmarshal(configBytes, &config)
+	return config, err
+}
+
 // UpdateConfiguration persists a new configuration to the database.
 //
 // Parameters:
@@ -59,6 +67,12 @@ func (s *Storage) GetConfiguration() (model.Config, error) {
 func (s *Storage) UpdateConfiguration(config model.Config) error {
 	return s.Db.Update(func(tx *bolt.Tx) error {
 		configBucket := tx.Bucket(configBucketName)
+		if previous, err := loadConfiguration(tx); err == nil && previous.ActiveAlbum != config.ActiveAlbum {
+			// The deck holds the images of the previous album
+			if err := invalidateDeck(tx); err != nil {
+				return err
+			}
+		}
 		conigBytes, _ := json.Marshal(config)
 		return configBucket.Put([]byte(ConfigKey), conigBytes)
 	})
@@ -3,8 +3,10 @@ package persistence
 import (
 	"log"
 	"os"
+	"sync"
 
 	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
 )
 
 var (
@@ -22,6 +24,9 @@ func init() {
 // Storage handles the database connection and operations.
 type Storage struct {
 	Db *bolt.DB
+
+	mu               sync.Mutex
+	removedListeners []func(image model.Image)
 }
 
 // NewStorage opens a connection to the BoltDB database and initializes buckets.
@@ -55,6 +60,10 @@ func (s *Storage) initBuckets() error {
 	if err != nil {
 		return err
 	}
+	err = s.Db.Update(indexHashes)
+	if err != nil {
+		return err
+	}
 	err = s.Db.Update(initStatusBuckets)
 	if err != nil {
 		return err
@@ -63,9 +72,42 @@ func (s *Storage) initBuckets() error {
 	if err != nil {
 		return err
 	}
+	err = s.Db.Update(initDeckBucket)
+	if err != nil {
+		return err
+	}
+	err = s.Db.Update(initTrashBucket)
+	if err != nil {
+		return err
+	}
+	err = s.Db.Update(initAlbumBucket)
+	if err != nil {
+		return err
+	}
+	err = s.Db.Update(initTagBucket)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
+// OnImageRemoved registers a listener, called after an image has been removed from the database.
+// It allows cleaning up data derived from the image.
+func (s *Storage) OnImageRemoved(listener func(image model.Image)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removedListeners = append(s.removedListeners, listener)
+}
+
+func (s *Storage) notifyRemoved(image model.Image) {
+	s.mu.Lock()
+	listeners := s.removedListeners
+	s.mu.Unlock()
+	for _, listener := range listeners {
+		listener(image)
+	}
+}
+
 // Close closes the connection to the BoltDB database.
 //
 // Returns:
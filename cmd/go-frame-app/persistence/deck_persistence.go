@@ -0,0 +1,109 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+
+	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+const (
+	// DeckKey is the key, used to store the shuffled deck in the database.
+	DeckKey = "deck"
+)
+
+var deckBucketName = []byte("deck")
+
+// deck is a shuffled sequence of image IDs. Every image is drawn once before the deck is rebuilt.
+type deck struct {
+	ImageIds []int
+	Position int
+}
+
+func initDeckBucket(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(deckBucketName)
+	return err
+}
+
+// LoadNextShuffledImage draws the next image from the persisted shuffle deck.
+// A new deck is shuffled once all images have been shown, making sure the first image
+// of the new deck differs from the image currently displayed.
+//
+// Parameters:
+//   - id: The ID of the currently displayed image.
+//
+// Returns:
+//   - Image: The next Image object to display.
+//   - error: An error if no images exist or the deck cannot be persisted.
+func (s *Storage) LoadNextShuffledImage(id int) (model.Image, error) {
+	var image model.Image
+	err := s.Db.Update(func(tx *bolt.Tx) error {
+		var err error
+		image, err = loadNextShuffledImage(tx, id)
+		return err
+	})
+	return image, err
+}
+
+func loadNextShuffledImage(tx *bolt.Tx, id int) (model.Image, error) {
+	deckBucket := tx.Bucket(deckBucketName)
+	metadataBucket := tx.Bucket(metadataBucketName)
+
+	current, err := loadDeck(deckBucket)
+	if err != nil {
+		return model.Image{}, err
+	}
+	shuffled := false
+	for {
+		if current.Position >= len(current.ImageIds) {
+			if shuffled {
+				return model.Image{}, errors.New("No images found")
+			}
+			current = shuffleDeck(activeOrder(tx), id)
+			shuffled = true
+			continue
+		}
+		nextId := current.ImageIds[current.Position]
+		current.Position++
+		image, err := loadImageByByteId(itob(nextId), metadataBucket)
+		if err == nil {
+			deckBytes, _ := json.Marshal(current)
+			return image, deckBucket.Put([]byte(DeckKey), deckBytes)
+		}
+	}
+}
+
+func loadDeck(deckBucket *bolt.Bucket) (deck, error) {
+	var current deck
+	deckBytes := deckBucket.Get([]byte(DeckKey))
+	if deckBytes == nil {
+		return current, nil
+	}
+	err := json.Unmarshal(deckBytes, &current)
+	return current, err
+}
+
+func shuffleDeck(orderBucket *bolt.Bucket, currentId int) deck {
+	var ids []int
+	orderBucket.ForEach(func(key, value []byte) error {
+		ids = append(ids, int(binary.BigEndian.Uint64(value)))
+		return nil
+	})
+	rand.Shuffle(len(ids), func(i, j int) {
+		ids[i], ids[j] = ids[j], ids[i]
+	})
+	// Avoid showing the same image twice in a row across deck boundaries
+	if len(ids) > 1 && ids[0] == currentId {
+		swap := 1 + rand.IntN(len(ids)-1)
+		ids[0], ids[swap] = ids[swap], ids[0]
+	}
+	return deck{ImageIds: ids}
+}
+
+// invalidateDeck discards the current deck, so it is reshuffled on the next draw.
+func invalidateDeck(tx *bolt.Tx) error {
+	return tx.Bucket(deckBucketName).Delete([]byte(DeckKey))
+}
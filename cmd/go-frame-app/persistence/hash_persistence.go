@@ -0,0 +1,152 @@
+package persistence
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/similarity"
+)
+
+// hashBucketName is the bucket indexing the images by the SHA-256 hash of their file.
+// Each hash points to the ID of the image entry owning the content.
+var hashBucketName = []byte("hashes")
+
+// indexHashes computes the missing hashes of images stored by earlier versions and indexes all content hashes.
+// Each file is hashed once, images whose files are missing are hashed once they return.
+// Duplicates already in the library keep their entries, the index points to the first of them.
+func indexHashes(tx *bolt.Tx) error {
+	hashBucket, err := tx.CreateBucketIfNotExists(hashBucketName)
+	if err != nil {
+		return err
+	}
+	metadataBucket := tx.Bucket(metadataBucketName)
+	var images []model.Image
+	err = metadataBucket.ForEach(func(key, value []byte) error {
+		var image model.Image
+		if err := json.Unmarshal(value, &image); err == nil && image.Type == model.ImageType {
+			images = append(images, image)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		path := ImageDir + string(os.PathSeparator) + image.Path
+		_, statErr := os.Stat(path)
+		if !image.Hashed && (image.Hash == "" || image.PerceptualHash == "") && statErr == nil {
+			InfoLogger.Println("Hashing", image.Path)
+			if image.Hash == "" {
+				image.Hash, _ = hashFile(path)
+			}
+			if image.PerceptualHash == "" {
+				image.PerceptualHash, _ = similarity.HashFile(path)
+			}
+			// Files that cannot be hashed are not read again on every start
+			image.Hashed = true
+			imageJson, _ := json.Marshal(image)
+			if err := metadataBucket.Put(itob(image.Id), imageJson); err != nil {
+				return err
+			}
+		}
+		if image.Hash != "" && hashBucket.Get([]byte(image.Hash)) == nil {
+			if err := hashBucket.Put([]byte(image.Hash), itob(image.Id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findByHash returns the image owning the content with the given hash.
+func findByHash(tx *bolt.Tx, hash string) (model.Image, bool) {
+	if hash == "" {
+		return model.Image{}, false
+	}
+	id := tx.Bucket(hashBucketName).Get([]byte(hash))
+	if id == nil {
+		return model.Image{}, false
+	}
+	image, err := loadImageByByteId(id, tx.Bucket(metadataBucketName))
+	return image, err == nil
+}
+
+// indexHash records the image as owner of its content.
+func indexHash(tx *bolt.Tx, image model.Image) error {
+	if image.Hash == "" {
+		return nil
+	}
+	return tx.Bucket(hashBucketName).Put([]byte(image.Hash), itob(image.Id))
+}
+
+// unindexHash removes the image from the hash index. If other entries share the content, the first of them becomes the owner.
+func unindexHash(tx *bolt.Tx, image model.Image) error {
+	hashBucket := tx.Bucket(hashBucketName)
+	if image.Hash == "" || !bytes.Equal(hashBucket.Get([]byte(image.Hash)), itob(image.Id)) {
+		return nil
+	}
+	if err := hashBucket.Delete([]byte(image.Hash)); err != nil {
+		return err
+	}
+	return tx.Bucket(metadataBucketName).ForEach(func(key, value []byte) error {
+		var other model.Image
+		if err := json.Unmarshal(value, &other); err != nil || other.Id == image.Id || other.Hash != image.Hash {
+			return nil
+		}
+		if hashBucket.Get([]byte(image.Hash)) != nil {
+			return nil
+		}
+		return hashBucket.Put([]byte(image.Hash), itob(other.Id))
+	})
+}
+
+// FindDuplicates returns the groups of images sharing the same file content.
+// Groups and the images within each group are in the defined order.
+//
+// Returns:
+//   - [][]Image: The groups of duplicates, each with at least two images.
+//   - error: An error if the database read fails.
+func (s *Storage) FindDuplicates() ([][]model.Image, error) {
+	images, err := s.LoadLibrary()
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]model.Image{}
+	var hashes []string
+	for _, image := range images {
+		if image.Hash == "" {
+			continue
+		}
+		if _, found := groups[image.Hash]; !found {
+			hashes = append(hashes, image.Hash)
+		}
+		groups[image.Hash] = append(groups[image.Hash], image)
+	}
+	duplicates := [][]model.Image{}
+	for _, hash := range hashes {
+		if len(groups[hash]) > 1 {
+			duplicates = append(duplicates, groups[hash])
+		}
+	}
+	return duplicates, nil
+}
+
+// hashFile returns the hex encoded SHA-256 hash of the file content.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
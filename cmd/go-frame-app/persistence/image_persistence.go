@@ -2,12 +2,17 @@ package persistence
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"os"
+	"slices"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/metadata"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/similarity"
 )
 
 const (
@@ -18,6 +23,9 @@ const (
 var orderBucketName = []byte("order")
 var metadataBucketName = []byte("images")
 
+// ErrImageNotFound is returned if no image with the given ID exists in the library.
+var ErrImageNotFound = errors.New("Image not found")
+
 func initImageBuckets(tx *bolt.Tx) error {
 	metadataBucket, err := tx.CreateBucketIfNotExists(metadataBucketName)
 	if err != nil {
@@ -27,14 +35,18 @@ func initImageBuckets(tx *bolt.Tx) error {
 	if err != nil {
 		return err
 	}
+	if _, err := tx.CreateBucketIfNotExists(hashBucketName); err != nil {
+		return err
+	}
 
 	if isBucketEmpty(metadataBucket) {
-		err = prepopulateImages(metadataBucket, orderBucket)
+		err = prepopulateImages(tx, metadataBucket, orderBucket)
 	}
 	return err
 }
 
-// LoadImages retrieves all images from the database, ordered by their sequence.
+// LoadImages retrieves the images of the rotation, ordered by their sequence.
+// With an active album, these are the images of the album, otherwise all images of the library.
 //
 // Returns:
 //   - []Image: A slice of Image objects.
@@ -42,21 +54,47 @@ func initImageBuckets(tx *bolt.Tx) error {
 func (s *Storage) LoadImages() ([]model.Image, error) {
 	var images []model.Image
 	err := s.Db.View(func(tx *bolt.Tx) error {
-		orderBucket := tx.Bucket(orderBucketName)
-		metadataBucket := tx.Bucket(metadataBucketName)
+		var err error
+		images, err = loadImages(tx)
+		return err
+	})
+	return images, err
+}
 
-		err := orderBucket.ForEach(func(key, value []byte) error {
-			image, err := loadImageByByteId(value, metadataBucket)
-			if err == nil {
-				images = append(images, image)
-			}
-			return nil
-		})
+func loadImages(tx *bolt.Tx) ([]model.Image, error) {
+	return loadOrderedImages(tx, activeOrder(tx))
+}
+
+// LoadLibrary retrieves all images of the library, in the defined order, independent of the active album.
+//
+// Returns:
+//   - []Image: A slice of Image objects.
+//   - error: An error if the database read fails.
+func (s *Storage) LoadLibrary() ([]model.Image, error) {
+	var images []model.Image
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		var err error
+		images, err = loadOrderedImages(tx, tx.Bucket(orderBucketName))
 		return err
 	})
 	return images, err
 }
 
+// loadOrderedImages retrieves the images referenced by the given order bucket.
+func loadOrderedImages(tx *bolt.Tx, orderBucket *bolt.Bucket) ([]model.Image, error) {
+	var images []model.Image
+	metadataBucket := tx.Bucket(metadataBucketName)
+
+	err := orderBucket.ForEach(func(key, value []byte) error {
+		image, err := loadImageByByteId(value, metadataBucket)
+		if err == nil {
+			images = append(images, image)
+		}
+		return nil
+	})
+	return images, err
+}
+
 // LoadImage retrieves a specific image by its ID.
 //
 // Parameters:
@@ -68,16 +106,19 @@ func (s *Storage) LoadImages() ([]model.Image, error) {
 func (s *Storage) LoadImage(id int) (model.Image, error) {
 	var image model.Image
 	err := s.Db.View(func(tx *bolt.Tx) error {
-		metadataBucket := tx.Bucket(metadataBucketName)
-		returnedImage, err := loadImageByByteId(itob(id), metadataBucket)
+		returnedImage, err := loadImage(tx, id)
 		image = returnedImage
 		return err
 	})
 	return image, err
 }
 
+func loadImage(tx *bolt.Tx, id int) (model.Image, error) {
+	return loadImageByByteId(itob(id), tx.Bucket(metadataBucketName))
+}
+
 // LoadNextImage determines and retrieves the next image to be displayed based on the current image ID.
-// It cycles through the images in the defined order.
+// It cycles through the images in the defined order of the active album, or the library without active album.
 //
 // Parameters:
 //   - id: The ID of the currently displayed image.
@@ -88,37 +129,43 @@ func (s *Storage) LoadImage(id int) (model.Image, error) {
 func (s *Storage) LoadNextImage(id int) (model.Image, error) {
 	var image model.Image
 	err := s.Db.View(func(tx *bolt.Tx) error {
-		orderBucket := tx.Bucket(orderBucketName)
-		metadataBucket := tx.Bucket(metadataBucketName)
-		cursor := orderBucket.Cursor()
-		if id < 0 {
-			_, value := cursor.First()
-			if value == nil {
-				return errors.New("No images found")
-			}
-			img, err := loadImageByByteId(value, metadataBucket)
-			if err != nil {
-				return err
-			}
-			image = img
-		} else {
-			for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
-				if bytes.Equal(value, itob(id)) {
-					k, v := cursor.Next()
-					if k == nil {
-						k, v = cursor.First()
-					}
-					image, _ = loadImageByByteId(v, metadataBucket)
-					break
-				}
-			}
-		}
-		return nil
+		var err error
+		image, err = loadNextImage(tx, id)
+		return err
 	})
 	return image, err
 
 }
 
+func loadNextImage(tx *bolt.Tx, id int) (model.Image, error) {
+	var image model.Image
+	orderBucket := activeOrder(tx)
+	metadataBucket := tx.Bucket(metadataBucketName)
+	cursor := orderBucket.Cursor()
+	if id < 0 {
+		_, value := cursor.First()
+		if value == nil {
+			return image, errors.New("No images found")
+		}
+		return loadImageByByteId(value, metadataBucket)
+	}
+	for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+		if bytes.Equal(value, itob(id)) {
+			k, v := cursor.Next()
+			if k == nil {
+				k, v = cursor.First()
+			}
+			return loadImageByByteId(v, metadataBucket)
+		}
+	}
+	// The image is not part of the order (anymore), so the rotation starts over
+	_, value := cursor.First()
+	if value == nil {
+		return image, errors.New("No images found")
+	}
+	return loadImageByByteId(value, metadataBucket)
+}
+
 func loadImageByByteId(id []byte, metadataBucket *bolt.Bucket) (model.Image, error) {
 	image := metadataBucket.Get(id)
 	if image != nil {
@@ -130,34 +177,84 @@ func loadImageByByteId(id []byte, metadataBucket *bolt.Bucket) (model.Image, err
 			return imageStruct, nil
 		}
 	}
-	return model.Image{}, errors.New("Image not found")
+	return model.Image{}, ErrImageNotFound
 }
 
-// ReorderImages updates the display order of images in the database.
+// ReorderImages updates the display order of the active album, or of the library without active album.
+// Images left out keep their relative order behind the given images, they are no longer dropped from the order.
 //
 // Parameters:
 //   - images: A slice of Image objects in the desired order.
 //
 // Returns:
-//   - error: An error if the database update fails.
+//   - error: ErrImageNotFound if an image is not part of the reordered images, ErrSmartAlbum if the active album is a
+//     smart album, or an error if the database update fails.
 func (s *Storage) ReorderImages(images []model.Image) error {
 	var sequences []int
 	for _, image := range images {
 		sequences = append(sequences, image.Id)
 	}
 	return s.Db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(orderBucketName)
-		return persistImageOrder(bucket, sequences)
+		smart, err := isActiveAlbumSmart(tx)
+		if err != nil {
+			return err
+		}
+		if smart {
+			return ErrSmartAlbum
+		}
+		if _, err := reorder(activeOrder(tx), sequences); err != nil {
+			return err
+		}
+		return invalidateDeck(tx)
 	})
 }
 
+// reorder moves the given images of an order bucket to the front, in the given order. IDs given more than once
+// are only placed at their first position, the images left out follow in their current order.
+// The order cannot gain images this way, IDs that are not part of it are rejected with ErrImageNotFound.
+func reorder(orderBucket *bolt.Bucket, ids []int) ([]int, error) {
+	var current []int
+	err := orderBucket.ForEach(func(key, value []byte) error {
+		current = append(current, int(binary.BigEndian.Uint64(value)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var sequences []int
+	placed := map[int]bool{}
+	for _, id := range ids {
+		if !slices.Contains(current, id) {
+			return nil, ErrImageNotFound
+		}
+		if !placed[id] {
+			placed[id] = true
+			sequences = append(sequences, id)
+		}
+	}
+	for _, id := range current {
+		if !placed[id] {
+			sequences = append(sequences, id)
+		}
+	}
+	return sequences, persistImageOrder(orderBucket, sequences)
+}
+
 func persistImageOrder(orderBucket *bolt.Bucket, sequences []int) error {
+	// Deleting while iterating skips keys, so the keys are collected first
+	var keys [][]byte
 	err := orderBucket.ForEach(func(key, value []byte) error {
-		return orderBucket.Delete(key)
+		keys = append(keys, bytes.Clone(key))
+		return nil
 	})
 	if err != nil {
 		return err
 	}
+	for _, key := range keys {
+		if err := orderBucket.Delete(key); err != nil {
+			return err
+		}
+	}
 
 	for i, sequence := range sequences {
 		err = orderBucket.Put(itob(i), itob(sequence))
@@ -165,7 +262,10 @@ func persistImageOrder(orderBucket *bolt.Bucket, sequences []int) error {
 	return err
 }
 
-// DeleteImage removals an image from the database and the filesystem.
+// DeleteImage moves an image to the trash, removing it from the library and the defined order.
+// Its file is moved to the trash directory, until it is restored or purged. If the image is on screen, the status
+// moves on to the following image. Images whose files are already missing are deleted for good.
+// Listeners registered with OnImageRemoved are called afterwards.
 //
 // Parameters:
 //   - id: The ID of the image to delete.
@@ -173,21 +273,99 @@ func persistImageOrder(orderBucket *bolt.Bucket, sequences []int) error {
 // Returns:
 //   - error: An error if the image is not found or deletion fails.
 func (s *Storage) DeleteImage(id int) error {
-	return s.Db.Update(func(tx *bolt.Tx) error {
+	var image model.Image
+	err := s.Db.Update(func(tx *bolt.Tx) error {
 		metadataBucket := tx.Bucket(metadataBucketName)
-		metadata := metadataBucket.Get(itob(id))
-		if metadata == nil {
-			return errors.New("Image not found")
+		imageJson := metadataBucket.Get(itob(id))
+		if imageJson == nil {
+			return ErrImageNotFound
+		}
+		if err := json.Unmarshal(imageJson, &image); err != nil {
+			return err
 		}
-		var image model.Image
-		if err := json.Unmarshal(metadata, &image); err != nil {
+		var err error
+		if image.Albums, err = albumsOf(tx, id); err != nil {
 			return err
 		}
-		if err := deleteImageOnDisk(image.Path); err != nil {
+		if err := removeEntry(tx, image); err != nil {
 			return err
 		}
-		return metadataBucket.Delete(itob(id))
+		return trashEntry(tx, image, time.Now())
 	})
+	if err != nil {
+		return err
+	}
+	// The file is moved once the entry is committed, a failure restores the image
+	if err := s.moveToTrash(image); err != nil {
+		return err
+	}
+	s.notifyRemoved(image)
+	return nil
+}
+
+// UpdateImage stores changed attributes of an existing image.
+//
+// Parameters:
+//   - image: The Image object to store, identified by its ID.
+//
+// Returns:
+//   - error: An error if the image is not found or the update fails.
+func (s *Storage) UpdateImage(image model.Image) error {
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		return updateImage(tx, image)
+	})
+}
+
+// removeEntry removes the image from the database, together with its position in the defined order, its display time
+// and its hash and tag index entries. If the image is on screen, the status moves on to the following image.
+func removeEntry(tx *bolt.Tx, image model.Image) error {
+	if err := releaseStatus(tx, image.Id); err != nil {
+		return err
+	}
+	if err := removeFromOrder(tx, image.Id); err != nil {
+		return err
+	}
+	if err := invalidateDeck(tx); err != nil {
+		return err
+	}
+	if err := tx.Bucket(lastShownBucketName).Delete(itob(image.Id)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(metadataBucketName).Delete(itob(image.Id)); err != nil {
+		return err
+	}
+	if err := unindexTags(tx, image); err != nil {
+		return err
+	}
+	return unindexHash(tx, image)
+}
+
+// removeFromOrder removes the image from the defined order and all albums.
+func removeFromOrder(tx *bolt.Tx, id int) error {
+	if err := removeFromOrderBucket(tx.Bucket(orderBucketName), id); err != nil {
+		return err
+	}
+	return forEachAlbum(tx, func(album *bolt.Bucket) error {
+		return removeFromOrderBucket(album.Bucket(albumOrderKey), id)
+	})
+}
+
+// removeFromOrderBucket removes the image from an order. The following images move up, so the keys stay contiguous.
+func removeFromOrderBucket(orderBucket *bolt.Bucket, id int) error {
+	var sequences []int
+	found := false
+	err := orderBucket.ForEach(func(key, value []byte) error {
+		if sequence := int(binary.BigEndian.Uint64(value)); sequence != id {
+			sequences = append(sequences, sequence)
+		} else {
+			found = true
+		}
+		return nil
+	})
+	if err != nil || !found {
+		return err
+	}
+	return persistImageOrder(orderBucket, sequences)
 }
 
 func deleteImageOnDisk(path string) error {
@@ -196,36 +374,113 @@ func deleteImageOnDisk(path string) error {
 }
 
 // SaveImageMetadata creates a new image entry in the database.
+// The format, metadata and hash are read from the image file, which must already be stored in the image directory.
+// If another entry already holds the same content, no entry is created.
 //
 // Parameters:
 //   - name: The filename of the image.
 //
 // Returns:
-//   - Image: The created Image object with assigned ID.
-//   - error: An error if the database/metadata update fails.
+//   - Image: The created Image object with assigned ID, or the existing entry holding the same content.
+//   - error: ErrDuplicateImage or an error if the database/metadata update fails.
 func (s *Storage) SaveImageMetadata(name string) (model.Image, error) {
-	var image model.Image
-	err := s.Db.Update(func(tx *bolt.Tx) error {
-		orderBucket := tx.Bucket(orderBucketName)
-		metadataBucket := tx.Bucket(metadataBucketName)
+	image := inspectImage(name)
+	return s.saveItem(image)
+}
 
-		sequence, err := metadataBucket.NextSequence()
-		if err != nil {
-			return err
-		}
-		image = model.Image{
-			Id:       int(sequence),
-			Path:     name,
-			Type:     model.ImageType,
-			Metadata: "",
-		}
-		imageJson, _ := json.Marshal(image)
-		err = metadataBucket.Put(itob(int(sequence)), imageJson)
-		if err != nil {
-			return err
-		}
-		order := orderBucket.Stats().KeyN
-		return orderBucket.Put(itob(order), itob(int(sequence)))
+// inspectImage creates an image entry for a file in the image directory, detecting its format, metadata and hashes.
+// Information that cannot be read is logged and left empty.
+func inspectImage(name string) model.Image {
+	path := ImageDir + string(os.PathSeparator) + name
+	mimeType, err := metadata.DetectFileMimeType(path)
+	if err != nil {
+		WarningLogger.Println("Cannot detect format of", name, ":", err)
+	}
+	meta, err := metadata.Extract(path)
+	if err != nil {
+		WarningLogger.Println("Cannot read metadata of", name, ":", err)
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		WarningLogger.Println("Cannot hash", name, ":", err)
+	}
+	perceptualHash, err := similarity.HashFile(path)
+	if err != nil {
+		WarningLogger.Println("Cannot compute perceptual hash of", name, ":", err)
+	}
+	return model.Image{Path: name, Type: model.ImageType, MimeType: mimeType, Metadata: meta, Hash: hash, PerceptualHash: perceptualHash, Hashed: true}
+}
+
+// SaveUrlMetadata creates a new entry for a remote item in the database.
+//
+// Parameters:
+//   - url: The URL of the remote image or web page.
+//   - contentType: The type of the remote item (URL or PAGE).
+//
+// Returns:
+//   - Image: The created Image object with assigned ID.
+//   - error: An error if the type is not a remote type or the database update fails.
+func (s *Storage) SaveUrlMetadata(url string, contentType model.Type) (model.Image, error) {
+	if !contentType.IsRemote() {
+		return model.Image{}, errors.New("Not a remote content type")
+	}
+	return s.saveItem(model.Image{Path: url, Type: contentType})
+}
+
+// saveItem stores a new item at the end of the defined order, assigning its ID.
+// Items with the same content as an existing entry are not stored, the existing entry is returned with ErrDuplicateImage.
+func (s *Storage) saveItem(image model.Image) (model.Image, error) {
+	err := s.Db.Update(func(tx *bolt.Tx) error {
+		var err error
+		image, err = saveImage(tx, image)
+		return err
 	})
 	return image, err
 }
+
+func saveImage(tx *bolt.Tx, image model.Image) (model.Image, error) {
+	metadataBucket := tx.Bucket(metadataBucketName)
+	if existing, found := findByHash(tx, image.Hash); found {
+		return existing, ErrDuplicateImage
+	}
+
+	sequence, err := metadataBucket.NextSequence()
+	if err != nil {
+		return image, err
+	}
+	image.Id = int(sequence)
+	image.UploadedAt = time.Now().UTC()
+	imageJson, _ := json.Marshal(image)
+	err = metadataBucket.Put(itob(int(sequence)), imageJson)
+	if err != nil {
+		return image, err
+	}
+	if err := indexHash(tx, image); err != nil {
+		return image, err
+	}
+	if err := indexTags(tx, image); err != nil {
+		return image, err
+	}
+	if err := invalidateDeck(tx); err != nil {
+		return image, err
+	}
+	if err := appendToOrder(tx, image.Id); err != nil {
+		return image, err
+	}
+	return image, refreshSmartAlbums(tx, image)
+}
+
+// appendToOrder adds the image at the end of the defined order.
+func appendToOrder(tx *bolt.Tx, id int) error {
+	return appendToOrderBucket(tx.Bucket(orderBucketName), id)
+}
+
+// appendToOrderBucket adds the image at the end of an order.
+func appendToOrderBucket(orderBucket *bolt.Bucket, id int) error {
+	// Stats are not updated within the transaction, so the key follows the last one
+	order := 0
+	if last, _ := orderBucket.Cursor().Last(); last != nil {
+		order = int(binary.BigEndian.Uint64(last)) + 1
+	}
+	return orderBucket.Put(itob(order), itob(id))
+}
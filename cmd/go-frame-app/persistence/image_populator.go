@@ -4,14 +4,15 @@ import (
 	"encoding/json"
 	"os"
 	"strconv"
-	"strings"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/metadata"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
 )
 
-func prepopulateImages(metadataBucket *bolt.Bucket, orderBucket *bolt.Bucket) error {
-	sequences, err := persistImagesFromDir(metadataBucket)
+func prepopulateImages(tx *bolt.Tx, metadataBucket *bolt.Bucket, orderBucket *bolt.Bucket) error {
+	sequences, err := persistImagesFromDir(metadataBucket, tx.Bucket(hashBucketName), importConfiguration(tx))
 	if err != nil {
 		return err
 	}
@@ -19,42 +20,83 @@ func prepopulateImages(metadataBucket *bolt.Bucket, orderBucket *bolt.Bucket) er
 	return err
 }
 
-func persistImagesFromDir(metadataBucket *bolt.Bucket) ([]int, error) {
-	InfoLogger.Println("Loading images into database")
-	// Harden: Ensure directory exists
-	if err := os.MkdirAll(ImageDir, 0755); err != nil {
-		return nil, err
+// importConfiguration returns the configuration applied to the directory import.
+// On the first start, the configuration is not yet stored and the defaults apply.
+func importConfiguration(tx *bolt.Tx) model.Config {
+	if tx.Bucket(configBucketName) == nil {
+		return model.Config{}
 	}
-	files, err := os.ReadDir(ImageDir)
+	config, err := loadConfiguration(tx)
+	if err != nil {
+		return model.Config{}
+	}
+	return config
+}
+
+func persistImagesFromDir(metadataBucket *bolt.Bucket, hashBucket *bolt.Bucket, config model.Config) ([]int, error) {
+	InfoLogger.Println("Loading images into database")
+	filtered, _, err := listImageFiles(config)
 	if err != nil {
 		return nil, err
 	}
-	filtered := filter(files, func(info os.DirEntry) bool {
-		return !info.IsDir() && strings.HasSuffix(info.Name(), ".jpg")
-	})
 	InfoLogger.Println("Found " + strconv.Itoa(len(filtered)) + " images to save")
 	var sequences []int
 	for _, imageInfo := range filtered {
+		image := inspectImage(imageInfo.Name())
+		// Files with the same content are imported only once
+		if image.Hash != "" && hashBucket.Get([]byte(image.Hash)) != nil {
+			InfoLogger.Println("Skipping " + imageInfo.Name() + " as duplicate")
+			continue
+		}
 		sequence, err := metadataBucket.NextSequence()
 		if err != nil {
 			return nil, err
 		}
-		image := model.Image{
-			Id:   int(sequence),
-			Path: imageInfo.Name(),
-			Type: model.ImageType,
-		}
+		image.Id = int(sequence)
+		image.UploadedAt = time.Now().UTC()
 		imageJson, _ := json.Marshal(image)
 		err = metadataBucket.Put(itob(int(sequence)), imageJson)
 		if err != nil {
 			return nil, err
 		}
+		if image.Hash != "" {
+			if err := hashBucket.Put([]byte(image.Hash), itob(image.Id)); err != nil {
+				return nil, err
+			}
+		}
 		sequences = append(sequences, int(sequence))
 	}
 	InfoLogger.Println("Persisted all image metadata")
 	return sequences, nil
 }
 
+// listImageFiles returns the files in the image directory, split into files of allowed formats and all other files.
+// Formats are detected by content, independent of the file suffix. Directories and files of running imports are left out.
+func listImageFiles(config model.Config) ([]os.DirEntry, []os.DirEntry, error) {
+	// Harden: Ensure directory exists
+	if err := os.MkdirAll(ImageDir, 0755); err != nil {
+		return nil, nil, err
+	}
+	files, err := os.ReadDir(ImageDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	files = filter(files, func(info os.DirEntry) bool {
+		return info.Type().IsRegular() && !isTempFile(info.Name())
+	})
+	var rejected []os.DirEntry
+	accepted := filter(files, func(info os.DirEntry) bool {
+		mimeType, err := metadata.DetectFileMimeType(ImageDir + string(os.PathSeparator) + info.Name())
+		if err != nil || !config.IsFormatAllowed(mimeType) {
+			InfoLogger.Println("Skipping " + info.Name() + " with format " + mimeType)
+			rejected = append(rejected, info)
+			return false
+		}
+		return true
+	})
+	return accepted, rejected, nil
+}
+
 func filter(vs []os.DirEntry, f func(info os.DirEntry) bool) []os.DirEntry {
 	vsf := make([]os.DirEntry, 0)
 	for _, v := range vs {
@@ -0,0 +1,182 @@
+package persistence
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/metadata"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// MaxImageSize is the maximum size of an imported image file in bytes.
+var MaxImageSize int64 = 64 << 20
+
+// tempPrefix marks incomplete files in the image directory.
+const tempPrefix = ".import-"
+
+// maxNameLength limits the length of stored file names.
+const maxNameLength = 128
+
+var (
+	// ErrImageTooLarge is returned if an imported image exceeds MaxImageSize.
+	ErrImageTooLarge = errors.New("Image exceeds the maximum size")
+	// ErrFormatNotAllowed is returned if the format of an imported image is not allowed by the configuration.
+	ErrFormatNotAllowed = errors.New("Image format not allowed")
+	// ErrDuplicateImage is returned if the content of an imported image is already stored.
+	ErrDuplicateImage = errors.New("Image already exists")
+)
+
+// extensions are the file suffixes appended to imported names without suffix.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// ImportImage stores a new image file in the image directory and creates its database entry.
+// The file name is sanitized and made unique, so existing images are never overwritten. The content is
+// written to a temporary file first and only moved into place once it is complete and its format is allowed.
+// If the database entry cannot be created, the file is removed again. Importing content that is already stored,
+// under any name, returns the existing image and ErrDuplicateImage.
+//
+// Parameters:
+//   - name: The file name suggested by the client.
+//   - content: The content of the image file.
+//
+// Returns:
+//   - Image: The created Image object with assigned ID and the final file name as path, or the existing duplicate.
+//   - error: ErrImageTooLarge, ErrFormatNotAllowed, ErrDuplicateImage or an error if storing the file or the database entry fails.
+func (s *Storage) ImportImage(name string, content io.Reader) (model.Image, error) {
+	config, err := s.GetConfiguration()
+	if err != nil {
+		return model.Image{}, err
+	}
+	if err := os.MkdirAll(ImageDir, 0755); err != nil {
+		return model.Image{}, err
+	}
+	temp, mimeType, err := writeTempImage(content, config)
+	if err != nil {
+		return model.Image{}, err
+	}
+	defer os.Remove(temp)
+
+	filename, err := moveToUniqueName(temp, sanitizeFilename(name, mimeType))
+	if err != nil {
+		return model.Image{}, err
+	}
+	image, err := s.SaveImageMetadata(filename)
+	if errors.Is(err, ErrDuplicateImage) && image.Path == filename {
+		// A concurrent rescan picked up the file first
+		return image, nil
+	}
+	if err != nil {
+		// Roll back, so no orphaned file stays on disk
+		if removeErr := deleteImageOnDisk(filename); removeErr != nil {
+			ErrorLogger.Println("Cannot remove orphaned image", filename, ":", removeErr)
+		}
+		return image, err
+	}
+	return image, nil
+}
+
+// writeTempImage writes the content to a temporary file in the image directory and validates its size and format.
+func writeTempImage(content io.Reader, config model.Config) (string, string, error) {
+	temp, err := os.CreateTemp(ImageDir, tempPrefix+"*")
+	if err != nil {
+		return "", "", err
+	}
+	written, err := io.Copy(temp, io.LimitReader(content, MaxImageSize+1))
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > MaxImageSize {
+		err = ErrImageTooLarge
+	}
+	var mimeType string
+	if err == nil {
+		mimeType, err = metadata.DetectFileMimeType(temp.Name())
+	}
+	if err == nil && !config.IsFormatAllowed(mimeType) {
+		err = ErrFormatNotAllowed
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return "", "", err
+	}
+	return temp.Name(), mimeType, nil
+}
+
+// moveToUniqueName moves the temporary file to the first free variant of the given name (name, name-1, name-2, ...).
+// The name is reserved by creating it exclusively, so concurrent imports never overwrite each other.
+func moveToUniqueName(temp string, name string) (string, error) {
+	candidate, err := reserveUniqueName(name)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(ImageDir, candidate)
+	if err := os.Rename(temp, target); err != nil {
+		os.Remove(target)
+		return "", err
+	}
+	return candidate, nil
+}
+
+// reserveUniqueName creates an empty file at the first free variant of the given name (name, name-1, name-2, ...)
+// in the image directory. The file is replaced by the actual file once it is moved there.
+func reserveUniqueName(name string) (string, error) {
+	extension := path.Ext(name)
+	base := strings.TrimSuffix(name, extension)
+	for i := 0; i < 1000; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = base + "-" + strconv.Itoa(i) + extension
+		}
+		reserved, err := os.OpenFile(filepath.Join(ImageDir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		reserved.Close()
+		return candidate, nil
+	}
+	return "", errors.New("No free file name for " + name)
+}
+
+// sanitizeFilename reduces a client supplied name to a plain file name without directories
+// and unusual characters. The suffix of the client is replaced by the suffix of the detected format,
+// so files are never served with a content type that differs from their content.
+func sanitizeFilename(name string, mimeType string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	var builder strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_':
+			builder.WriteRune(r)
+		case unicode.IsSpace(r):
+			builder.WriteRune('_')
+		}
+	}
+	name = strings.TrimLeft(builder.String(), ".")
+	base := strings.TrimSuffix(name, path.Ext(name))
+	if base == "" {
+		base = "image"
+	}
+	if runes := []rune(base); len(runes) > maxNameLength {
+		base = string(runes[:maxNameLength])
+	}
+	return base + extensions[mimeType]
+}
+
+// isTempFile reports whether the file in the image directory is an incomplete import.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, tempPrefix)
+}
@@ -0,0 +1,150 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// CheckIntegrity verifies the references between the buckets:
+//   - The keys of the defined order and of the album orders are contiguous, starting at zero.
+//   - Every entry is part of the defined order exactly once, and the orders reference existing entries only.
+//   - Albums reference each image at most once.
+//   - The current image of the status is an existing entry, or no image at all.
+//   - Display times and hash index entries belong to existing entries, and every hashed image is indexed.
+//   - The tag index references existing entries carrying the tag, and every tag of an entry is indexed.
+//
+// Returns:
+//   - error: The joined violations, or nil if the database is consistent.
+func (s *Storage) CheckIntegrity() error {
+	var violations []error
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		var err error
+		violations, err = checkIntegrity(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(violations...)
+}
+
+func checkIntegrity(tx *bolt.Tx) ([]error, error) {
+	var violations []error
+	metadataBucket := tx.Bucket(metadataBucketName)
+	hashBucket := tx.Bucket(hashBucketName)
+	tagBucket := tx.Bucket(tagBucketName)
+
+	ordered, orderViolations, err := checkOrder("order", tx.Bucket(orderBucketName), metadataBucket)
+	if err != nil {
+		return nil, err
+	}
+	violations = append(violations, orderViolations...)
+	err = tx.Bucket(albumBucketName).ForEach(func(key, value []byte) error {
+		albumBucket := tx.Bucket(albumBucketName).Bucket(key)
+		if albumBucket == nil {
+			return nil
+		}
+		name := fmt.Sprintf("album %d", int(binary.BigEndian.Uint64(key)))
+		_, albumViolations, err := checkOrder(name, albumBucket.Bucket(albumOrderKey), metadataBucket)
+		violations = append(violations, albumViolations...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = metadataBucket.ForEach(func(key, value []byte) error {
+		var image model.Image
+		if err := json.Unmarshal(value, &image); err != nil {
+			violations = append(violations, fmt.Errorf("image %d cannot be read: %w", int(binary.BigEndian.Uint64(key)), err))
+			return nil
+		}
+		if !ordered[image.Id] {
+			violations = append(violations, fmt.Errorf("image %d is not part of the order", image.Id))
+		}
+		if image.Hash != "" && hashBucket.Get([]byte(image.Hash)) == nil {
+			violations = append(violations, fmt.Errorf("hash of image %d is not indexed", image.Id))
+		}
+		for _, tag := range image.Tags {
+			if !isTaggedWithAll(tagBucket, image.Id, []string{tag}) {
+				violations = append(violations, fmt.Errorf("tag %s of image %d is not indexed", tag, image.Id))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = hashBucket.ForEach(func(key, value []byte) error {
+		image, err := loadImageByByteId(value, metadataBucket)
+		if err != nil || image.Hash != string(key) {
+			violations = append(violations, fmt.Errorf("hash %s references image %d without that content", key, int(binary.BigEndian.Uint64(value))))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tagBucket.ForEach(func(tag, value []byte) error {
+		return tagBucket.Bucket(tag).ForEach(func(key, value []byte) error {
+			image, err := loadImageByByteId(key, metadataBucket)
+			if err != nil || !slices.Contains(image.Tags, string(tag)) {
+				violations = append(violations, fmt.Errorf("tag %s references image %d without that tag", tag, int(binary.BigEndian.Uint64(key))))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Bucket(lastShownBucketName).ForEach(func(key, value []byte) error {
+		if metadataBucket.Get(key) == nil {
+			violations = append(violations, fmt.Errorf("display time of missing image %d", int(binary.BigEndian.Uint64(key))))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := loadStatus(tx)
+	if err != nil {
+		return nil, err
+	}
+	if status.CurrentImageId >= 0 && metadataBucket.Get(itob(status.CurrentImageId)) == nil {
+		violations = append(violations, fmt.Errorf("current image %d is missing", status.CurrentImageId))
+	}
+	return violations, nil
+}
+
+// checkOrder verifies the keys and references of an order bucket and returns the referenced image IDs.
+func checkOrder(name string, orderBucket *bolt.Bucket, metadataBucket *bolt.Bucket) (map[int]bool, []error, error) {
+	var violations []error
+	ordered := map[int]bool{}
+	position := 0
+	err := orderBucket.ForEach(func(key, value []byte) error {
+		if key := int(binary.BigEndian.Uint64(key)); key != position {
+			violations = append(violations, fmt.Errorf("%s key %d at position %d", name, key, position))
+		}
+		position++
+		id := int(binary.BigEndian.Uint64(value))
+		if metadataBucket.Get(value) == nil {
+			violations = append(violations, fmt.Errorf("%s references missing image %d", name, id))
+		}
+		if ordered[id] {
+			violations = append(violations, fmt.Errorf("%s references image %d twice", name, id))
+		}
+		ordered[id] = true
+		return nil
+	})
+	return ordered, violations, err
+}
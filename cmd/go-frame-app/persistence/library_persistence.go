@@ -0,0 +1,239 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// ErrImageDirUnavailable is returned if the files of all images are missing, as the image directory is most likely
+// empty by accident or not mounted.
+var ErrImageDirUnavailable = errors.New("Files of all images are missing, image directory unavailable")
+
+// Reconcile brings the database in line with the image directory. Entries whose files are missing are moved to the
+// trash, the defined order is repaired and files without entry are appended to the order. Files returning to the
+// image directory restore their entry from the trash. If the files of all images are missing and there are no new
+// files, the image directory is considered unavailable and the library is left unchanged.
+// Listeners registered with OnImageRemoved are called for the removed entries.
+//
+// Returns:
+//   - LibraryReport: The changes made to the library.
+//   - error: ErrImageDirUnavailable, an error if the image directory cannot be read or the database update fails.
+func (s *Storage) Reconcile() (model.LibraryReport, error) {
+	// Reading and hashing new files takes long, so it is done before the database is locked for the update
+	inspected, rejected, err := s.inspectNewFiles()
+	if err != nil {
+		return model.LibraryReport{}, err
+	}
+	var report model.LibraryReport
+	err = s.Db.Update(func(tx *bolt.Tx) error {
+		report = model.LibraryReport{}
+		var err error
+		known := map[string]bool{}
+		if report.Removed, err = removeMissingImages(tx, known, len(inspected), time.Now()); err != nil {
+			return err
+		}
+		if report.OrderRepaired, err = repairOrder(tx); err != nil {
+			return err
+		}
+		report.Imported, report.Skipped, err = importNewFiles(tx, known, inspected, rejected)
+		return err
+	})
+	if err != nil {
+		return model.LibraryReport{}, err
+	}
+	for _, image := range report.Removed {
+		s.notifyRemoved(image)
+	}
+	return report, nil
+}
+
+// removeMissingImages moves the entries of images whose files are missing to the trash and collects the paths of
+// the remaining ones. Nothing is removed if the files of all images are missing and the directory holds no new files,
+// e.g. as the directory is not mounted. Files replaced by new ones are removed.
+func removeMissingImages(tx *bolt.Tx, known map[string]bool, newFiles int, now time.Time) ([]model.Image, error) {
+	var missing []model.Image
+	local := 0
+	err := tx.Bucket(metadataBucketName).ForEach(func(key, value []byte) error {
+		var image model.Image
+		if err := json.Unmarshal(value, &image); err != nil || image.Type != model.ImageType {
+			return nil
+		}
+		local++
+		_, err := os.Stat(ImageDir + string(os.PathSeparator) + image.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, image)
+		} else {
+			known[image.Path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 && len(missing) == local && newFiles == 0 {
+		return nil, ErrImageDirUnavailable
+	}
+	for _, image := range missing {
+		InfoLogger.Println("Moving", image.Path, "with missing file to the trash")
+		var err error
+		if image.Albums, err = albumsOf(tx, image.Id); err != nil {
+			return nil, err
+		}
+		if err := removeEntry(tx, image); err != nil {
+			return nil, err
+		}
+		// The entry is kept, so it is restored if the file returns
+		if err := keepInTrash(tx, image, now); err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// repairOrder rebuilds the defined order if it references missing entries, lists entries twice or lacks entries.
+// Valid entries keep their position, lacking entries are appended in the order of their IDs.
+func repairOrder(tx *bolt.Tx) (bool, error) {
+	orderBucket := tx.Bucket(orderBucketName)
+	metadataBucket := tx.Bucket(metadataBucketName)
+	var sequences []int
+	ordered := map[int]bool{}
+	repaired := false
+	err := orderBucket.ForEach(func(key, value []byte) error {
+		id := int(binary.BigEndian.Uint64(value))
+		if metadataBucket.Get(value) == nil || ordered[id] {
+			repaired = true
+			return nil
+		}
+		// Keys must be contiguous, new entries are stored at the key following the last one
+		if int(binary.BigEndian.Uint64(key)) != len(sequences) {
+			repaired = true
+		}
+		ordered[id] = true
+		sequences = append(sequences, id)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	err = metadataBucket.ForEach(func(key, value []byte) error {
+		if id := int(binary.BigEndian.Uint64(key)); !ordered[id] {
+			repaired = true
+			sequences = append(sequences, id)
+		}
+		return nil
+	})
+	if err != nil || !repaired {
+		return false, err
+	}
+	InfoLogger.Println("Repairing image order")
+	if err := persistImageOrder(orderBucket, sequences); err != nil {
+		return false, err
+	}
+	return true, invalidateDeck(tx)
+}
+
+// inspectNewFiles lists the files in the image directory and inspects the files of allowed formats that have no entry.
+// The names of the files of formats that are not allowed are returned separately.
+func (s *Storage) inspectNewFiles() ([]model.Image, []string, error) {
+	var config model.Config
+	known := map[string]bool{}
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		var err error
+		if config, err = loadConfiguration(tx); err != nil {
+			return err
+		}
+		return tx.Bucket(metadataBucketName).ForEach(func(key, value []byte) error {
+			var image model.Image
+			if err := json.Unmarshal(value, &image); err == nil && image.Type == model.ImageType {
+				known[image.Path] = true
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	accepted, rejected, err := listImageFiles(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	var inspected []model.Image
+	for _, file := range accepted {
+		if !known[file.Name()] {
+			inspected = append(inspected, inspectImage(file.Name()))
+		}
+	}
+	var rejectedNames []string
+	for _, file := range rejected {
+		rejectedNames = append(rejectedNames, file.Name())
+	}
+	return inspected, rejectedNames, nil
+}
+
+// importNewFiles creates entries for the inspected files that still have none.
+// Files of images moved to the trash as their files were missing restore these entries.
+// Files of formats that are not allowed and copies of stored images are skipped.
+func importNewFiles(tx *bolt.Tx, known map[string]bool, inspected []model.Image, rejected []string) ([]model.Image, []string, error) {
+	var imported []model.Image
+	var skipped []string
+	for _, name := range rejected {
+		if !known[name] {
+			skipped = append(skipped, name)
+		}
+	}
+	for _, file := range inspected {
+		// The file may have been imported since it was inspected
+		if known[file.Path] {
+			continue
+		}
+		if trashed, found := findMissingInTrash(tx, file.Hash); found {
+			InfoLogger.Println("Restoring", trashed.Path, "from", file.Path)
+			trashed.Path = file.Path
+			trashed.TrashedAt = time.Time{}
+			if err := restoreEntry(tx, trashed); err != nil {
+				return nil, nil, err
+			}
+			imported = append(imported, trashed)
+			continue
+		}
+		image, err := saveImage(tx, file)
+		if errors.Is(err, ErrDuplicateImage) {
+			InfoLogger.Println("Skipping " + file.Path + " as duplicate of " + image.Path)
+			skipped = append(skipped, file.Path)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		InfoLogger.Println("Imported", file.Path)
+		imported = append(imported, image)
+	}
+	return imported, skipped, nil
+}
+
+// findMissingInTrash finds a deleted image with the given content, whose file is missing from the trash.
+func findMissingInTrash(tx *bolt.Tx, hash string) (model.Image, bool) {
+	var missing model.Image
+	found := false
+	if hash == "" {
+		return missing, false
+	}
+	tx.Bucket(trashBucketName).ForEach(func(key, value []byte) error {
+		var image model.Image
+		if found || json.Unmarshal(value, &image) != nil || image.Hash != hash {
+			return nil
+		}
+		if _, err := os.Stat(trashPath(image)); errors.Is(err, os.ErrNotExist) {
+			missing = image
+			found = true
+		}
+		return nil
+	})
+	return missing, found
+}
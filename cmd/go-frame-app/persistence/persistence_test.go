@@ -1,13 +1,27 @@
 package persistence_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	bolt "go.etcd.io/bbolt"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
 	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/smartalbum"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/tagging"
 )
 
 func setupTestDB(t *testing.T) *persistence.Storage {
@@ -27,6 +41,7 @@ func setupTestDB(t *testing.T) *persistence.Storage {
 	t.Cleanup(func() {
 		storage.Close()
 		os.RemoveAll("images")
+		os.RemoveAll("trash")
 	})
 
 	return storage
@@ -52,7 +67,7 @@ func TestImageCRUD(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to load image: %v", err)
 	}
-	if loadedImg != img {
+	if !reflect.DeepEqual(loadedImg, img) {
 		t.Errorf("Loaded image mismatch: got %v, want %v", loadedImg, img)
 	}
 
@@ -98,8 +113,9 @@ func TestConfigPersistence(t *testing.T) {
 
 	// Update
 	newConfig := model.Config{
-		ImageDuration: 120,
-		RandomOrder:   true,
+		ImageDuration:  120,
+		RandomOrder:    true,
+		AllowedFormats: []string{"image/png"},
 	}
 	err = storage.UpdateConfiguration(newConfig)
 	if err != nil {
@@ -110,7 +126,7 @@ func TestConfigPersistence(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to get updated config: %v", err)
 	}
-	if updatedConfig != newConfig {
+	if !reflect.DeepEqual(updatedConfig, newConfig) {
 		t.Errorf("Config mismatch: got %v, want %v", updatedConfig, newConfig)
 	}
 }
@@ -185,4 +201,1252 @@ func TestLoadNextImage(t *testing.T) {
 	if next.Id != img2.Id {
 		t.Errorf("After reorder, expected next of img3 to be img2, got img%d", next.Id)
 	}
+
+	// Images left out keep their order behind the given ones
+	if err := storage.ReorderImages([]model.Image{img2}); err != nil {
+		t.Fatalf("Reorder failed: %v", err)
+	}
+	images, _ := storage.LoadImages()
+	if len(images) != 3 || images[0].Id != img2.Id || images[1].Id != img3.Id || images[2].Id != img1.Id {
+		t.Errorf("Expected order img2, img3, img1, got %+v", images)
+	}
+}
+
+func TestLoadNextShuffledImage(t *testing.T) {
+	storage := setupTestDB(t)
+
+	ids := map[int]bool{}
+	for _, name := range []string{"img1.jpg", "img2.jpg", "img3.jpg", "img4.jpg"} {
+		img, _ := storage.SaveImageMetadata(name)
+		ids[img.Id] = true
+	}
+
+	// Every deck must contain each image exactly once and never repeat across deck boundaries
+	current := -1
+	for round := 0; round < 10; round++ {
+		seen := map[int]bool{}
+		for i := 0; i < len(ids); i++ {
+			next, err := storage.LoadNextShuffledImage(current)
+			if err != nil {
+				t.Fatalf("LoadNextShuffledImage failed: %v", err)
+			}
+			if next.Id == current {
+				t.Errorf("Image %d shown twice in a row", next.Id)
+			}
+			if seen[next.Id] {
+				t.Errorf("Image %d shown twice in round %d", next.Id, round)
+			}
+			seen[next.Id] = true
+			current = next.Id
+		}
+		if len(seen) != len(ids) {
+			t.Errorf("Expected %d distinct images in round %d, got %d", len(ids), round, len(seen))
+		}
+	}
+}
+
+func TestShuffledDeckSurvivesRestart(t *testing.T) {
+	_ = os.MkdirAll("images", 0755)
+	t.Cleanup(func() { os.RemoveAll("images") })
+	dbPath := filepath.Join(t.TempDir(), "test_deck.db")
+
+	storage, err := persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open test DB: %v", err)
+	}
+	for _, name := range []string{"img1.jpg", "img2.jpg", "img3.jpg"} {
+		storage.SaveImageMetadata(name)
+	}
+	first, _ := storage.LoadNextShuffledImage(-1)
+	second, _ := storage.LoadNextShuffledImage(first.Id)
+	storage.Close()
+
+	storage, err = persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen test DB: %v", err)
+	}
+	defer storage.Close()
+
+	third, err := storage.LoadNextShuffledImage(second.Id)
+	if err != nil {
+		t.Fatalf("LoadNextShuffledImage failed: %v", err)
+	}
+	if third.Id == first.Id || third.Id == second.Id {
+		t.Errorf("Expected remaining image of the deck after restart, got img%d", third.Id)
+	}
+}
+
+func TestShuffledDeckRebuiltOnChanges(t *testing.T) {
+	storage := setupTestDB(t)
+
+	img1, _ := storage.SaveImageMetadata("img1.jpg")
+	storage.SaveImageMetadata("img2.jpg")
+	first, _ := storage.LoadNextShuffledImage(-1)
+
+	// Adding an image rebuilds the deck, so the new image shows up within the next full round
+	img3, _ := storage.SaveImageMetadata("img3.jpg")
+	found := false
+	current := first.Id
+	for i := 0; i < 3; i++ {
+		next, err := storage.LoadNextShuffledImage(current)
+		if err != nil {
+			t.Fatalf("LoadNextShuffledImage failed: %v", err)
+		}
+		found = found || next.Id == img3.Id
+		current = next.Id
+	}
+	if !found {
+		t.Error("Expected newly added image in rebuilt deck")
+	}
+
+	// Deleting an image removes it from the deck
+	f, _ := os.Create("images/img1.jpg")
+	f.Close()
+	if err := storage.DeleteImage(img1.Id); err != nil {
+		t.Fatalf("Failed to delete image: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		next, err := storage.LoadNextShuffledImage(current)
+		if err != nil {
+			t.Fatalf("LoadNextShuffledImage failed: %v", err)
+		}
+		if next.Id == img1.Id {
+			t.Error("Deleted image must not be drawn from the deck")
+		}
+		current = next.Id
+	}
+}
+
+func TestLoadNextShuffledImageWithoutImages(t *testing.T) {
+	storage := setupTestDB(t)
+
+	if _, err := storage.LoadNextShuffledImage(-1); err == nil {
+		t.Error("Expected error when no images exist")
+	}
+}
+
+func TestLoadLastShown(t *testing.T) {
+	storage := setupTestDB(t)
+
+	lastShown, err := storage.LoadLastShown()
+	if err != nil {
+		t.Fatalf("Failed to load last shown: %v", err)
+	}
+	if len(lastShown) != 0 {
+		t.Errorf("Expected no entries, got %d", len(lastShown))
+	}
+
+	storage.UpdateImageStatus(3)
+	lastShown, _ = storage.LoadLastShown()
+	if time.Since(lastShown[3]) > time.Second {
+		t.Errorf("Expected image 3 to be shown just now, got %v", lastShown[3])
+	}
+}
+
+func TestUpdateImage(t *testing.T) {
+	storage := setupTestDB(t)
+
+	img, _ := storage.SaveImageMetadata("img1.jpg")
+	img.Weight = 4
+	if err := storage.UpdateImage(img); err != nil {
+		t.Fatalf("Failed to update image: %v", err)
+	}
+	loaded, _ := storage.LoadImage(img.Id)
+	if loaded.Weight != 4 {
+		t.Errorf("Expected weight 4, got %d", loaded.Weight)
+	}
+
+	if err := storage.UpdateImage(model.Image{Id: 99}); err == nil {
+		t.Error("Expected error updating unknown image")
+	}
+}
+
+func TestUpdateStatus(t *testing.T) {
+	storage := setupTestDB(t)
+
+	err := storage.UpdateStatus(func(status *model.Status) error {
+		status.Paused = true
+		status.History = []int{1, 2}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+	status, _ := storage.GetCurrentStatus()
+	if !status.Paused || len(status.History) != 2 {
+		t.Errorf("Status not updated: %+v", status)
+	}
+	lastShown, _ := storage.LoadLastShown()
+	if len(lastShown) != 0 {
+		t.Errorf("Expected no display recorded without switch, got %v", lastShown)
+	}
+
+	// Failing modifications are not persisted
+	storage.UpdateStatus(func(status *model.Status) error {
+		status.Paused = false
+		return errors.New("abort")
+	})
+	status, _ = storage.GetCurrentStatus()
+	if !status.Paused {
+		t.Error("Aborted modification must not be persisted")
+	}
+}
+
+func TestTransition(t *testing.T) {
+	storage := setupTestDB(t)
+	img1, _ := storage.SaveImageMetadata("img1.jpg")
+	img2, _ := storage.SaveImageMetadata("img2.jpg")
+
+	err := storage.Transition(func(view model.RotationView, status *model.Status) error {
+		config, err := view.GetConfiguration()
+		if err != nil || config.ImageDuration != 60 {
+			t.Errorf("Expected configuration in transition, got %v (%v)", config, err)
+		}
+		next, err := view.LoadNextImage(img1.Id)
+		if err != nil {
+			return err
+		}
+		status.CurrentImageId = next.Id
+		status.LastSwitch = time.Now()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transition failed: %v", err)
+	}
+	status, _ := storage.GetCurrentStatus()
+	if status.CurrentImageId != img2.Id {
+		t.Errorf("Expected current image %d, got %d", img2.Id, status.CurrentImageId)
+	}
+	lastShown, _ := storage.LoadLastShown()
+	if _, ok := lastShown[img2.Id]; !ok {
+		t.Error("Expected switch to be recorded as last shown")
+	}
+
+	// Failing transitions leave the status untouched
+	storage.Transition(func(view model.RotationView, status *model.Status) error {
+		status.CurrentImageId = img1.Id
+		return errors.New("abort")
+	})
+	status, _ = storage.GetCurrentStatus()
+	if status.CurrentImageId != img2.Id {
+		t.Errorf("Aborted transition must not be persisted, got %d", status.CurrentImageId)
+	}
+}
+
+func TestUrlCRUD(t *testing.T) {
+	storage := setupTestDB(t)
+
+	page, err := storage.SaveUrlMetadata("https://example.com/", model.WebPage)
+	if err != nil {
+		t.Fatalf("Failed to save url: %v", err)
+	}
+	if page.Path != "https://example.com/" || page.Type != model.WebPage {
+		t.Errorf("Unexpected url item: %+v", page)
+	}
+	if _, err := storage.SaveUrlMetadata("https://example.com/a.jpg", model.ImageType); err == nil {
+		t.Error("Expected error saving url with local type")
+	}
+
+	// Remote items are part of the rotation
+	next, err := storage.LoadNextImage(-1)
+	if err != nil || next.Id != page.Id {
+		t.Errorf("Expected url item in rotation, got %+v (%v)", next, err)
+	}
+
+	// Deleting does not touch the filesystem
+	if err := storage.DeleteImage(page.Id); err != nil {
+		t.Fatalf("Failed to delete url: %v", err)
+	}
+	if _, err := storage.LoadImage(page.Id); err == nil {
+		t.Error("Expected error loading deleted url, got nil")
+	}
+}
+
+func writeJpeg(t *testing.T, name string, width int, height int) {
+	t.Helper()
+	_ = os.MkdirAll("images", 0755)
+	file, err := os.Create(filepath.Join("images", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := jpeg.Encode(file, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSaveImageMetadataExtractsMetadata(t *testing.T) {
+	storage := setupTestDB(t)
+	writeJpeg(t, "photo.jpg", 32, 16)
+
+	img, err := storage.SaveImageMetadata("photo.jpg")
+	if err != nil {
+		t.Fatalf("Failed to save image: %v", err)
+	}
+	loaded, _ := storage.LoadImage(img.Id)
+	if loaded.Metadata.Width != 32 || loaded.Metadata.Height != 16 {
+		t.Errorf("Expected 32x16, got %dx%d", loaded.Metadata.Width, loaded.Metadata.Height)
+	}
+}
+
+func TestPrepopulateExtractsMetadata(t *testing.T) {
+	writeJpeg(t, "existing.jpg", 8, 24)
+	storage := setupTestDB(t)
+
+	images, _ := storage.LoadImages()
+	if len(images) != 1 || images[0].Metadata.Width != 8 || images[0].Metadata.Height != 24 {
+		t.Errorf("Expected prepopulated image with 8x24, got %+v", images)
+	}
+}
+
+func TestLoadLegacyMetadata(t *testing.T) {
+	storage := setupTestDB(t)
+	img, _ := storage.SaveImageMetadata("legacy.jpg")
+	storage.Db.Update(func(tx *bolt.Tx) error {
+		legacy := `{"Id":` + strconv.Itoa(img.Id) + `,"Path":"legacy.jpg","Type":"IMAGE","Metadata":""}`
+		return tx.Bucket([]byte("images")).Put(itob(img.Id), []byte(legacy))
+	})
+
+	loaded, err := storage.LoadImage(img.Id)
+	if err != nil {
+		t.Fatalf("Failed to load legacy image: %v", err)
+	}
+	if loaded.Path != "legacy.jpg" || loaded.Metadata != (model.Metadata{}) {
+		t.Errorf("Expected legacy image with empty metadata, got %+v", loaded)
+	}
+}
+
+func itob(v int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+func TestOnImageRemoved(t *testing.T) {
+	storage := setupTestDB(t)
+	img, _ := storage.SaveUrlMetadata("https://example.com/photo.jpg", model.Url)
+	var removed []model.Image
+	storage.OnImageRemoved(func(image model.Image) {
+		removed = append(removed, image)
+	})
+
+	if err := storage.DeleteImage(99); err == nil {
+		t.Error("Expected error deleting unknown image")
+	}
+	if err := storage.DeleteImage(img.Id); err != nil {
+		t.Fatalf("Failed to delete image: %v", err)
+	}
+	if len(removed) != 1 || removed[0].Path != img.Path {
+		t.Errorf("Expected one removal of %s, got %+v", img.Path, removed)
+	}
+}
+
+func TestPrepopulateDetectsFormats(t *testing.T) {
+	_ = os.MkdirAll("images", 0755)
+	writeJpeg(t, "upper.JPG", 4, 4)
+	writeJpeg(t, "long.jpeg", 8, 8)
+	pngFile, _ := os.Create(filepath.Join("images", "graphic.png"))
+	png.Encode(pngFile, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	pngFile.Close()
+	os.WriteFile(filepath.Join("images", "animation.gif"), []byte("GIF89a\x01\x00\x01\x00"), 0644)
+	os.WriteFile(filepath.Join("images", "notes.txt"), []byte("not an image"), 0644)
+	// A misleading suffix does not matter, the content decides
+	os.WriteFile(filepath.Join("images", "fake.jpg"), []byte("not an image"), 0644)
+	storage := setupTestDB(t)
+
+	images, _ := storage.LoadImages()
+	formats := map[string]string{}
+	for _, img := range images {
+		formats[img.Path] = img.MimeType
+	}
+	expected := map[string]string{
+		"upper.JPG":     "image/jpeg",
+		"long.jpeg":     "image/jpeg",
+		"graphic.png":   "image/png",
+		"animation.gif": "image/gif",
+	}
+	if !reflect.DeepEqual(formats, expected) {
+		t.Errorf("Expected %v, got %v", expected, formats)
+	}
+}
+
+func jpegContent(t *testing.T, size int) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, size, size)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func imageFiles(t *testing.T) []string {
+	t.Helper()
+	entries, _ := os.ReadDir("images")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestImportImage(t *testing.T) {
+	storage := setupTestDB(t)
+
+	tests := []struct {
+		name     string
+		size     int
+		expected string
+	}{
+		// Directories are stripped, so files cannot be written outside the image directory
+		{"../../evil.jpg", 4, "evil.jpg"},
+		{`..\..\windows.jpg`, 5, "windows.jpg"},
+		{"my holiday/photo 1.jpg", 6, "photo_1.jpg"},
+		{".hidden.jpg", 7, "hidden.jpg"},
+		{"no-suffix", 9, "no-suffix.jpg"},
+		// The suffix follows the detected format, never the name of the client
+		{"payload.html", 11, "payload.jpg"},
+		{"vector.svg", 12, "vector.jpg"},
+		{"photo.JPEG", 13, "photo.jpg"},
+		{"my.photo.jpg", 14, "my.photo.jpg"},
+		{"..", 10, "image.jpg"},
+		// Existing files are never overwritten
+		{"evil.jpg", 8, "evil-1.jpg"},
+		{"evil.jpg", 16, "evil-2.jpg"},
+	}
+	for _, test := range tests {
+		content := jpegContent(t, test.size)
+		img, err := storage.ImportImage(test.name, bytes.NewReader(content))
+		if err != nil {
+			t.Errorf("Failed to import %q: %v", test.name, err)
+			continue
+		}
+		if img.Path != test.expected || img.MimeType != "image/jpeg" {
+			t.Errorf("Expected %q to be stored as %s, got %s (%s)", test.name, test.expected, img.Path, img.MimeType)
+		}
+		if stored, _ := os.ReadFile(filepath.Join("images", img.Path)); !bytes.Equal(stored, content) {
+			t.Errorf("Expected content of %s to be stored", img.Path)
+		}
+	}
+	images, _ := storage.LoadImages()
+	if len(images) != len(tests) || len(imageFiles(t)) != len(tests) {
+		t.Errorf("Expected %d images, got %d entries and files %v", len(tests), len(images), imageFiles(t))
+	}
+}
+
+func TestImportImageDuplicate(t *testing.T) {
+	storage := setupTestDB(t)
+	original, _ := storage.ImportImage("photo.jpg", bytes.NewReader(jpegContent(t, 4)))
+	renamed, _ := storage.ImportImage("photo.jpg", bytes.NewReader(jpegContent(t, 8)))
+	if original.Hash == "" || original.Hash == renamed.Hash {
+		t.Errorf("Expected different hashes, got %q and %q", original.Hash, renamed.Hash)
+	}
+	if original.PerceptualHash == "" {
+		t.Error("Expected a perceptual hash")
+	}
+
+	// The same content is not stored again, under any name
+	for _, test := range []struct {
+		name     string
+		size     int
+		expected model.Image
+	}{{"photo.jpg", 4, original}, {"photo.jpg", 8, renamed}, {"copy.jpg", 4, original}} {
+		duplicate, err := storage.ImportImage(test.name, bytes.NewReader(jpegContent(t, test.size)))
+		if !errors.Is(err, persistence.ErrDuplicateImage) || duplicate.Id != test.expected.Id {
+			t.Errorf("Expected duplicate of %s, got %+v (%v)", test.expected.Path, duplicate, err)
+		}
+	}
+	if files := imageFiles(t); len(files) != 2 {
+		t.Errorf("Expected 2 files, got %v", files)
+	}
+
+	// After deleting the image, its content can be imported again
+	storage.DeleteImage(original.Id)
+	if img, err := storage.ImportImage("copy.jpg", bytes.NewReader(jpegContent(t, 4))); err != nil || img.Path != "copy.jpg" {
+		t.Errorf("Expected copy.jpg, got %s (%v)", img.Path, err)
+	}
+}
+
+// forgetHashes turns all entries into entries stored by versions without hashing.
+func forgetHashes(storage *persistence.Storage) {
+	storage.Db.Update(func(tx *bolt.Tx) error {
+		tx.DeleteBucket([]byte("hashes"))
+		tx.CreateBucket([]byte("hashes"))
+		bucket := tx.Bucket([]byte("images"))
+		return bucket.ForEach(func(key, value []byte) error {
+			var img model.Image
+			json.Unmarshal(value, &img)
+			img.Hash, img.PerceptualHash, img.Hashed = "", "", false
+			legacy, _ := json.Marshal(img)
+			return bucket.Put(key, legacy)
+		})
+	})
+}
+
+func TestIndexHashesOfExistingImages(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test_hashes.db")
+	writeJpeg(t, "first.jpg", 4, 4)
+	writeJpeg(t, "second.jpg", 8, 8)
+	storage, err := persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll("images") })
+
+	// Entries stored by earlier versions have no hash, the library already contains a duplicate
+	forgetHashes(storage)
+	writeJpeg(t, "copy.jpg", 4, 4)
+	copied, _ := storage.SaveImageMetadata("copy.jpg")
+	forgetHashes(storage)
+	storage.Close()
+
+	storage, err = persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	duplicates, _ := storage.FindDuplicates()
+	if len(duplicates) != 1 || len(duplicates[0]) != 2 || duplicates[0][0].Path != "first.jpg" || duplicates[0][1].Path != "copy.jpg" {
+		t.Fatalf("Expected first.jpg and copy.jpg as duplicates, got %+v", duplicates)
+	}
+	if duplicates[0][0].PerceptualHash == "" || duplicates[0][0].PerceptualHash != duplicates[0][1].PerceptualHash {
+		t.Errorf("Expected equal perceptual hashes, got %+v", duplicates[0])
+	}
+
+	// Deleting the owner of the content keeps the index for the remaining duplicate
+	storage.DeleteImage(duplicates[0][0].Id)
+	writeJpeg(t, "again.jpg", 4, 4)
+	if img, err := storage.SaveImageMetadata("again.jpg"); !errors.Is(err, persistence.ErrDuplicateImage) || img.Id != copied.Id {
+		t.Errorf("Expected duplicate of copy.jpg, got %+v (%v)", img, err)
+	}
+	if duplicates, _ := storage.FindDuplicates(); len(duplicates) != 0 {
+		t.Errorf("Expected no duplicates, got %+v", duplicates)
+	}
+}
+
+func TestIndexHashesOnce(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test_hashes.db")
+	_ = os.MkdirAll("images", 0755)
+	if err := os.WriteFile(filepath.Join("images", "broken.jpg"), jpegContent(t, 4)[:20], 0644); err != nil {
+		t.Fatal(err)
+	}
+	storage, err := persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll("images") })
+	forgetHashes(storage)
+	storage.Close()
+
+	// The truncated file cannot be decoded, the failed attempt is recorded
+	storage, err = persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, _ := storage.LoadImages()
+	if len(images) != 1 || !images[0].Hashed || images[0].Hash == "" || images[0].PerceptualHash != "" {
+		t.Fatalf("Expected hashed broken.jpg without perceptual hash, got %+v", images)
+	}
+	storage.Close()
+
+	// Later starts do not read the file again
+	writeJpeg(t, "broken.jpg", 4, 4)
+	storage, err = persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	if again, _ := storage.LoadImage(images[0].Id); again.Hash != images[0].Hash || again.PerceptualHash != "" {
+		t.Errorf("Expected unchanged hashes, got %+v", again)
+	}
+}
+
+func TestImportImageRejected(t *testing.T) {
+	storage := setupTestDB(t)
+	defer func(size int64) { persistence.MaxImageSize = size }(persistence.MaxImageSize)
+	content := jpegContent(t, 4)
+
+	if _, err := storage.ImportImage("notes.jpg", bytes.NewReader([]byte("not an image"))); !errors.Is(err, persistence.ErrFormatNotAllowed) {
+		t.Errorf("Expected ErrFormatNotAllowed, got %v", err)
+	}
+	persistence.MaxImageSize = int64(len(content) - 1)
+	if _, err := storage.ImportImage("large.jpg", bytes.NewReader(content)); !errors.Is(err, persistence.ErrImageTooLarge) {
+		t.Errorf("Expected ErrImageTooLarge, got %v", err)
+	}
+	// Neither the file nor a temporary file is left behind
+	if files := imageFiles(t); len(files) != 0 {
+		t.Errorf("Expected no files, got %v", files)
+	}
+	if images, _ := storage.LoadImages(); len(images) != 0 {
+		t.Errorf("Expected no images, got %d", len(images))
+	}
+}
+
+// closingReader closes the database once the content is read completely.
+type closingReader struct {
+	*bytes.Reader
+	storage *persistence.Storage
+}
+
+func (r closingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.storage.Close()
+	}
+	return n, err
+}
+
+func TestImportImageRollback(t *testing.T) {
+	storage := setupTestDB(t)
+	// Saving the database entry fails after the file was stored
+	content := closingReader{bytes.NewReader(jpegContent(t, 4)), storage}
+
+	if _, err := storage.ImportImage("photo.jpg", content); err == nil {
+		t.Fatal("Expected import to fail")
+	}
+	if files := imageFiles(t); len(files) != 0 {
+		t.Errorf("Expected file to be removed, got %v", files)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	storage := setupTestDB(t)
+	var names []string
+	for i, name := range []string{"first.jpg", "missing.jpg", "third.jpg"} {
+		writeJpeg(t, name, 4*(i+1), 4*(i+1))
+		img, _ := storage.SaveImageMetadata(name)
+		names = append(names, img.Path)
+	}
+	storage.SaveUrlMetadata("https://example.com/photo.jpg", model.Url)
+	var removed []string
+	storage.OnImageRemoved(func(image model.Image) {
+		removed = append(removed, image.Path)
+	})
+
+	// Files are added and removed by hand
+	os.Remove(filepath.Join("images", "missing.jpg"))
+	writeJpeg(t, "added.jpg", 16, 16)
+	writeJpeg(t, "copy.jpg", 4, 4)
+	os.WriteFile(filepath.Join("images", "notes.txt"), []byte("not an image"), 0644)
+
+	report, err := storage.Reconcile()
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if len(report.Imported) != 1 || report.Imported[0].Path != "added.jpg" || report.Imported[0].Hash == "" {
+		t.Errorf("Expected added.jpg to be imported, got %+v", report.Imported)
+	}
+	if len(report.Removed) != 1 || report.Removed[0].Path != "missing.jpg" || !reflect.DeepEqual(removed, []string{"missing.jpg"}) {
+		t.Errorf("Expected missing.jpg to be removed, got %+v, notified %v", report.Removed, removed)
+	}
+	// Removing entries keeps the order intact
+	if !reflect.DeepEqual(report.Skipped, []string{"notes.txt", "copy.jpg"}) || report.OrderRepaired {
+		t.Errorf("Expected skipped files and intact order, got %+v", report)
+	}
+	images, _ := storage.LoadImages()
+	var paths []string
+	for _, img := range images {
+		paths = append(paths, img.Path)
+	}
+	expected := []string{"first.jpg", "third.jpg", "https://example.com/photo.jpg", "added.jpg"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %v, got %v", expected, paths)
+	}
+
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+
+	// A consistent library stays unchanged
+	if report, _ := storage.Reconcile(); report.Changed() {
+		t.Errorf("Expected no changes, got %+v", report)
+	}
+
+	// The entry of the missing file waits in the trash until the file returns
+	trashed, _ := storage.LoadTrash()
+	if len(trashed) != 1 || trashed[0].Path != "missing.jpg" {
+		t.Fatalf("Expected missing.jpg in the trash, got %+v", trashed)
+	}
+	if _, err := storage.RestoreImage(trashed[0].Id); !errors.Is(err, persistence.ErrFileMissing) {
+		t.Errorf("Expected ErrFileMissing, got %v", err)
+	}
+	writeJpeg(t, "missing-again.jpg", 8, 8)
+	report, err = storage.Reconcile()
+	if err != nil || len(report.Imported) != 1 || report.Imported[0].Id != trashed[0].Id || report.Imported[0].Path != "missing-again.jpg" {
+		t.Errorf("Expected the entry to be restored, got %+v (%v)", report, err)
+	}
+	if trashed, _ := storage.LoadTrash(); len(trashed) != 0 {
+		t.Errorf("Expected an empty trash, got %+v", trashed)
+	}
+
+	// Without any file, the image directory is considered unavailable
+	for _, name := range []string{"first.jpg", "third.jpg", "added.jpg", "missing-again.jpg", "copy.jpg"} {
+		os.Remove(filepath.Join("images", name))
+	}
+	if _, err := storage.Reconcile(); !errors.Is(err, persistence.ErrImageDirUnavailable) {
+		t.Errorf("Expected ErrImageDirUnavailable, got %v", err)
+	}
+	if images, _ := storage.LoadLibrary(); len(images) != 5 {
+		t.Errorf("Expected the library to stay, got %+v", images)
+	}
+
+	// Files replaced by new ones are moved to the trash and the new files are imported
+	writeJpeg(t, "replaced.jpg", 16, 16)
+	report, err = storage.Reconcile()
+	if err != nil || len(report.Removed) != 4 || len(report.Imported) != 1 || report.Imported[0].Path != "replaced.jpg" {
+		t.Errorf("Expected all files to be replaced, got %+v (%v)", report, err)
+	}
+	if images, _ := storage.LoadLibrary(); len(images) != 2 {
+		t.Errorf("Expected the remote item and replaced.jpg, got %+v", images)
+	}
+}
+
+func TestReconcileRepairsOrder(t *testing.T) {
+	storage := setupTestDB(t)
+	for _, url := range []string{"https://example.com/1.jpg", "https://example.com/2.jpg", "https://example.com/3.jpg"} {
+		storage.SaveUrlMetadata(url, model.Url)
+	}
+	// The order lacks the first entry and references the third one twice
+	storage.Db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("order"))
+		bucket.Delete(itob(0))
+		return bucket.Put(itob(5), itob(3))
+	})
+
+	if err := storage.CheckIntegrity(); err == nil {
+		t.Error("Expected the broken order to be detected")
+	}
+
+	report, err := storage.Reconcile()
+	if err != nil || !report.OrderRepaired || len(report.Imported) != 0 || len(report.Removed) != 0 {
+		t.Fatalf("Expected repaired order, got %+v (%v)", report, err)
+	}
+	images, _ := storage.LoadImages()
+	var ids []int
+	for _, img := range images {
+		ids = append(ids, img.Id)
+	}
+	if !reflect.DeepEqual(ids, []int{2, 3, 1}) {
+		t.Errorf("Expected order [2 3 1], got %v", ids)
+	}
+	// New entries are appended after the repaired order
+	added, _ := storage.SaveUrlMetadata("https://example.com/4.jpg", model.Url)
+	if images, _ := storage.LoadImages(); len(images) != 4 || images[3].Id != added.Id {
+		t.Errorf("Expected %d to be appended, got %+v", added.Id, images)
+	}
+}
+
+func TestDeleteImageKeepsIntegrity(t *testing.T) {
+	storage := setupTestDB(t)
+	var ids []int
+	for i, name := range []string{"first.jpg", "second.jpg", "third.jpg", "fourth.jpg"} {
+		writeJpeg(t, name, 4*(i+1), 4*(i+1))
+		img, _ := storage.SaveImageMetadata(name)
+		ids = append(ids, img.Id)
+	}
+	storage.UpdateStatus(func(status *model.Status) error {
+		status.CurrentImageId = ids[1]
+		status.History = []int{ids[0], ids[2], ids[0]}
+		status.OverrideUntil = time.Now().Add(time.Hour)
+		return nil
+	})
+
+	// Deleting the image on screen moves on to the following image
+	if err := storage.DeleteImage(ids[1]); err != nil {
+		t.Fatalf("DeleteImage failed: %v", err)
+	}
+	status, _ := storage.GetCurrentStatus()
+	if status.CurrentImageId != ids[2] || !status.OverrideUntil.IsZero() {
+		t.Errorf("Expected image %d on screen without hold, got %+v", ids[2], status)
+	}
+	if lastShown, _ := storage.LoadLastShown(); !lastShown[ids[2]].Equal(status.LastSwitch) {
+		t.Errorf("Expected image %d to be recorded as shown", ids[2])
+	}
+
+	// Deleting another image removes it from the history, a missing file does not prevent the deletion
+	os.Remove(filepath.Join("images", "first.jpg"))
+	if err := storage.DeleteImage(ids[0]); err != nil {
+		t.Fatalf("DeleteImage of missing file failed: %v", err)
+	}
+	status, _ = storage.GetCurrentStatus()
+	if status.CurrentImageId != ids[2] || !reflect.DeepEqual(status.History, []int{ids[2]}) {
+		t.Errorf("Expected image %d with cleaned history, got %+v", ids[2], status)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+
+	// The order is compacted, so new images are appended and the rotation wraps around
+	added, _ := storage.SaveUrlMetadata("https://example.com/photo.jpg", model.Url)
+	images, _ := storage.LoadImages()
+	if len(images) != 3 || images[0].Id != ids[2] || images[1].Id != ids[3] || images[2].Id != added.Id {
+		t.Errorf("Expected images %d, %d and %d, got %+v", ids[2], ids[3], added.Id, images)
+	}
+	if next, err := storage.LoadNextImage(added.Id); err != nil || next.Id != ids[2] {
+		t.Errorf("Expected image %d after the last one, got %d (%v)", ids[2], next.Id, err)
+	}
+	// Unknown images start the rotation over
+	if next, err := storage.LoadNextImage(ids[0]); err != nil || next.Id != ids[2] {
+		t.Errorf("Expected image %d after a deleted one, got %d (%v)", ids[2], next.Id, err)
+	}
+
+	// Deleting the last remaining images leaves no image on screen
+	for _, id := range []int{ids[2], ids[3], added.Id} {
+		storage.DeleteImage(id)
+	}
+	if status, _ := storage.GetCurrentStatus(); status.CurrentImageId != -1 {
+		t.Errorf("Expected no image on screen, got %d", status.CurrentImageId)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	storage := setupTestDB(t)
+	first, _ := storage.SaveUrlMetadata("https://example.com/1.jpg", model.Url)
+	storage.SaveUrlMetadata("https://example.com/2.jpg", model.Url)
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Fatalf("Expected a consistent database, got %v", err)
+	}
+
+	storage.Db.Update(func(tx *bolt.Tx) error {
+		tx.Bucket([]byte("order")).Put(itob(5), itob(9))
+		tx.Bucket([]byte("hashes")).Put([]byte("0000"), itob(first.Id))
+		tx.Bucket([]byte("lastShown")).Put(itob(8), []byte(`"2024-01-01T00:00:00Z"`))
+		return nil
+	})
+	storage.UpdateStatus(func(status *model.Status) error {
+		status.CurrentImageId = 7
+		return nil
+	})
+	err := storage.CheckIntegrity()
+	if err == nil {
+		t.Fatal("Expected violations")
+	}
+	for _, violation := range []string{"order key 5 at position 2", "order references missing image 9", "hash 0000", "display time of missing image 8", "current image 7 is missing"} {
+		if !strings.Contains(err.Error(), violation) {
+			t.Errorf("Expected violation %q, got %v", violation, err)
+		}
+	}
+}
+
+func TestTrash(t *testing.T) {
+	storage := setupTestDB(t)
+	writeJpeg(t, "first.jpg", 4, 4)
+	writeJpeg(t, "second.jpg", 8, 8)
+	first, _ := storage.SaveImageMetadata("first.jpg")
+	second, _ := storage.SaveImageMetadata("second.jpg")
+	remote, _ := storage.SaveUrlMetadata("https://example.com/photo.jpg", model.Url)
+	storage.UpdateImage(model.Image{Id: first.Id, Path: first.Path, Type: first.Type, Hash: first.Hash, Weight: 3})
+
+	// Deleted images leave the library and their files are kept in the trash
+	before := time.Now()
+	for _, id := range []int{first.Id, remote.Id} {
+		if err := storage.DeleteImage(id); err != nil {
+			t.Fatalf("DeleteImage failed: %v", err)
+		}
+	}
+	if images, _ := storage.LoadImages(); len(images) != 1 || images[0].Id != second.Id {
+		t.Errorf("Expected only second.jpg in the library, got %+v", images)
+	}
+	if files := imageFiles(t); !reflect.DeepEqual(files, []string{"second.jpg"}) {
+		t.Errorf("Expected first.jpg to be moved, got %v", files)
+	}
+	trash, _ := storage.LoadTrash()
+	if len(trash) != 2 || trash[0].Id != remote.Id || trash[1].Id != first.Id || trash[1].TrashedAt.Before(before) {
+		t.Fatalf("Expected both images in the trash, most recent first, got %+v", trash)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+
+	// Restored images keep their ID and settings, the file name is made unique if it has been taken
+	writeJpeg(t, "first.jpg", 12, 12)
+	storage.SaveImageMetadata("first.jpg")
+	restored, err := storage.RestoreImage(first.Id)
+	if err != nil || restored.Id != first.Id || restored.Path != "first-1.jpg" || restored.Weight != 3 || !restored.TrashedAt.IsZero() {
+		t.Errorf("Expected first.jpg restored as first-1.jpg, got %+v (%v)", restored, err)
+	}
+	images, _ := storage.LoadImages()
+	if len(images) != 3 || images[2].Id != first.Id {
+		t.Errorf("Expected restored image at the end, got %+v", images)
+	}
+	if _, err := storage.RestoreImage(first.Id); !errors.Is(err, persistence.ErrNotInTrash) {
+		t.Errorf("Expected ErrNotInTrash, got %v", err)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+
+	// Content stored again since the deletion cannot be restored
+	storage.DeleteImage(second.Id)
+	writeJpeg(t, "again.jpg", 8, 8)
+	again, _ := storage.SaveImageMetadata("again.jpg")
+	if existing, err := storage.RestoreImage(second.Id); !errors.Is(err, persistence.ErrDuplicateImage) || existing.Id != again.Id {
+		t.Errorf("Expected duplicate of again.jpg, got %+v (%v)", existing, err)
+	}
+	if _, err := os.Stat(filepath.Join("trash", strconv.Itoa(second.Id)+"-second.jpg")); err != nil {
+		t.Errorf("Expected the file to stay in the trash: %v", err)
+	}
+
+	// Purging deletes the files for good
+	if err := storage.PurgeImage(second.Id); err != nil {
+		t.Errorf("PurgeImage failed: %v", err)
+	}
+	if err := storage.PurgeImage(second.Id); !errors.Is(err, persistence.ErrNotInTrash) {
+		t.Errorf("Expected ErrNotInTrash, got %v", err)
+	}
+	if purged, err := storage.PurgeTrash(before); err != nil || len(purged) != 0 {
+		t.Errorf("Expected nothing deleted before %v to be purged, got %+v (%v)", before, purged, err)
+	}
+	if purged, err := storage.PurgeTrash(time.Now()); err != nil || len(purged) != 1 || purged[0].Id != remote.Id {
+		t.Errorf("Expected the remote item to be purged, got %+v (%v)", purged, err)
+	}
+	if entries, _ := os.ReadDir("trash"); len(entries) != 0 {
+		t.Errorf("Expected an empty trash directory, got %d files", len(entries))
+	}
+}
+
+func TestTrashKeepsAlbums(t *testing.T) {
+	storage := setupTestDB(t)
+	writeJpeg(t, "first.jpg", 4, 4)
+	writeJpeg(t, "second.jpg", 8, 8)
+	first, _ := storage.SaveImageMetadata("first.jpg")
+	second, _ := storage.SaveImageMetadata("second.jpg")
+	family, _ := storage.CreateAlbum("Family")
+	storage.SetAlbumImages(family.Id, []int{first.Id, second.Id})
+	removed, _ := storage.CreateAlbum("Removed")
+	storage.AddToAlbum(removed.Id, first.Id)
+
+	// Restored images rejoin their albums at the end, deleted albums are skipped
+	storage.DeleteImage(first.Id)
+	if album, _ := storage.LoadAlbum(family.Id); !reflect.DeepEqual(album.ImageIds, []int{second.Id}) {
+		t.Errorf("Expected only second.jpg in the album, got %v", album.ImageIds)
+	}
+	storage.DeleteAlbum(removed.Id)
+	if _, err := storage.RestoreImage(first.Id); err != nil {
+		t.Fatalf("RestoreImage failed: %v", err)
+	}
+	if album, _ := storage.LoadAlbum(family.Id); !reflect.DeepEqual(album.ImageIds, []int{second.Id, first.Id}) {
+		t.Errorf("Expected first.jpg back in the album, got %v", album.ImageIds)
+	}
+	if restored, _ := storage.LoadImage(first.Id); len(restored.Albums) != 0 {
+		t.Errorf("Expected no albums recorded in the library, got %v", restored.Albums)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+}
+
+func TestDeleteImageWithUnmovableFile(t *testing.T) {
+	storage := setupTestDB(t)
+	writeJpeg(t, "first.jpg", 4, 4)
+	first, _ := storage.SaveImageMetadata("first.jpg")
+	family, _ := storage.CreateAlbum("Family")
+	storage.AddToAlbum(family.Id, first.Id)
+
+	// A directory in place of the file in the trash makes moving the file fail, the image is restored
+	if err := os.MkdirAll(filepath.Join("trash", strconv.Itoa(first.Id)+"-first.jpg", "blocking"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.DeleteImage(first.Id); err == nil {
+		t.Fatal("Expected DeleteImage to fail")
+	}
+	if images, _ := storage.LoadImages(); len(images) != 1 || images[0].Id != first.Id {
+		t.Errorf("Expected first.jpg in the library, got %+v", images)
+	}
+	if album, _ := storage.LoadAlbum(family.Id); !reflect.DeepEqual(album.ImageIds, []int{first.Id}) {
+		t.Errorf("Expected first.jpg in the album, got %v", album.ImageIds)
+	}
+	if trash, _ := storage.LoadTrash(); len(trash) != 0 {
+		t.Errorf("Expected an empty trash, got %+v", trash)
+	}
+	if files := imageFiles(t); !reflect.DeepEqual(files, []string{"first.jpg"}) {
+		t.Errorf("Expected first.jpg to stay, got %v", files)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+}
+
+func TestTrashWithBlockedFiles(t *testing.T) {
+	storage := setupTestDB(t)
+	writeJpeg(t, "first.jpg", 4, 4)
+	writeJpeg(t, "second.jpg", 8, 8)
+	first, _ := storage.SaveImageMetadata("first.jpg")
+	second, _ := storage.SaveImageMetadata("second.jpg")
+	storage.DeleteImage(first.Id)
+	storage.DeleteImage(second.Id)
+
+	// A directory in place of the file in the trash cannot be moved or removed
+	blocked := filepath.Join("trash", strconv.Itoa(first.Id)+"-first.jpg")
+	os.Remove(blocked)
+	if err := os.MkdirAll(filepath.Join(blocked, "blocking"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed restore leaves the image in the trash
+	if _, err := storage.RestoreImage(first.Id); err == nil {
+		t.Error("Expected RestoreImage to fail")
+	}
+	if images, _ := storage.LoadImages(); len(images) != 0 {
+		t.Errorf("Expected an empty library, got %+v", images)
+	}
+	if files := imageFiles(t); len(files) != 0 {
+		t.Errorf("Expected no files in the library, got %v", files)
+	}
+	if trash, _ := storage.LoadTrash(); len(trash) != 2 {
+		t.Errorf("Expected both images in the trash, got %+v", trash)
+	}
+
+	// A failed removal keeps the entry for the next purge, the other images are purged
+	purged, err := storage.PurgeTrash(time.Now())
+	if err == nil || len(purged) != 1 || purged[0].Id != second.Id {
+		t.Errorf("Expected only second.jpg to be purged, got %+v (%v)", purged, err)
+	}
+	if trash, _ := storage.LoadTrash(); len(trash) != 1 || trash[0].Id != first.Id {
+		t.Errorf("Expected first.jpg to stay in the trash, got %+v", trash)
+	}
+	if _, err := os.Stat(filepath.Join("trash", strconv.Itoa(second.Id)+"-second.jpg")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the file of second.jpg to be removed, got %v", err)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+}
+
+func TestAlbums(t *testing.T) {
+	storage := setupTestDB(t)
+	var ids []int
+	for i := 1; i <= 4; i++ {
+		img, _ := storage.SaveUrlMetadata("https://example.com/"+strconv.Itoa(i)+".jpg", model.Url)
+		ids = append(ids, img.Id)
+	}
+	christmas, _ := storage.CreateAlbum("Christmas")
+	kids, _ := storage.CreateAlbum("Kids")
+
+	// Images can belong to several albums, in an order of their own
+	album, err := storage.SetAlbumImages(christmas.Id, []int{ids[3], ids[1], ids[3]})
+	if err != nil || !reflect.DeepEqual(album.ImageIds, []int{ids[3], ids[1]}) {
+		t.Errorf("Expected images %d and %d, got %+v (%v)", ids[3], ids[1], album, err)
+	}
+	storage.AddToAlbum(kids.Id, ids[1])
+	storage.AddToAlbum(kids.Id, ids[2])
+	if album, _ := storage.AddToAlbum(kids.Id, ids[1]); !reflect.DeepEqual(album.ImageIds, []int{ids[1], ids[2]}) {
+		t.Errorf("Expected images to be added once, got %v", album.ImageIds)
+	}
+	if _, err := storage.AddToAlbum(kids.Id, 99); !errors.Is(err, persistence.ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound, got %v", err)
+	}
+	if _, err := storage.SetAlbumImages(99, nil); !errors.Is(err, persistence.ErrAlbumNotFound) {
+		t.Errorf("Expected ErrAlbumNotFound, got %v", err)
+	}
+	renamed, _ := storage.RenameAlbum(christmas.Id, "Christmas 2025")
+	if albums, _ := storage.LoadAlbums(); len(albums) != 2 || albums[0].Name != "Christmas 2025" || !reflect.DeepEqual(albums[0].ImageIds, renamed.ImageIds) {
+		t.Errorf("Expected the renamed album first, got %+v", albums)
+	}
+
+	// The rotation shows the active album, the library stays complete
+	config, _ := storage.GetConfiguration()
+	config.ActiveAlbum = christmas.Id
+	storage.UpdateConfiguration(config)
+	if images, _ := storage.LoadImages(); len(images) != 2 || images[0].Id != ids[3] {
+		t.Errorf("Expected the album images, got %+v", images)
+	}
+	if library, _ := storage.LoadLibrary(); len(library) != 4 {
+		t.Errorf("Expected 4 images in the library, got %d", len(library))
+	}
+	if next, _ := storage.LoadNextImage(ids[1]); next.Id != ids[3] {
+		t.Errorf("Expected image %d after %d, got %d", ids[3], ids[1], next.Id)
+	}
+	for i := 0; i < 4; i++ {
+		if next, _ := storage.LoadNextShuffledImage(-1); next.Id != ids[1] && next.Id != ids[3] {
+			t.Errorf("Expected a shuffled image of the album, got %d", next.Id)
+		}
+	}
+	if _, err := storage.ReorderAlbum(christmas.Id, []int{ids[1], ids[0]}); !errors.Is(err, persistence.ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound for an image outside the album, got %v", err)
+	}
+	if album, _ := storage.ReorderAlbum(christmas.Id, []int{ids[1]}); !reflect.DeepEqual(album.ImageIds, []int{ids[1], ids[3]}) {
+		t.Errorf("Expected the album to be reordered, got %v", album.ImageIds)
+	}
+	if images, _ := storage.LoadAlbumImages(christmas.Id); len(images) != 2 || images[0].Id != ids[1] {
+		t.Errorf("Expected the reordered album images, got %+v", images)
+	}
+	if library, _ := storage.LoadLibrary(); library[0].Id != ids[0] {
+		t.Errorf("Expected the library order to stay, got %+v", library)
+	}
+
+	// Without album, the active album is reordered
+	storage.ReorderImages([]model.Image{{Id: ids[3]}})
+	if album, _ := storage.LoadAlbum(christmas.Id); !reflect.DeepEqual(album.ImageIds, []int{ids[3], ids[1]}) {
+		t.Errorf("Expected image %d in front of the active album, got %v", ids[3], album.ImageIds)
+	}
+	if library, _ := storage.LoadLibrary(); library[0].Id != ids[0] {
+		t.Errorf("Expected the library order to stay, got %+v", library)
+	}
+	if err := storage.ReorderImages([]model.Image{{Id: ids[0]}}); !errors.Is(err, persistence.ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound for an image outside the active album, got %v", err)
+	}
+	if err := storage.ReorderImages([]model.Image{{Id: 999}}); !errors.Is(err, persistence.ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound for an unknown image, got %v", err)
+	}
+
+	// Deleted images leave all albums, deleted albums leave the rotation
+	storage.DeleteImage(ids[1])
+	if album, _ := storage.RemoveFromAlbum(kids.Id, ids[2]); len(album.ImageIds) != 0 {
+		t.Errorf("Expected an empty album, got %v", album.ImageIds)
+	}
+	if album, _ := storage.LoadAlbum(christmas.Id); !reflect.DeepEqual(album.ImageIds, []int{ids[3]}) {
+		t.Errorf("Expected only image %d, got %v", ids[3], album.ImageIds)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+	if err := storage.DeleteAlbum(christmas.Id); err != nil {
+		t.Fatalf("DeleteAlbum failed: %v", err)
+	}
+	if config, _ := storage.GetConfiguration(); config.ActiveAlbum != 0 {
+		t.Errorf("Expected no active album, got %d", config.ActiveAlbum)
+	}
+	if images, _ := storage.LoadImages(); len(images) != 3 {
+		t.Errorf("Expected all 3 images, got %d", len(images))
+	}
+	if _, err := storage.LoadAlbum(christmas.Id); !errors.Is(err, persistence.ErrAlbumNotFound) {
+		t.Errorf("Expected ErrAlbumNotFound, got %v", err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	storage := setupTestDB(t)
+	var ids []int
+	for i := 1; i <= 3; i++ {
+		img, _ := storage.SaveUrlMetadata("https://example.com/"+strconv.Itoa(i)+".jpg", model.Url)
+		ids = append(ids, img.Id)
+	}
+
+	// Tags are normalized and added once
+	images, err := storage.TagImages([]int{ids[0], ids[2]}, []string{"Family", "beach", "family"}, nil)
+	if err != nil || len(images) != 2 || !reflect.DeepEqual(images[0].Tags, []string{"beach", "family"}) {
+		t.Fatalf("Expected tags beach and family, got %+v (%v)", images, err)
+	}
+	storage.TagImages([]int{ids[1]}, []string{"family", "screenshots"}, nil)
+	if images, _ := storage.TagImages([]int{ids[2]}, []string{"winter"}, []string{"BEACH"}); !reflect.DeepEqual(images[0].Tags, []string{"family", "winter"}) {
+		t.Errorf("Expected tags family and winter, got %v", images[0].Tags)
+	}
+	if _, err := storage.TagImages([]int{ids[0], 99}, []string{"lost"}, nil); !errors.Is(err, persistence.ErrImageNotFound) {
+		t.Errorf("Expected ErrImageNotFound, got %v", err)
+	}
+	if _, err := storage.TagImages([]int{ids[0]}, []string{"two words"}, nil); !errors.Is(err, tagging.ErrInvalidTag) {
+		t.Errorf("Expected ErrInvalidTag, got %v", err)
+	}
+	if img, _ := storage.LoadImage(ids[0]); !reflect.DeepEqual(img.Tags, []string{"beach", "family"}) {
+		t.Errorf("Expected failed changes to be rolled back, got %v", img.Tags)
+	}
+
+	// The index finds images carrying all tags, in the defined order
+	if found, _ := storage.FindByTags([]string{"family"}); len(found) != 3 || found[0].Id != ids[0] {
+		t.Errorf("Expected all images, got %+v", found)
+	}
+	if found, _ := storage.FindByTags([]string{"FAMILY", "winter"}); len(found) != 1 || found[0].Id != ids[2] {
+		t.Errorf("Expected image %d, got %+v", ids[2], found)
+	}
+	if tags, _ := storage.LoadTags(); !reflect.DeepEqual(tags, map[string]int{"beach": 1, "family": 3, "screenshots": 1, "winter": 1}) {
+		t.Errorf("Unexpected tag counts %v", tags)
+	}
+
+	// Deleted images leave the index and return with their tags
+	storage.DeleteImage(ids[2])
+	if tags, _ := storage.LoadTags(); tags["winter"] != 0 || tags["family"] != 2 {
+		t.Errorf("Expected the tags of the deleted image to be removed, got %v", tags)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+	storage.RestoreImage(ids[2])
+	if found, _ := storage.FindByTags([]string{"winter"}); len(found) != 1 {
+		t.Errorf("Expected the restored image to be tagged, got %+v", found)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
+}
+
+func TestSmartAlbums(t *testing.T) {
+	storage := setupTestDB(t)
+	var ids []int
+	for i := 1; i <= 3; i++ {
+		img, _ := storage.SaveUrlMetadata("https://example.com/"+strconv.Itoa(i)+".jpg", model.Url)
+		ids = append(ids, img.Id)
+	}
+	storage.TagImages([]int{ids[0], ids[2]}, []string{"family"}, nil)
+	album, _ := storage.CreateAlbum("Favorites")
+
+	if _, err := storage.SetAlbumRules(album.Id, &model.AlbumRules{Tags: "family AND"}); !errors.Is(err, smartalbum.ErrInvalidRules) {
+		t.Errorf("Expected ErrInvalidRules, got %v", err)
+	}
+	album, err := storage.SetAlbumRules(album.Id, &model.AlbumRules{Tags: "family", MinRating: 3})
+	if err != nil || len(album.ImageIds) != 0 || album.Rules == nil {
+		t.Fatalf("Expected an empty smart album, got %+v (%v)", album, err)
+	}
+
+	// Membership follows edits of the images, in the order they join the album
+	for _, id := range []int{ids[2], ids[1], ids[0]} {
+		img, _ := storage.LoadImage(id)
+		img.Rating = 4
+		storage.UpdateImage(img)
+	}
+	if album, _ := storage.LoadAlbum(album.Id); !reflect.DeepEqual(album.ImageIds, []int{ids[2], ids[0]}) {
+		t.Errorf("Expected images %d and %d, got %v", ids[2], ids[0], album.ImageIds)
+	}
+	storage.TagImages([]int{ids[2]}, nil, []string{"family"})
+	storage.TagImages([]int{ids[1]}, []string{"family"}, nil)
+	if album, _ := storage.LoadAlbum(album.Id); !reflect.DeepEqual(album.ImageIds, []int{ids[0], ids[1]}) {
+		t.Errorf("Expected images %d and %d, got %v", ids[0], ids[1], album.ImageIds)
+	}
+
+	// New images join the album, deleted images leave it
+	config, _ := storage.GetConfiguration()
+	config.ActiveAlbum = album.Id
+	storage.UpdateConfiguration(config)
+	recent, _ := storage.SaveUrlMetadata("https://example.com/4.jpg", model.Url)
+	storage.TagImages([]int{recent.Id}, []string{"family"}, nil)
+	if album, _ := storage.LoadAlbum(album.Id); len(album.ImageIds) != 2 {
+		t.Errorf("Expected the unrated image to stay out, got %v", album.ImageIds)
+	}
+	if _, err := storage.SetAlbumRules(album.Id, &model.AlbumRules{Tags: "family", UploadedFrom: recent.UploadedAt}); err != nil {
+		t.Fatalf("SetAlbumRules failed: %v", err)
+	}
+	if images, _ := storage.LoadImages(); len(images) != 1 || images[0].Id != recent.Id {
+		t.Errorf("Expected the rotation to show image %d, got %+v", recent.Id, images)
+	}
+	storage.DeleteImage(recent.Id)
+	if images, _ := storage.LoadImages(); len(images) != 0 {
+		t.Errorf("Expected the deleted image to leave the album, got %+v", images)
+	}
+	storage.RestoreImage(recent.Id)
+	if images, _ := storage.LoadImages(); len(images) != 1 {
+		t.Errorf("Expected the restored image to return, got %+v", images)
+	}
+
+	// Images of smart albums are not chosen by hand, unless the rules are removed
+	if _, err := storage.AddToAlbum(album.Id, ids[2]); !errors.Is(err, persistence.ErrSmartAlbum) {
+		t.Errorf("Expected ErrSmartAlbum, got %v", err)
+	}
+	if _, err := storage.ReorderAlbum(album.Id, nil); !errors.Is(err, persistence.ErrSmartAlbum) {
+		t.Errorf("Expected ErrSmartAlbum for reordering, got %v", err)
+	}
+	if err := storage.ReorderImages([]model.Image{recent}); !errors.Is(err, persistence.ErrSmartAlbum) {
+		t.Errorf("Expected ErrSmartAlbum for reordering the active album, got %v", err)
+	}
+	album, err = storage.SetAlbumRules(album.Id, nil)
+	if err != nil || album.Rules != nil || !reflect.DeepEqual(album.ImageIds, []int{recent.Id}) {
+		t.Errorf("Expected a manual album keeping image %d, got %+v (%v)", recent.Id, album, err)
+	}
+	if _, err := storage.AddToAlbum(album.Id, ids[2]); err != nil {
+		t.Errorf("AddToAlbum failed: %v", err)
+	}
+	if err := storage.CheckIntegrity(); err != nil {
+		t.Errorf("Expected a consistent database, got %v", err)
+	}
 }
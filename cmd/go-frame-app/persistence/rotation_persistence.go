@@ -0,0 +1,61 @@
+package persistence
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// txView gives access to images and configuration within a single transaction.
+type txView struct {
+	tx *bolt.Tx
+}
+
+func (v txView) LoadImages() ([]model.Image, error) {
+	return loadImages(v.tx)
+}
+
+func (v txView) LoadImage(id int) (model.Image, error) {
+	return loadImage(v.tx, id)
+}
+
+func (v txView) LoadNextImage(id int) (model.Image, error) {
+	return loadNextImage(v.tx, id)
+}
+
+func (v txView) LoadNextShuffledImage(id int) (model.Image, error) {
+	return loadNextShuffledImage(v.tx, id)
+}
+
+func (v txView) LoadLastShown() (map[int]time.Time, error) {
+	return loadLastShown(v.tx)
+}
+
+func (v txView) GetConfiguration() (model.Config, error) {
+	return loadConfiguration(v.tx)
+}
+
+// Transition applies a status transition within a single transaction. The transition reads images
+// and configuration through the given view, which is bound to the same transaction, so concurrent
+// transitions cannot interleave.
+//
+// Parameters:
+//   - transition: The function modifying the status. Returning an error aborts the transition.
+//
+// Returns:
+//   - error: An error if the transition or the status update fails.
+func (s *Storage) Transition(transition func(view model.RotationView, status *model.Status) error) error {
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		previous, err := loadStatus(tx)
+		if err != nil {
+			return err
+		}
+		status := previous
+		status.History = append([]int(nil), previous.History...)
+		if err := transition(txView{tx: tx}, &status); err != nil {
+			return err
+		}
+		return saveStatus(tx, previous, status)
+	})
+}
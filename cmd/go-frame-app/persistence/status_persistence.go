@@ -1,7 +1,9 @@
 package persistence
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"slices"
 	"time"
 
 	bolt "go.etcd.io/bbolt"
@@ -14,12 +16,16 @@ const (
 )
 
 var statusBucketName = []byte("status")
+var lastShownBucketName = []byte("lastShown")
 
 func initStatusBuckets(tx *bolt.Tx) error {
 	statusBucket, err := tx.CreateBucketIfNotExists(statusBucketName)
 	if err != nil {
 		return err
 	}
+	if _, err := tx.CreateBucketIfNotExists(lastShownBucketName); err != nil {
+		return err
+	}
 	if isBucketEmpty(statusBucket) {
 		err = prepopulateStatus(statusBucket)
 	}
@@ -43,14 +49,58 @@ func prepopulateStatus(statusBucket *bolt.Bucket) error {
 func (s *Storage) GetCurrentStatus() (model.Status, error) {
 	var status model.Status
 	err := s.Db.View(func(tx *bolt.Tx) error {
-		statusBucket := tx.Bucket(statusBucketName)
-		statusBytes := statusBucket.Get([]byte(CurrentStatusKey))
-		return json.Unmarshal(statusBytes, &status)
+		var err error
+		status, err = loadStatus(tx)
+		return err
 	})
 	return status, err
 }
 
+func loadStatus(tx *bolt.Tx) (model.Status, error) {
+	var status model.Status
+	statusBytes := tx.Bucket(statusBucketName).Get([]byte(CurrentStatusKey))
+	err := json.Unmarshal(statusBytes, &status)
+	return status, err
+}
+
+// saveStatus stores the status. If the image was switched compared to the previous status,
+// the switch time is recorded as the time the new image was last shown.
+func saveStatus(tx *bolt.Tx, previous model.Status, status model.Status) error {
+	newStatus, _ := json.Marshal(status)
+	if err := tx.Bucket(statusBucketName).Put([]byte(CurrentStatusKey), newStatus); err != nil {
+		return err
+	}
+	if status.CurrentImageId < 0 || (status.CurrentImageId == previous.CurrentImageId && status.LastSwitch.Equal(previous.LastSwitch)) {
+		return nil
+	}
+	lastShown, _ := json.Marshal(status.LastSwitch)
+	return tx.Bucket(lastShownBucketName).Put(itob(status.CurrentImageId), lastShown)
+}
+
+// releaseStatus removes the image from the status before it is removed. If the image is on screen,
+// the image following it in the defined order is shown instead.
+func releaseStatus(tx *bolt.Tx, id int) error {
+	status, err := loadStatus(tx)
+	if err != nil {
+		return err
+	}
+	previous := status
+	status.History = slices.DeleteFunc(slices.Clone(status.History), func(historyId int) bool {
+		return historyId == id
+	})
+	if status.CurrentImageId == id {
+		status.CurrentImageId = -1
+		status.OverrideUntil = time.Time{}
+		if next, err := loadNextImage(tx, id); err == nil && next.Id != id {
+			status.CurrentImageId = next.Id
+			status.LastSwitch = time.Now()
+		}
+	}
+	return saveStatus(tx, previous, status)
+}
+
 // UpdateImageStatus updates the current image ID and resets the switch timer.
+// The switch time is also recorded as the time the image was last shown.
 //
 // Parameters:
 //   - newId: The ID of the image now being displayed.
@@ -58,16 +108,52 @@ func (s *Storage) GetCurrentStatus() (model.Status, error) {
 // Returns:
 //   - error: An error if the status update fails.
 func (s *Storage) UpdateImageStatus(newId int) error {
-	return s.Db.Update(func(tx *bolt.Tx) error {
-		statusBucket := tx.Bucket(statusBucketName)
-		statusBytes := statusBucket.Get([]byte(CurrentStatusKey))
-		var status model.Status
-		if err := json.Unmarshal(statusBytes, &status); err != nil {
-			return err
-		}
+	return s.UpdateStatus(func(status *model.Status) error {
 		status.CurrentImageId = newId
 		status.LastSwitch = time.Now()
-		newStatus, _ := json.Marshal(status)
-		return statusBucket.Put([]byte(CurrentStatusKey), newStatus)
+		return nil
+	})
+}
+
+// UpdateStatus applies a modification to the current status within a single transaction.
+// If the modification switches the image, the switch time is recorded as the time the new image was last shown.
+//
+// Parameters:
+//   - update: The function modifying the status. Returning an error aborts the update.
+//
+// Returns:
+//   - error: An error if the modification or the status update fails.
+func (s *Storage) UpdateStatus(update func(status *model.Status) error) error {
+	return s.Transition(func(view model.RotationView, status *model.Status) error {
+		return update(status)
+	})
+}
+
+// LoadLastShown retrieves the time each image was last displayed.
+// Images that have never been displayed are not contained in the result.
+//
+// Returns:
+//   - map[int]time.Time: The last display time, keyed by image ID.
+//   - error: An error if retrieval fails.
+func (s *Storage) LoadLastShown() (map[int]time.Time, error) {
+	var lastShown map[int]time.Time
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		var err error
+		lastShown, err = loadLastShown(tx)
+		return err
+	})
+	return lastShown, err
+}
+
+func loadLastShown(tx *bolt.Tx) (map[int]time.Time, error) {
+	lastShown := make(map[int]time.Time)
+	err := tx.Bucket(lastShownBucketName).ForEach(func(key, value []byte) error {
+		var shown time.Time
+		if err := json.Unmarshal(value, &shown); err != nil {
+			return err
+		}
+		lastShown[int(binary.BigEndian.Uint64(key))] = shown
+		return nil
 	})
+	return lastShown, err
 }
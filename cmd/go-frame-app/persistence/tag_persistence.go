@@ -0,0 +1,184 @@
+package persistence
+
+import (
+	"encoding/json"
+	"slices"
+
+	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/tagging"
+)
+
+// tagBucketName is the bucket indexing the images by their tags.
+// It holds one nested bucket per tag, whose keys are the IDs of the tagged images.
+var tagBucketName = []byte("tags")
+
+func initTagBucket(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(tagBucketName)
+	return err
+}
+
+// indexTags records the image under each of its tags.
+func indexTags(tx *bolt.Tx, image model.Image) error {
+	tagBucket := tx.Bucket(tagBucketName)
+	for _, tag := range image.Tags {
+		taggedBucket, err := tagBucket.CreateBucketIfNotExists([]byte(tag))
+		if err != nil {
+			return err
+		}
+		if err := taggedBucket.Put(itob(image.Id), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexTags removes the image from the index of each of its tags. Tags without images are dropped.
+func unindexTags(tx *bolt.Tx, image model.Image) error {
+	tagBucket := tx.Bucket(tagBucketName)
+	for _, tag := range image.Tags {
+		taggedBucket := tagBucket.Bucket([]byte(tag))
+		if taggedBucket == nil {
+			continue
+		}
+		if err := taggedBucket.Delete(itob(image.Id)); err != nil {
+			return err
+		}
+		if isBucketEmpty(taggedBucket) {
+			if err := tagBucket.DeleteBucket([]byte(tag)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadTags retrieves all tags in use, together with the number of tagged images.
+//
+// Returns:
+//   - map[string]int: The number of images per tag.
+//   - error: An error if the database read fails.
+func (s *Storage) LoadTags() (map[string]int, error) {
+	tags := map[string]int{}
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		tagBucket := tx.Bucket(tagBucketName)
+		return tagBucket.ForEach(func(key, value []byte) error {
+			if count := tagBucket.Bucket(key).Stats().KeyN; count > 0 {
+				tags[string(key)] = count
+			}
+			return nil
+		})
+	})
+	return tags, err
+}
+
+// FindByTags retrieves the images carrying all of the given tags, in the defined order of the library.
+//
+// Parameters:
+//   - tags: The tags the images must carry. Tags are normalized, so they match regardless of their case.
+//
+// Returns:
+//   - []Image: The tagged images.
+//   - error: tagging.ErrInvalidTag or an error if the database read fails.
+func (s *Storage) FindByTags(tags []string) ([]model.Image, error) {
+	tags, err := tagging.NormalizeAll(tags)
+	if err != nil {
+		return nil, err
+	}
+	images := []model.Image{}
+	err = s.Db.View(func(tx *bolt.Tx) error {
+		library, err := loadOrderedImages(tx, tx.Bucket(orderBucketName))
+		if err != nil {
+			return err
+		}
+		tagBucket := tx.Bucket(tagBucketName)
+		for _, image := range library {
+			if isTaggedWithAll(tagBucket, image.Id, tags) {
+				images = append(images, image)
+			}
+		}
+		return nil
+	})
+	return images, err
+}
+
+// isTaggedWithAll looks up in the index whether the image carries all tags.
+func isTaggedWithAll(tagBucket *bolt.Bucket, id int, tags []string) bool {
+	for _, tag := range tags {
+		taggedBucket := tagBucket.Bucket([]byte(tag))
+		if taggedBucket == nil || taggedBucket.Get(itob(id)) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// TagImages adds tags to and removes tags from the given images in one step.
+// Tags are normalized, tags that are added and removed at the same time end up removed.
+//
+// Parameters:
+//   - ids: The IDs of the images to change.
+//   - add: The tags to add to every image.
+//   - remove: The tags to remove from every image.
+//
+// Returns:
+//   - []Image: The changed images, in the order of the given IDs.
+//   - error: ErrImageNotFound, tagging.ErrInvalidTag or an error if the database update fails.
+func (s *Storage) TagImages(ids []int, add []string, remove []string) ([]model.Image, error) {
+	add, err := tagging.NormalizeAll(add)
+	if err != nil {
+		return nil, err
+	}
+	remove, err = tagging.NormalizeAll(remove)
+	if err != nil {
+		return nil, err
+	}
+	images := []model.Image{}
+	err = s.Db.Update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			image, err := loadImage(tx, id)
+			if err != nil {
+				return err
+			}
+			tags := slices.Concat(image.Tags, add)
+			tags = slices.DeleteFunc(tags, func(tag string) bool {
+				return slices.Contains(remove, tag)
+			})
+			slices.Sort(tags)
+			image.Tags = slices.Compact(tags)
+			if err := updateImage(tx, image); err != nil {
+				return err
+			}
+			images = append(images, image)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// updateImage stores the changed image and updates its tag index entries and the smart albums.
+func updateImage(tx *bolt.Tx, image model.Image) error {
+	metadataBucket := tx.Bucket(metadataBucketName)
+	imageJson := metadataBucket.Get(itob(image.Id))
+	if imageJson == nil {
+		return ErrImageNotFound
+	}
+	var stored model.Image
+	if err := json.Unmarshal(imageJson, &stored); err != nil {
+		return err
+	}
+	if err := unindexTags(tx, stored); err != nil {
+		return err
+	}
+	imageJson, _ = json.Marshal(image)
+	if err := metadataBucket.Put(itob(image.Id), imageJson); err != nil {
+		return err
+	}
+	if err := indexTags(tx, image); err != nil {
+		return err
+	}
+	return refreshSmartAlbums(tx, image)
+}
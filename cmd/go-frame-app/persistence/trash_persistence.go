@@ -0,0 +1,306 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+const (
+	// TrashDir is the directory where the files of deleted images are kept until they are purged.
+	TrashDir string = "trash"
+)
+
+// trashBucketName is the bucket holding the entries of deleted images, keyed by their former ID.
+var trashBucketName = []byte("trash")
+
+// ErrNotInTrash is returned if a restored or purged image is not in the trash.
+var ErrNotInTrash = errors.New("Image not in trash")
+
+// ErrFileMissing is returned if a deleted image is restored whose file is missing, as a rescan moved it to the trash
+// for its missing file. Such images are restored by the rescan once their file returns.
+var ErrFileMissing = errors.New("File of the image is missing")
+
+func initTrashBucket(tx *bolt.Tx) error {
+	_, err := tx.CreateBucketIfNotExists(trashBucketName)
+	return err
+}
+
+// trashPath returns the path of the file of a deleted image. The ID keeps files of the same name apart.
+func trashPath(image model.Image) string {
+	return filepath.Join(TrashDir, strconv.Itoa(image.Id)+"-"+image.Path)
+}
+
+// trashEntry keeps the entry of a removed image in the trash until it is purged. The file is moved by moveToTrash
+// once the entry is committed. Images whose files are already missing cannot be restored and are not kept.
+func trashEntry(tx *bolt.Tx, image model.Image, now time.Time) error {
+	if !image.Type.IsRemote() {
+		if err := os.MkdirAll(TrashDir, 0755); err != nil {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(ImageDir, image.Path)); errors.Is(err, os.ErrNotExist) {
+			WarningLogger.Println("Not keeping", image.Path, "in the trash as its file is missing")
+			return nil
+		}
+	}
+	return keepInTrash(tx, image, now)
+}
+
+// moveToTrash moves the file of an image whose entry has been moved to the trash. If the file vanished in the
+// meantime, the entry is not kept. If the file cannot be moved, the image is restored, so the library stays consistent.
+func (s *Storage) moveToTrash(image model.Image) error {
+	if image.Type.IsRemote() {
+		return nil
+	}
+	err := os.Rename(filepath.Join(ImageDir, image.Path), trashPath(image))
+	if errors.Is(err, os.ErrNotExist) {
+		WarningLogger.Println("Not keeping", image.Path, "in the trash as its file is missing")
+		return s.Db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(trashBucketName).Delete(itob(image.Id))
+		})
+	}
+	if err != nil {
+		restoreErr := s.Db.Update(func(tx *bolt.Tx) error {
+			return restoreEntry(tx, image)
+		})
+		if restoreErr != nil {
+			ErrorLogger.Println("Cannot restore", image.Path, "after failing to move it to the trash:", restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// keepInTrash stores the entry of a removed image in the trash until it is purged.
+func keepInTrash(tx *bolt.Tx, image model.Image, now time.Time) error {
+	image.TrashedAt = now
+	imageJson, _ := json.Marshal(image)
+	return tx.Bucket(trashBucketName).Put(itob(image.Id), imageJson)
+}
+
+// LoadTrash retrieves the deleted images that have not been purged yet, the most recently deleted first.
+//
+// Returns:
+//   - []Image: The deleted images.
+//   - error: An error if the database read fails.
+func (s *Storage) LoadTrash() ([]model.Image, error) {
+	var images []model.Image
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(trashBucketName).ForEach(func(key, value []byte) error {
+			var image model.Image
+			if err := json.Unmarshal(value, &image); err != nil {
+				return err
+			}
+			images = append(images, image)
+			return nil
+		})
+	})
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].TrashedAt.After(images[j].TrashedAt)
+	})
+	return images, err
+}
+
+// RestoreImage moves a deleted image back into the library, keeping its ID and settings.
+// It is appended to the defined order. If its file name has been taken in the meantime, it is made unique.
+//
+// Parameters:
+//   - id: The ID of the deleted image.
+//
+// Returns:
+//   - Image: The restored Image object, or the image holding the same content.
+//   - error: ErrNotInTrash, ErrDuplicateImage if the content has been stored again, ErrFileMissing or an error if the update fails.
+func (s *Storage) RestoreImage(id int) (model.Image, error) {
+	var image, trashed model.Image
+	reserved := false
+	err := s.Db.Update(func(tx *bolt.Tx) error {
+		var err error
+		trashed, err = loadImageByByteId(itob(id), tx.Bucket(trashBucketName))
+		if err != nil {
+			return ErrNotInTrash
+		}
+		if existing, found := findByHash(tx, trashed.Hash); found {
+			image = existing
+			return ErrDuplicateImage
+		}
+
+		image = trashed
+		image.TrashedAt = time.Time{}
+		if !image.Type.IsRemote() {
+			if _, err := os.Stat(trashPath(trashed)); errors.Is(err, os.ErrNotExist) {
+				return ErrFileMissing
+			}
+			// The name is taken now, the file is moved once the entry is committed
+			if image.Path, err = reserveUniqueName(image.Path); err != nil {
+				return err
+			}
+			reserved = true
+		}
+		return restoreEntry(tx, image)
+	})
+	if err != nil {
+		if reserved {
+			os.Remove(filepath.Join(ImageDir, image.Path))
+		}
+		return image, err
+	}
+	if err := s.moveFromTrash(trashed, image); err != nil {
+		return model.Image{}, err
+	}
+	return image, nil
+}
+
+// moveFromTrash moves the file of a restored image back into the image directory once its entry is committed.
+// If the file cannot be moved, the image returns to the trash, so the library stays consistent.
+func (s *Storage) moveFromTrash(trashed model.Image, image model.Image) error {
+	if image.Type.IsRemote() {
+		return nil
+	}
+	target := filepath.Join(ImageDir, image.Path)
+	err := os.Rename(trashPath(trashed), target)
+	if err == nil {
+		return nil
+	}
+	os.Remove(target)
+	trashErr := s.Db.Update(func(tx *bolt.Tx) error {
+		if err := removeEntry(tx, image); err != nil {
+			return err
+		}
+		return keepInTrash(tx, trashed, trashed.TrashedAt)
+	})
+	if trashErr != nil {
+		ErrorLogger.Println("Cannot return", trashed.Path, "to the trash after failing to restore its file:", trashErr)
+	}
+	return err
+}
+
+// restoreEntry stores the entry of a restored image at the end of the defined order and of the albums it was part of.
+func restoreEntry(tx *bolt.Tx, image model.Image) error {
+	albumIds := image.Albums
+	image.Albums = nil
+	imageJson, _ := json.Marshal(image)
+	if err := tx.Bucket(metadataBucketName).Put(itob(image.Id), imageJson); err != nil {
+		return err
+	}
+	if err := indexHash(tx, image); err != nil {
+		return err
+	}
+	if err := indexTags(tx, image); err != nil {
+		return err
+	}
+	if err := appendToOrder(tx, image.Id); err != nil {
+		return err
+	}
+	if err := rejoinAlbums(tx, image.Id, albumIds); err != nil {
+		return err
+	}
+	if err := refreshSmartAlbums(tx, image); err != nil {
+		return err
+	}
+	if err := invalidateDeck(tx); err != nil {
+		return err
+	}
+	return tx.Bucket(trashBucketName).Delete(itob(image.Id))
+}
+
+// PurgeImage permanently deletes an image from the trash, together with its file.
+//
+// Parameters:
+//   - id: The ID of the deleted image.
+//
+// Returns:
+//   - error: ErrNotInTrash or an error if the file or the entry cannot be removed.
+func (s *Storage) PurgeImage(id int) error {
+	var image model.Image
+	err := s.Db.Update(func(tx *bolt.Tx) error {
+		var err error
+		image, err = loadImageByByteId(itob(id), tx.Bucket(trashBucketName))
+		if err != nil {
+			return ErrNotInTrash
+		}
+		return purgeEntry(tx, image)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.removeTrashFiles([]model.Image{image})
+	return err
+}
+
+// PurgeTrash permanently deletes all images moved to the trash up to the given time, together with their files.
+//
+// Parameters:
+//   - before: The latest deletion time of purged images.
+//
+// Returns:
+//   - []Image: The purged images.
+//   - error: An error if a file or an entry cannot be removed.
+func (s *Storage) PurgeTrash(before time.Time) ([]model.Image, error) {
+	var expired []model.Image
+	err := s.Db.Update(func(tx *bolt.Tx) error {
+		expired = nil
+		err := tx.Bucket(trashBucketName).ForEach(func(key, value []byte) error {
+			var image model.Image
+			if err := json.Unmarshal(value, &image); err == nil && !image.TrashedAt.After(before) {
+				expired = append(expired, image)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, image := range expired {
+			if err := purgeEntry(tx, image); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.removeTrashFiles(expired)
+}
+
+// purgeEntry removes the entry of a deleted image. The file is removed by removeTrashFiles once the entry is committed.
+func purgeEntry(tx *bolt.Tx, image model.Image) error {
+	return tx.Bucket(trashBucketName).Delete(itob(image.Id))
+}
+
+// removeTrashFiles removes the files of purged images. The entries of images whose files cannot be removed are put
+// back into the trash, so a later purge tries again.
+func (s *Storage) removeTrashFiles(images []model.Image) ([]model.Image, error) {
+	var purged, kept []model.Image
+	var errs []error
+	for _, image := range images {
+		if !image.Type.IsRemote() {
+			if err := os.Remove(trashPath(image)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				kept = append(kept, image)
+				errs = append(errs, err)
+				continue
+			}
+		}
+		purged = append(purged, image)
+	}
+	if len(kept) > 0 {
+		err := s.Db.Update(func(tx *bolt.Tx) error {
+			for _, image := range kept {
+				if err := keepInTrash(tx, image, image.TrashedAt); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return purged, errors.Join(errs...)
+}
@@ -0,0 +1,155 @@
+package remote
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/metadata"
+)
+
+const entrySuffix = ".json"
+
+// entry describes the cached copy of a remote image.
+type entry struct {
+	Url          string
+	ETag         string
+	LastModified string
+	FetchedAt    time.Time
+}
+
+// cache stores remote images on disk, next to a JSON file with the validators of the origin.
+type cache struct {
+	dir     string
+	maxSize int64
+	// mu keeps concurrent downloads from evicting at the same time
+	mu sync.Mutex
+}
+
+func (c *cache) dataPath(id int) string {
+	return filepath.Join(c.dir, strconv.Itoa(id))
+}
+
+func (c *cache) entryPath(id int) string {
+	return c.dataPath(id) + entrySuffix
+}
+
+// load returns the cache entry of the item with the given ID, if a complete copy exists.
+func (c *cache) load(id int) (entry, bool) {
+	var cached entry
+	entryBytes, err := os.ReadFile(c.entryPath(id))
+	if err != nil {
+		return cached, false
+	}
+	if err := json.Unmarshal(entryBytes, &cached); err != nil {
+		return cached, false
+	}
+	if _, err := os.Stat(c.dataPath(id)); err != nil {
+		return cached, false
+	}
+	return cached, true
+}
+
+// open opens the cached copy and marks it as recently used.
+func (c *cache) open(id int) (*os.File, error) {
+	now := time.Now()
+	_ = os.Chtimes(c.dataPath(id), now, now)
+	return os.Open(c.dataPath(id))
+}
+
+// store replaces the cached copy of an item. The copy is written to a temporary file first,
+// so an interrupted download or content that is not an image never replaces a complete copy.
+func (c *cache) store(id int, cached entry, body io.Reader, limit int64) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(c.dir, "download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	written, err := io.Copy(temp, io.LimitReader(body, limit+1))
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written > limit {
+		return ErrTooLarge
+	}
+	// The content type of the origin is not trusted, the content has to be an image
+	if mimeType, err := metadata.DetectFileMimeType(temp.Name()); err != nil || !isImage(mimeType) {
+		return ErrNotAnImage
+	}
+	if err := os.Rename(temp.Name(), c.dataPath(id)); err != nil {
+		return err
+	}
+	return c.saveEntry(id, cached)
+}
+
+func (c *cache) saveEntry(id int, cached entry) error {
+	entryBytes, _ := json.Marshal(cached)
+	return os.WriteFile(c.entryPath(id), entryBytes, 0644)
+}
+
+// evict removes the least recently used copies until the cache fits its size limit.
+// The copy of the item with the given ID is kept.
+func (c *cache) evict(keep int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type cachedFile struct {
+		id      int
+		size    int64
+		modTime time.Time
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	var files []cachedFile
+	var total int64
+	for _, dirEntry := range entries {
+		name := dirEntry.Name()
+		if !strings.HasSuffix(name, entrySuffix) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(name, entrySuffix))
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(c.dataPath(id))
+		if err != nil {
+			continue
+		}
+		files = append(files, cachedFile{id: id, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, file := range files {
+		if total <= c.maxSize {
+			return
+		}
+		if file.id == keep {
+			continue
+		}
+		c.remove(file.id)
+		total -= file.size
+	}
+}
+
+// remove deletes the cached copy of the item with the given ID.
+func (c *cache) remove(id int) {
+	os.Remove(c.entryPath(id))
+	os.Remove(c.dataPath(id))
+}
@@ -0,0 +1,274 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/metadata"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+var (
+	WarningLogger *log.Logger
+	InfoLogger    *log.Logger
+	ErrorLogger   *log.Logger
+)
+
+func init() {
+	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	WarningLogger = log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+}
+
+const (
+	// CacheDir is the default directory where remote images are cached on disk.
+	CacheDir = "cache/remote"
+	// DefaultMaxItemSize is the default size limit of a single remote image in bytes.
+	DefaultMaxItemSize int64 = 20 << 20
+	// DefaultMaxCacheSize is the default size limit of the whole cache in bytes.
+	DefaultMaxCacheSize int64 = 512 << 20
+	// DefaultMaxAge is the default time a cached copy is served without asking the origin.
+	DefaultMaxAge = 10 * time.Minute
+)
+
+// ErrTooLarge is returned if a remote image exceeds the size limit.
+var ErrTooLarge = errors.New("Remote image exceeds the size limit")
+
+// ErrNotAnImage is returned if the content of a remote item is not an image.
+var ErrNotAnImage = errors.New("Remote content is not an image")
+
+// Options configures the caching proxy. Zero values use the defaults.
+type Options struct {
+	// CacheDir is the directory holding the cached copies.
+	CacheDir string
+	// MaxItemSize is the size limit of a single remote image in bytes.
+	MaxItemSize int64
+	// MaxCacheSize is the size limit of the whole cache in bytes. The least recently used copies are evicted first.
+	MaxCacheSize int64
+	// MaxAge is the time a cached copy is served before it is revalidated with the origin.
+	MaxAge time.Duration
+	// Client is the HTTP client used to reach the origins.
+	Client *http.Client
+}
+
+// Handler serves remote images from a local cache, so the frame keeps working offline
+// and viewers never contact the origin directly.
+type Handler struct {
+	storage     model.RemoteStorage
+	client      *http.Client
+	cache       *cache
+	maxItemSize int64
+	maxAge      time.Duration
+	mu          sync.Mutex
+	items       map[int]*itemLock
+}
+
+// itemLock serializes the fetches of one item. It is dropped once no fetch waits for it.
+type itemLock struct {
+	sync.Mutex
+	waiting int
+}
+
+// NewHandler creates a new caching proxy for the remote items of the given storage.
+//
+// Parameters:
+//   - storage: The storage holding the remote items.
+//   - options: The cache configuration.
+//
+// Returns:
+//   - *Handler: The caching proxy.
+func NewHandler(storage model.RemoteStorage, options Options) *Handler {
+	if options.CacheDir == "" {
+		options.CacheDir = CacheDir
+	}
+	if options.MaxItemSize <= 0 {
+		options.MaxItemSize = DefaultMaxItemSize
+	}
+	if options.MaxCacheSize <= 0 {
+		options.MaxCacheSize = DefaultMaxCacheSize
+	}
+	if options.MaxAge < 0 {
+		options.MaxAge = 0
+	} else if options.MaxAge == 0 {
+		options.MaxAge = DefaultMaxAge
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Handler{
+		storage:     storage,
+		client:      options.Client,
+		cache:       &cache{dir: options.CacheDir, maxSize: options.MaxCacheSize},
+		maxItemSize: options.MaxItemSize,
+		maxAge:      options.MaxAge,
+		items:       map[int]*itemLock{},
+	}
+}
+
+// RegisterApiEndpoint registers the proxy endpoint on the provided router group.
+//
+// Parameters:
+//   - router: The Gin router group to attach the endpoint to.
+func (h *Handler) RegisterApiEndpoint(router *gin.RouterGroup) {
+	router.GET("/:id", h.serveRemote)
+}
+
+func (h *Handler) serveRemote(context *gin.Context) {
+	id, err := strconv.Atoi(context.Param("id"))
+	if err != nil {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	image, err := h.storage.LoadImage(id)
+	if err != nil || image.Type != model.Url {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	file, err := h.fetch(id, image.Path)
+	if err != nil {
+		ErrorLogger.Println("Cannot fetch remote image", image.Path, ":", err)
+		context.AbortWithError(http.StatusBadGateway, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	// The content type is taken from the content, never from the origin
+	mimeType, err := metadata.DetectMimeType(file)
+	if err != nil || !isImage(mimeType) {
+		context.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	context.Header("Content-Type", mimeType)
+	context.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(context.Writer, context.Request, "", info.ModTime(), file)
+}
+
+// Remove deletes the cached copy of a removed item. Other items are ignored.
+//
+// Parameters:
+//   - image: The removed item.
+func (h *Handler) Remove(image model.Image) {
+	if image.Type != model.Url {
+		return
+	}
+	unlock := h.lock(image.Id)
+	defer unlock()
+	h.cache.remove(image.Id)
+}
+
+// fetch returns the cached copy of a remote image, downloading or revalidating it if required.
+// If the origin fails, a stale copy is served.
+func (h *Handler) fetch(id int, url string) (*os.File, error) {
+	// Only fetches of the same item wait for each other, a slow origin does not block the other items
+	unlock := h.lock(id)
+	defer unlock()
+
+	cached, ok := h.cache.load(id)
+	if ok && cached.Url != url {
+		ok = false
+	}
+	if !ok || time.Since(cached.FetchedAt) >= h.maxAge {
+		var previous *entry
+		if ok {
+			previous = &cached
+		}
+		if _, err := h.download(id, url, previous); err != nil {
+			if !ok {
+				return nil, err
+			}
+			WarningLogger.Println("Serving cached copy of", url, ":", err)
+		}
+	}
+	return h.cache.open(id)
+}
+
+// isImage reports whether the MIME type is the type of an image.
+func isImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// lock acquires the lock of the item with the given ID and returns the function releasing it.
+func (h *Handler) lock(id int) func() {
+	h.mu.Lock()
+	item, ok := h.items[id]
+	if !ok {
+		item = &itemLock{}
+		h.items[id] = item
+	}
+	item.waiting++
+	h.mu.Unlock()
+
+	item.Lock()
+	return func() {
+		item.Unlock()
+		h.mu.Lock()
+		item.waiting--
+		if item.waiting == 0 {
+			delete(h.items, id)
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (h *Handler) download(id int, url string, previous *entry) (entry, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return entry{}, err
+	}
+	if previous != nil {
+		if previous.ETag != "" {
+			request.Header.Set("If-None-Match", previous.ETag)
+		}
+		if previous.LastModified != "" {
+			request.Header.Set("If-Modified-Since", previous.LastModified)
+		}
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return entry{}, err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusNotModified && previous != nil:
+		revalidated := *previous
+		revalidated.FetchedAt = time.Now()
+		return revalidated, h.cache.saveEntry(id, revalidated)
+	case response.StatusCode == http.StatusOK:
+		if response.ContentLength > h.maxItemSize {
+			return entry{}, ErrTooLarge
+		}
+		fetched := entry{
+			Url:          url,
+			ETag:         response.Header.Get("ETag"),
+			LastModified: response.Header.Get("Last-Modified"),
+			FetchedAt:    time.Now(),
+		}
+		if err := h.cache.store(id, fetched, response.Body, h.maxItemSize); err != nil {
+			return entry{}, err
+		}
+		h.cache.evict(id)
+		return fetched, nil
+	default:
+		return entry{}, fmt.Errorf("Origin responded with %s", response.Status)
+	}
+}
@@ -0,0 +1,248 @@
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+)
+
+// remoteImage starts with the signature of a GIF, so its content is recognized as an image.
+const remoteImage = "GIF89a remote image"
+
+// origin is a local image server counting full and conditional requests.
+type origin struct {
+	*httptest.Server
+	body        string
+	downloads   atomic.Int32
+	revalidated atomic.Int32
+}
+
+func newOrigin(t *testing.T, body string) *origin {
+	o := &origin{body: body}
+	o.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			o.revalidated.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		o.downloads.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte(o.body))
+	}))
+	t.Cleanup(o.Close)
+	return o
+}
+
+func setupTestDB(t *testing.T) *persistence.Storage {
+	_ = os.MkdirAll("images", 0755)
+
+	dbPath := filepath.Join(t.TempDir(), "test_remote.db")
+	storage, err := persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open test DB: %v", err)
+	}
+	t.Cleanup(func() {
+		storage.Close()
+		os.RemoveAll("images")
+	})
+	return storage
+}
+
+func setupRouter(storage model.RemoteStorage, options Options) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	NewHandler(storage, options).RegisterApiEndpoint(r.Group("/static/remote"))
+	return r
+}
+
+func get(r *gin.Engine, id int) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/static/remote/"+strconv.Itoa(id), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestServeRemote(t *testing.T) {
+	storage := setupTestDB(t)
+	o := newOrigin(t, remoteImage)
+	item, _ := storage.SaveUrlMetadata(o.URL+"/photo.jpg", model.Url)
+	r := setupRouter(storage, Options{CacheDir: t.TempDir(), MaxAge: -1})
+
+	w := get(r, item.Id)
+	if w.Code != http.StatusOK || w.Body.String() != remoteImage {
+		t.Fatalf("Expected remote image, got %d %q", w.Code, w.Body.String())
+	}
+	// The origin claims a JPEG, but the content type follows the content
+	if contentType := w.Header().Get("Content-Type"); contentType != "image/gif" {
+		t.Errorf("Expected sniffed content type, got %s", contentType)
+	}
+
+	// Without max age, every request revalidates the cached copy
+	w = get(r, item.Id)
+	if w.Code != http.StatusOK || w.Body.String() != remoteImage {
+		t.Errorf("Expected cached image, got %d %q", w.Code, w.Body.String())
+	}
+	if o.downloads.Load() != 1 || o.revalidated.Load() != 1 {
+		t.Errorf("Expected 1 download and 1 revalidation, got %d and %d", o.downloads.Load(), o.revalidated.Load())
+	}
+}
+
+func TestServeRemoteWithinMaxAge(t *testing.T) {
+	storage := setupTestDB(t)
+	o := newOrigin(t, remoteImage)
+	item, _ := storage.SaveUrlMetadata(o.URL+"/photo.jpg", model.Url)
+	r := setupRouter(storage, Options{CacheDir: t.TempDir()})
+
+	get(r, item.Id)
+	get(r, item.Id)
+	if o.downloads.Load() != 1 || o.revalidated.Load() != 0 {
+		t.Errorf("Expected the fresh copy to be served without the origin, got %d downloads and %d revalidations",
+			o.downloads.Load(), o.revalidated.Load())
+	}
+}
+
+func TestServeRemoteOriginUnreachable(t *testing.T) {
+	storage := setupTestDB(t)
+	o := newOrigin(t, remoteImage)
+	item, _ := storage.SaveUrlMetadata(o.URL+"/photo.jpg", model.Url)
+	r := setupRouter(storage, Options{CacheDir: t.TempDir(), MaxAge: -1})
+
+	get(r, item.Id)
+	o.Close()
+
+	w := get(r, item.Id)
+	if w.Code != http.StatusOK || w.Body.String() != remoteImage {
+		t.Errorf("Expected stale copy while offline, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Without cached copy, the origin failure is reported
+	missing, _ := storage.SaveUrlMetadata(o.URL+"/other.jpg", model.Url)
+	if w := get(r, missing.Id); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 without cached copy, got %d", w.Code)
+	}
+}
+
+func TestServeRemoteSizeLimit(t *testing.T) {
+	storage := setupTestDB(t)
+	o := newOrigin(t, remoteImage+" larger than the limit")
+	item, _ := storage.SaveUrlMetadata(o.URL+"/photo.jpg", model.Url)
+	dir := t.TempDir()
+	r := setupRouter(storage, Options{CacheDir: dir, MaxItemSize: 8})
+
+	if w := get(r, item.Id); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for oversized image, got %d", w.Code)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected nothing cached, got %d files", len(files))
+	}
+}
+
+func TestServeRemoteRejectsOtherContent(t *testing.T) {
+	storage := setupTestDB(t)
+	o := newOrigin(t, `<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+	item, _ := storage.SaveUrlMetadata(o.URL+"/photo.jpg", model.Url)
+	dir := t.TempDir()
+	r := setupRouter(storage, Options{CacheDir: dir})
+
+	if w := get(r, item.Id); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for content that is not an image, got %d", w.Code)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected nothing cached, got %d files", len(files))
+	}
+}
+
+func TestServeRemoteEvictsLeastRecentlyUsed(t *testing.T) {
+	storage := setupTestDB(t)
+	o := newOrigin(t, "GIF89a0123")
+	first, _ := storage.SaveUrlMetadata(o.URL+"/first.jpg", model.Url)
+	second, _ := storage.SaveUrlMetadata(o.URL+"/second.jpg", model.Url)
+	dir := t.TempDir()
+	r := setupRouter(storage, Options{CacheDir: dir, MaxCacheSize: 15})
+
+	get(r, first.Id)
+	get(r, second.Id)
+	if _, err := os.Stat(filepath.Join(dir, strconv.Itoa(first.Id))); !os.IsNotExist(err) {
+		t.Error("Expected first copy to be evicted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, strconv.Itoa(second.Id))); err != nil {
+		t.Errorf("Expected second copy to be cached: %v", err)
+	}
+}
+
+func TestServeRemoteSlowOriginBlocksOnlyItsItem(t *testing.T) {
+	storage := setupTestDB(t)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write([]byte("GIF89a slow"))
+	}))
+	t.Cleanup(slow.Close)
+	o := newOrigin(t, "GIF89a fast")
+	blocked, _ := storage.SaveUrlMetadata(slow.URL+"/photo.jpg", model.Url)
+	item, _ := storage.SaveUrlMetadata(o.URL+"/photo.jpg", model.Url)
+	r := setupRouter(storage, Options{CacheDir: t.TempDir()})
+
+	blockedDone := make(chan struct{})
+	go func() {
+		get(r, blocked.Id)
+		close(blockedDone)
+	}()
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- get(r, item.Id) }()
+	select {
+	case w := <-done:
+		if w.Code != http.StatusOK || w.Body.String() != "GIF89a fast" {
+			t.Errorf("Expected fast image, got %d %q", w.Code, w.Body.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the item to be served while another origin is slow")
+	}
+	close(release)
+	<-blockedDone
+}
+
+func TestRemoveDeletedItems(t *testing.T) {
+	storage := setupTestDB(t)
+	o := newOrigin(t, remoteImage)
+	item, _ := storage.SaveUrlMetadata(o.URL+"/photo.jpg", model.Url)
+	dir := t.TempDir()
+	handler := NewHandler(storage, Options{CacheDir: dir})
+	storage.OnImageRemoved(handler.Remove)
+	r := gin.New()
+	handler.RegisterApiEndpoint(r.Group("/static/remote"))
+
+	if w := get(r, item.Id); w.Code != http.StatusOK {
+		t.Fatalf("Expected remote image, got %d", w.Code)
+	}
+	if err := storage.DeleteImage(item.Id); err != nil {
+		t.Fatalf("DeleteImage failed: %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected the cached copy to be removed, got %d files", len(files))
+	}
+}
+
+func TestServeRemoteOnlyServesUrlItems(t *testing.T) {
+	storage := setupTestDB(t)
+	local, _ := storage.SaveImageMetadata("local.jpg")
+	page, _ := storage.SaveUrlMetadata("https://example.com/", model.WebPage)
+	r := setupRouter(storage, Options{CacheDir: t.TempDir()})
+
+	for _, id := range []int{local.Id, page.Id, 99} {
+		if w := get(r, id); w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for item %d, got %d", id, w.Code)
+		}
+	}
+}
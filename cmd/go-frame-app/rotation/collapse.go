@@ -0,0 +1,135 @@
+package rotation
+
+import (
+	"maps"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/similarity"
+)
+
+// collapseSimilar shows only one image of each group of near-duplicates per cycle.
+// The wrapped strategy only sees the first image of each group in the defined order, which stands in for
+// the whole group. Whenever it is chosen, the image of the group that has not been displayed for the longest
+// time is shown instead, so the group members take turns across cycles.
+type collapseSimilar struct {
+	strategy Strategy
+	distance int
+}
+
+func (c collapseSimilar) Next(storage model.RotationStorage, currentId int) (model.Image, error) {
+	view, err := newCollapsedView(storage, c.distance)
+	if err != nil {
+		return model.Image{}, err
+	}
+	representative, err := c.strategy.Next(view, view.representativeOf(currentId))
+	if err != nil {
+		return model.Image{}, err
+	}
+	return view.choose(representative)
+}
+
+// collapsedView presents each group of near-duplicates as its first image.
+type collapsedView struct {
+	model.RotationStorage
+	images []model.Image
+	// representatives maps the ID of each grouped image to the ID of the first image of its group.
+	representatives map[int]int
+	// members maps the ID of the first image of each group to all images of the group.
+	members map[int][]model.Image
+}
+
+func newCollapsedView(storage model.RotationStorage, distance int) (*collapsedView, error) {
+	images, err := storage.LoadImages()
+	if err != nil {
+		return nil, err
+	}
+	view := &collapsedView{
+		RotationStorage: storage,
+		images:          images,
+		representatives: map[int]int{},
+		members:         map[int][]model.Image{},
+	}
+	for _, group := range similarity.Groups(images, distance) {
+		for _, image := range group {
+			view.representatives[image.Id] = group[0].Id
+		}
+		view.members[group[0].Id] = group
+	}
+	return view, nil
+}
+
+func (v *collapsedView) representativeOf(id int) int {
+	if representative, found := v.representatives[id]; found {
+		return representative
+	}
+	return id
+}
+
+func (v *collapsedView) isRepresentative(image model.Image) bool {
+	return v.representativeOf(image.Id) == image.Id
+}
+
+func (v *collapsedView) LoadImages() ([]model.Image, error) {
+	var images []model.Image
+	for _, image := range v.images {
+		if v.isRepresentative(image) {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (v *collapsedView) LoadNextImage(id int) (model.Image, error) {
+	return v.skipMembers(id, v.RotationStorage.LoadNextImage)
+}
+
+func (v *collapsedView) LoadNextShuffledImage(id int) (model.Image, error) {
+	return v.skipMembers(id, v.RotationStorage.LoadNextShuffledImage)
+}
+
+// skipMembers loads next images until one stands in for its group.
+func (v *collapsedView) skipMembers(id int, next func(id int) (model.Image, error)) (model.Image, error) {
+	image, err := next(id)
+	// Every image is passed at most twice, in case the shuffled deck is reshuffled in between
+	for i := 0; err == nil && !v.isRepresentative(image) && i < 2*len(v.images); i++ {
+		image, err = next(image.Id)
+	}
+	return image, err
+}
+
+// LoadLastShown reports the most recent display of any group member as the display time of the group.
+func (v *collapsedView) LoadLastShown() (map[int]time.Time, error) {
+	stored, err := v.RotationStorage.LoadLastShown()
+	if err != nil {
+		return nil, err
+	}
+	lastShown := maps.Clone(stored)
+	for representative, group := range v.members {
+		for _, image := range group {
+			if lastShown[image.Id].After(lastShown[representative]) {
+				lastShown[representative] = lastShown[image.Id]
+			}
+		}
+	}
+	return lastShown, nil
+}
+
+// choose returns the member of the group, represented by the given image, that has not been displayed for the longest time.
+func (v *collapsedView) choose(representative model.Image) (model.Image, error) {
+	group, found := v.members[representative.Id]
+	if !found {
+		return representative, nil
+	}
+	lastShown, err := v.RotationStorage.LoadLastShown()
+	if err != nil {
+		return model.Image{}, err
+	}
+	chosen := group[0]
+	for _, image := range group[1:] {
+		if lastShown[image.Id].Before(lastShown[chosen.Id]) {
+			chosen = image
+		}
+	}
+	return chosen, nil
+}
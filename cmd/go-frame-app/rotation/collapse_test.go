@@ -0,0 +1,68 @@
+package rotation
+
+import (
+	"testing"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// similarStorage returns five images, where images 2 and 4 are near-duplicates.
+func similarStorage() *fakeStorage {
+	storage := newFakeStorage(5)
+	hashes := []string{"ffffffffffffffff", "0000000000000000", "00000000ffffffff", "0000000000000003", "ffffffff00000000"}
+	for i, hash := range hashes {
+		storage.images[i].PerceptualHash = hash
+	}
+	return storage
+}
+
+func TestCollapseSimilarSequential(t *testing.T) {
+	storage := similarStorage()
+	strategy := ForConfig(model.Config{Rotation: model.Sequential, CollapseSimilar: true}, SystemClock)
+	now := time.Now()
+
+	var shown []int
+	current := -1
+	for i := 0; i < 8; i++ {
+		next, err := strategy.Next(storage, current)
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		current = next.Id
+		storage.lastShown[current] = now.Add(time.Duration(i) * time.Minute)
+		shown = append(shown, current)
+	}
+	// One image of the group per cycle, the group members take turns
+	expected := []int{1, 2, 3, 5, 1, 4, 3, 5}
+	for i := range expected {
+		if shown[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, shown)
+		}
+	}
+}
+
+func TestCollapseSimilarLeastRecentlyShown(t *testing.T) {
+	storage := similarStorage()
+	now := time.Now()
+	storage.lastShown[1] = now.Add(-time.Hour)
+	storage.lastShown[2] = now.Add(-4 * time.Hour)
+	storage.lastShown[3] = now.Add(-2 * time.Hour)
+	storage.lastShown[4] = now.Add(-time.Minute)
+	storage.lastShown[5] = now
+
+	// The group counts as shown a minute ago, so image 3 is due instead of image 2
+	next, err := ForConfig(model.Config{Rotation: model.LeastRecentlyShown, CollapseSimilar: true}, SystemClock).Next(storage, 5)
+	if err != nil || next.Id != 3 {
+		t.Errorf("Expected image 3, got %d (%v)", next.Id, err)
+	}
+	if storage.lastShown[2] != now.Add(-4*time.Hour) {
+		t.Error("Expected stored display times to stay unchanged")
+	}
+
+	// Images farther apart than the threshold are not grouped
+	next, _ = ForConfig(model.Config{Rotation: model.LeastRecentlyShown, CollapseSimilar: true, SimilarityThreshold: 1}, SystemClock).Next(storage, 5)
+	if next.Id != 2 {
+		t.Errorf("Expected image 2, got %d", next.Id)
+	}
+}
@@ -0,0 +1,321 @@
+package rotation
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+var (
+	WarningLogger *log.Logger
+	InfoLogger    *log.Logger
+	ErrorLogger   *log.Logger
+)
+
+func init() {
+	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	WarningLogger = log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+}
+
+// maxWait is the longest time the engine sleeps before checking the status again.
+const maxWait = time.Minute
+
+// Clock provides the current time and timers to the engine.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel that receives the time once the given duration has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock is the Clock backed by the system time.
+var SystemClock Clock = systemClock{}
+
+// Engine owns the current-image state of the frame. It advances the rotation on schedule,
+// executes playback commands and informs listeners about changes. Every status transition
+// happens within a single storage transaction, reading the current image has no side effects.
+type Engine struct {
+	storage   model.ImageStorage
+	clock     Clock
+	wake      chan struct{}
+	mu        sync.Mutex
+	listeners []func(image model.Image)
+}
+
+// NewEngine creates a new rotation engine.
+//
+// Parameters:
+//   - storage: The storage holding images, configuration and status.
+//   - clock: The clock driving the rotation.
+//
+// Returns:
+//   - *Engine: The engine. It only advances on its own once Run is called.
+func NewEngine(storage model.ImageStorage, clock Clock) *Engine {
+	return &Engine{
+		storage: storage,
+		clock:   clock,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Run advances the rotation whenever the current image is due, until the context is done.
+//
+// Parameters:
+//   - ctx: The context that stops the engine when done.
+func (e *Engine) Run(ctx context.Context) {
+	for {
+		wait, err := e.Advance()
+		if err != nil {
+			WarningLogger.Println("Cannot advance rotation:", err)
+			wait = maxWait
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.clock.After(wait):
+		case <-e.wake:
+		}
+	}
+}
+
+// Advance replaces the current image if it is due or no longer exists.
+//
+// Returns:
+//   - time.Duration: The time until the next image is due.
+//   - error: An error if the next image cannot be determined.
+func (e *Engine) Advance() (time.Duration, error) {
+	wait, _, err := e.advance()
+	return wait, err
+}
+
+// advance implements Advance and reports whether the displayed image switched and the listeners were informed.
+func (e *Engine) advance() (time.Duration, bool, error) {
+	var image model.Image
+	var switched bool
+	var wait time.Duration
+	err := e.storage.Transition(func(view model.RotationView, status *model.Status) error {
+		config, err := view.GetConfiguration()
+		if err != nil {
+			return err
+		}
+		now := e.clock.Now()
+		current, err := view.LoadImage(status.CurrentImageId)
+		// Also advance if the current image is gone
+		if err != nil || IsDue(*status, Duration(current, config), now) {
+			image, err = ForConfig(config, e.clock).Next(view, status.CurrentImageId)
+			if err != nil {
+				return err
+			}
+			Switch(status, image.Id, now)
+			current = image
+			switched = true
+		}
+		wait = waitTime(*status, Duration(current, config), now)
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if switched {
+		e.notify(image)
+	}
+	return wait, switched, nil
+}
+
+func waitTime(status model.Status, duration time.Duration, now time.Time) time.Duration {
+	switchAt, scheduled := NextSwitch(status, duration)
+	if !scheduled {
+		return maxWait
+	}
+	return min(max(switchAt.Sub(now), 0), maxWait)
+}
+
+// CurrentImage returns the displayed image without advancing the rotation.
+// Until the engine displayed an existing image, the first image of the defined order is returned.
+func (e *Engine) CurrentImage() (model.Image, error) {
+	status, err := e.storage.GetCurrentStatus()
+	if err != nil {
+		return model.Image{}, err
+	}
+	image, err := e.storage.LoadImage(status.CurrentImageId)
+	if err != nil {
+		return e.storage.LoadNextImage(-1)
+	}
+	return image, nil
+}
+
+// OnChange registers a listener, called whenever the displayed image or the image library changes.
+// Listeners must not block.
+func (e *Engine) OnChange(listener func(image model.Image)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, listener)
+}
+
+// YearsAgo returns how many years ago the image was taken, if the ON_THIS_DAY rotation shows it as a memory of this day.
+// Zero for all other images and rotation modes.
+func (e *Engine) YearsAgo(image model.Image) int {
+	config, err := e.storage.GetConfiguration()
+	if err != nil || ModeOf(config) != model.OnThisDay {
+		return 0
+	}
+	return YearsAgo(image, config.MemoryWindow, e.clock.Now())
+}
+
+// NotifyChange re-evaluates the current image after the image library or configuration changed
+// and informs all listeners.
+func (e *Engine) NotifyChange() {
+	_, switched, err := e.advance()
+	if err != nil {
+		WarningLogger.Println("Cannot advance rotation:", err)
+	}
+	// A switch already informed the listeners
+	if !switched {
+		if image, err := e.CurrentImage(); err == nil {
+			e.notify(image)
+		}
+	}
+	e.wakeUp()
+}
+
+// Next switches to the image the active rotation strategy chooses next.
+//
+// Parameters:
+//   - hold: The minimum time the new image stays on screen (optional).
+//
+// Returns:
+//   - Image: The image now being displayed.
+//   - error: An error if the next image cannot be determined.
+func (e *Engine) Next(hold time.Duration) (model.Image, error) {
+	return e.switchImage(func(view model.RotationView, status *model.Status) (model.Image, error) {
+		config, err := view.GetConfiguration()
+		if err != nil {
+			return model.Image{}, err
+		}
+		return ForConfig(config, e.clock).Next(view, status.CurrentImageId)
+	}, hold)
+}
+
+// Jump switches to the image with the given ID.
+//
+// Parameters:
+//   - id: The ID of the image to display.
+//   - hold: The minimum time the image stays on screen (optional).
+//
+// Returns:
+//   - Image: The image now being displayed.
+//   - error: An error if the image does not exist.
+func (e *Engine) Jump(id int, hold time.Duration) (model.Image, error) {
+	return e.switchImage(func(view model.RotationView, status *model.Status) (model.Image, error) {
+		return view.LoadImage(id)
+	}, hold)
+}
+
+// Previous returns to the most recently displayed image. Images deleted in the meantime are skipped.
+//
+// Parameters:
+//   - hold: The minimum time the image stays on screen (optional).
+//
+// Returns:
+//   - Image: The image now being displayed.
+//   - error: ErrNoHistory if there is no previous image.
+func (e *Engine) Previous(hold time.Duration) (model.Image, error) {
+	var image model.Image
+	err := e.storage.Transition(func(view model.RotationView, status *model.Status) error {
+		now := e.clock.Now()
+		for {
+			if err := Back(status, now); err != nil {
+				return err
+			}
+			previous, err := view.LoadImage(status.CurrentImageId)
+			if err == nil {
+				image = previous
+				break
+			}
+		}
+		Hold(status, hold, now)
+		return nil
+	})
+	if err != nil {
+		return model.Image{}, err
+	}
+	e.notify(image)
+	e.wakeUp()
+	return image, nil
+}
+
+// Pause keeps the current image on screen until Resume is called.
+func (e *Engine) Pause() error {
+	err := e.storage.Transition(func(view model.RotationView, status *model.Status) error {
+		status.Paused = true
+		return nil
+	})
+	e.wakeUp()
+	return err
+}
+
+// Resume continues the rotation. The current image stays on screen for the full image duration.
+func (e *Engine) Resume() error {
+	err := e.storage.Transition(func(view model.RotationView, status *model.Status) error {
+		if status.Paused {
+			status.Paused = false
+			status.LastSwitch = e.clock.Now()
+		}
+		return nil
+	})
+	e.wakeUp()
+	return err
+}
+
+func (e *Engine) switchImage(choose func(view model.RotationView, status *model.Status) (model.Image, error), hold time.Duration) (model.Image, error) {
+	var image model.Image
+	err := e.storage.Transition(func(view model.RotationView, status *model.Status) error {
+		chosen, err := choose(view, status)
+		if err != nil {
+			return err
+		}
+		now := e.clock.Now()
+		Switch(status, chosen.Id, now)
+		Hold(status, hold, now)
+		image = chosen
+		return nil
+	})
+	if err != nil {
+		return model.Image{}, err
+	}
+	e.notify(image)
+	e.wakeUp()
+	return image, nil
+}
+
+func (e *Engine) notify(image model.Image) {
+	e.mu.Lock()
+	listeners := e.listeners
+	e.mu.Unlock()
+	for _, listener := range listeners {
+		listener(image)
+	}
+}
+
+// wakeUp makes Run re-evaluate the schedule right away.
+func (e *Engine) wakeUp() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
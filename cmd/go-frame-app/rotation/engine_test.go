@@ -0,0 +1,426 @@
+package rotation
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+)
+
+// fakeClock is a manually advanced Clock.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeTimer
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	fire     chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fire := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeTimer{deadline: c.now.Add(d), fire: fire})
+	return fire
+}
+
+// Advance moves the clock forward and fires all timers that expired.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var pending []fakeTimer
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(c.now) {
+			pending = append(pending, waiter)
+		} else {
+			waiter.fire <- c.now
+		}
+	}
+	c.waiters = pending
+}
+
+func setupEngine(t *testing.T, duration int) (*Engine, *persistence.Storage, *fakeClock) {
+	_ = os.MkdirAll("images", 0755)
+
+	dbPath := filepath.Join(t.TempDir(), "test_engine.db")
+	storage, err := persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open test DB: %v", err)
+	}
+	t.Cleanup(func() {
+		storage.Close()
+		os.RemoveAll("images")
+		os.RemoveAll("trash")
+	})
+	storage.UpdateConfiguration(model.Config{ImageDuration: duration})
+
+	clock := newFakeClock()
+	return NewEngine(storage, clock), storage, clock
+}
+
+func currentPath(t *testing.T, engine *Engine) string {
+	t.Helper()
+	image, err := engine.CurrentImage()
+	if err != nil {
+		t.Fatalf("CurrentImage failed: %v", err)
+	}
+	return image.Path
+}
+
+func TestEngineAdvance(t *testing.T) {
+	engine, storage, clock := setupEngine(t, 60)
+
+	// 1. Initial state, no images.
+	if _, err := engine.Advance(); err == nil {
+		t.Error("Expected error when no images")
+	}
+
+	// 2. Add an image, the first advance shows it
+	img1, _ := storage.SaveImageMetadata("img1.jpg")
+	wait, err := engine.Advance()
+	if err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+	if wait != 60*time.Second {
+		t.Errorf("Expected to wait 60s, got %v", wait)
+	}
+	status, _ := storage.GetCurrentStatus()
+	if status.CurrentImageId != img1.Id {
+		t.Errorf("Expected status ID %d, got %d", img1.Id, status.CurrentImageId)
+	}
+
+	// 3. Add second image. Duration is 60s. Should still be img1.
+	storage.SaveImageMetadata("img2.jpg")
+	clock.Advance(59 * time.Second)
+	wait, _ = engine.Advance()
+	if path := currentPath(t, engine); path != "img1.jpg" {
+		t.Errorf("Expected img1.jpg (not switched yet), got %s", path)
+	}
+	if wait != time.Second {
+		t.Errorf("Expected to wait 1s, got %v", wait)
+	}
+
+	// 4. Once the duration expired, the next image is shown
+	clock.Advance(time.Second)
+	engine.Advance()
+	if path := currentPath(t, engine); path != "img2.jpg" {
+		t.Errorf("Expected img2.jpg, got %s", path)
+	}
+}
+
+func TestEngineCurrentImageHasNoSideEffects(t *testing.T) {
+	engine, storage, clock := setupEngine(t, 60)
+	storage.SaveImageMetadata("img1.jpg")
+	storage.SaveImageMetadata("img2.jpg")
+
+	// Before the engine advanced, the first image is shown
+	if path := currentPath(t, engine); path != "img1.jpg" {
+		t.Errorf("Expected img1.jpg, got %s", path)
+	}
+	engine.Advance()
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if path := currentPath(t, engine); path != "img1.jpg" {
+			t.Errorf("Expected img1.jpg without advancing, got %s", path)
+		}
+	}
+}
+
+func TestEngineAdvanceIsRaceFree(t *testing.T) {
+	engine, storage, clock := setupEngine(t, 60)
+	storage.SaveImageMetadata("img1.jpg")
+	storage.SaveImageMetadata("img2.jpg")
+	storage.SaveImageMetadata("img3.jpg")
+	engine.Advance()
+	clock.Advance(61 * time.Second)
+
+	var switches sync.WaitGroup
+	var mu sync.Mutex
+	var changes []string
+	engine.OnChange(func(image model.Image) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, image.Path)
+	})
+	for i := 0; i < 10; i++ {
+		switches.Add(1)
+		go func() {
+			defer switches.Done()
+			engine.Advance()
+		}()
+	}
+	switches.Wait()
+
+	// Concurrent advances must switch exactly once and not skip an image
+	if len(changes) != 1 || changes[0] != "img2.jpg" {
+		t.Errorf("Expected a single switch to img2.jpg, got %v", changes)
+	}
+}
+
+func TestEngineRun(t *testing.T) {
+	engine, storage, clock := setupEngine(t, 10)
+	storage.SaveImageMetadata("img1.jpg")
+	storage.SaveImageMetadata("img2.jpg")
+
+	changes := make(chan string, 10)
+	engine.OnChange(func(image model.Image) {
+		changes <- image.Path
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Run(ctx)
+
+	if path := <-changes; path != "img1.jpg" {
+		t.Errorf("Expected img1.jpg on start, got %s", path)
+	}
+	// Wait until the engine sleeps, then let the image expire
+	waitForTimer(t, clock)
+	clock.Advance(10 * time.Second)
+	if path := <-changes; path != "img2.jpg" {
+		t.Errorf("Expected img2.jpg after 10s, got %s", path)
+	}
+}
+
+func waitForTimer(t *testing.T, clock *fakeClock) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		clock.mu.Lock()
+		waiting := len(clock.waiters) > 0
+		clock.mu.Unlock()
+		if waiting {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("Engine did not start waiting")
+}
+
+func TestEngineShuffledOrder(t *testing.T) {
+	engine, storage, clock := setupEngine(t, 10)
+	storage.UpdateConfiguration(model.Config{ImageDuration: 10, RandomOrder: true})
+	storage.SaveImageMetadata("img1.jpg")
+	storage.SaveImageMetadata("img2.jpg")
+	storage.SaveImageMetadata("img3.jpg")
+
+	// Every round of three shows each image once
+	var previous string
+	for round := 0; round < 5; round++ {
+		seen := map[string]bool{}
+		for i := 0; i < 3; i++ {
+			engine.Advance()
+			path := currentPath(t, engine)
+			if path == previous {
+				t.Errorf("Image %s shown twice in a row", path)
+			}
+			seen[path] = true
+			previous = path
+			clock.Advance(10 * time.Second)
+		}
+		if len(seen) != 3 {
+			t.Errorf("Expected 3 distinct images in round %d, got %d", round, len(seen))
+		}
+	}
+}
+
+func TestEnginePlayback(t *testing.T) {
+	engine, storage, _ := setupEngine(t, 60)
+	img1, _ := storage.SaveImageMetadata("img1.jpg")
+	img2, _ := storage.SaveImageMetadata("img2.jpg")
+	img3, _ := storage.SaveImageMetadata("img3.jpg")
+
+	if _, err := engine.Previous(0); err != ErrNoHistory {
+		t.Errorf("Expected ErrNoHistory, got %v", err)
+	}
+
+	next, err := engine.Next(0)
+	if err != nil || next.Id != img1.Id {
+		t.Fatalf("Expected img1, got %d (%v)", next.Id, err)
+	}
+	next, _ = engine.Next(0)
+	if next.Id != img2.Id {
+		t.Errorf("Expected img2, got %d", next.Id)
+	}
+
+	jumped, err := engine.Jump(img3.Id, time.Hour)
+	if err != nil || jumped.Id != img3.Id {
+		t.Fatalf("Expected jump to img3, got %d (%v)", jumped.Id, err)
+	}
+	status, _ := storage.GetCurrentStatus()
+	if status.CurrentImageId != img3.Id || status.OverrideUntil.Sub(status.LastSwitch) != time.Hour {
+		t.Errorf("Expected img3 held for an hour, got %+v", status)
+	}
+	if _, err := engine.Jump(99, 0); err == nil {
+		t.Error("Expected error jumping to unknown image")
+	}
+
+	previous, err := engine.Previous(0)
+	if err != nil || previous.Id != img2.Id {
+		t.Errorf("Expected img2, got %d (%v)", previous.Id, err)
+	}
+	previous, _ = engine.Previous(0)
+	if previous.Id != img1.Id {
+		t.Errorf("Expected img1, got %d", previous.Id)
+	}
+	status, _ = storage.GetCurrentStatus()
+	if len(status.History) != 0 || !status.OverrideUntil.IsZero() {
+		t.Errorf("Expected empty history without hold, got %+v", status)
+	}
+
+	// Without history, the status stays untouched
+	if _, err := engine.Previous(0); err != ErrNoHistory {
+		t.Errorf("Expected ErrNoHistory, got %v", err)
+	}
+	if path := currentPath(t, engine); path != "img1.jpg" {
+		t.Errorf("Expected img1.jpg, got %s", path)
+	}
+}
+
+func TestEnginePreviousSkipsDeletedImages(t *testing.T) {
+	engine, storage, _ := setupEngine(t, 60)
+	img1, _ := storage.SaveImageMetadata("img1.jpg")
+	img2, _ := storage.SaveImageMetadata("img2.jpg")
+	img3, _ := storage.SaveImageMetadata("img3.jpg")
+	engine.Jump(img1.Id, 0)
+	engine.Jump(img2.Id, 0)
+	engine.Jump(img3.Id, 0)
+
+	os.WriteFile(filepath.Join("images", "img2.jpg"), nil, 0644)
+	storage.DeleteImage(img2.Id)
+
+	previous, err := engine.Previous(0)
+	if err != nil || previous.Id != img1.Id {
+		t.Errorf("Expected img1, got %d (%v)", previous.Id, err)
+	}
+}
+
+func TestEnginePauseAndResume(t *testing.T) {
+	engine, storage, clock := setupEngine(t, 10)
+	storage.SaveImageMetadata("img1.jpg")
+	storage.SaveImageMetadata("img2.jpg")
+	engine.Advance()
+
+	if err := engine.Pause(); err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Minute)
+		wait, _ := engine.Advance()
+		if path := currentPath(t, engine); path != "img1.jpg" {
+			t.Errorf("Expected img1.jpg while paused, got %s", path)
+		}
+		if wait != maxWait {
+			t.Errorf("Expected to wait %v while paused, got %v", maxWait, wait)
+		}
+	}
+
+	// Resuming shows the current image for the full duration
+	if err := engine.Resume(); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	clock.Advance(9 * time.Second)
+	engine.Advance()
+	if path := currentPath(t, engine); path != "img1.jpg" {
+		t.Errorf("Expected img1.jpg right after resume, got %s", path)
+	}
+	clock.Advance(time.Second)
+	engine.Advance()
+	if path := currentPath(t, engine); path != "img2.jpg" {
+		t.Errorf("Expected rotation to continue after resume, got %s", path)
+	}
+}
+
+func TestEngineHeldImageIsKept(t *testing.T) {
+	engine, storage, clock := setupEngine(t, 10)
+	storage.SaveImageMetadata("img1.jpg")
+	img2, _ := storage.SaveImageMetadata("img2.jpg")
+
+	engine.Jump(img2.Id, time.Minute)
+	clock.Advance(30 * time.Second)
+	wait, _ := engine.Advance()
+	if path := currentPath(t, engine); path != "img2.jpg" {
+		t.Errorf("Expected held img2.jpg, got %s", path)
+	}
+	if wait != 30*time.Second {
+		t.Errorf("Expected to wait for the hold to expire in 30s, got %v", wait)
+	}
+	clock.Advance(30 * time.Second)
+	engine.Advance()
+	if path := currentPath(t, engine); path != "img1.jpg" {
+		t.Errorf("Expected img1.jpg after the hold expired, got %s", path)
+	}
+}
+
+func TestEngineNotifyChange(t *testing.T) {
+	engine, storage, clock := setupEngine(t, 60)
+	storage.SaveImageMetadata("img1.jpg")
+	img2, _ := storage.SaveImageMetadata("img2.jpg")
+	engine.Advance()
+
+	var changes []string
+	engine.OnChange(func(image model.Image) {
+		changes = append(changes, image.Path)
+	})
+
+	// Unchanged images are announced after library changes
+	engine.NotifyChange()
+	if len(changes) != 1 || changes[0] != "img1.jpg" {
+		t.Errorf("Expected img1.jpg to be announced, got %v", changes)
+	}
+
+	// A switch of a due image is announced once
+	clock.Advance(61 * time.Second)
+	changes = nil
+	engine.NotifyChange()
+	if len(changes) != 1 || changes[0] != "img2.jpg" {
+		t.Errorf("Expected one announcement of img2.jpg, got %v", changes)
+	}
+
+	// A deleted current image is replaced right away
+	os.WriteFile(filepath.Join("images", "img2.jpg"), nil, 0644)
+	storage.DeleteImage(img2.Id)
+	changes = nil
+	engine.NotifyChange()
+	if len(changes) != 1 || changes[0] != "img1.jpg" {
+		t.Errorf("Expected img1.jpg to replace the deleted image, got %v", changes)
+	}
+}
+
+func TestEngineImageDurationOverride(t *testing.T) {
+	engine, storage, clock := setupEngine(t, 60)
+	img1, _ := storage.SaveImageMetadata("img1.jpg")
+	storage.SaveImageMetadata("img2.jpg")
+	img1.Duration = 10
+	storage.UpdateImage(img1)
+
+	wait, _ := engine.Advance()
+	if wait != 10*time.Second {
+		t.Errorf("Expected to wait 10s for the overridden image, got %v", wait)
+	}
+	clock.Advance(10 * time.Second)
+	wait, _ = engine.Advance()
+	if path := currentPath(t, engine); path != "img2.jpg" {
+		t.Errorf("Expected img2.jpg after 10s, got %s", path)
+	}
+	if wait != 60*time.Second {
+		t.Errorf("Expected configured duration for img2, got %v", wait)
+	}
+}
@@ -0,0 +1,78 @@
+package rotation
+
+import (
+	"errors"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/tagging"
+)
+
+// ErrNoMatchingImages is returned if no image matches the tag filter of the configuration.
+var ErrNoMatchingImages = errors.New("No images match the tag filter")
+
+// filterTags restricts the rotation to the images matching a tag expression.
+// The wrapped strategy only sees the matching images.
+type filterTags struct {
+	strategy   Strategy
+	expression tagging.Expression
+}
+
+func (f filterTags) Next(storage model.RotationStorage, currentId int) (model.Image, error) {
+	view, err := newFilteredView(storage, f.expression)
+	if err != nil {
+		return model.Image{}, err
+	}
+	if len(view.images) == 0 {
+		return model.Image{}, ErrNoMatchingImages
+	}
+	return f.strategy.Next(view, currentId)
+}
+
+// filteredView presents the images matching a tag expression only.
+type filteredView struct {
+	model.RotationStorage
+	expression tagging.Expression
+	// images are the matching images, in the defined order.
+	images []model.Image
+	// total is the number of images of the rotation, matching or not.
+	total int
+}
+
+func newFilteredView(storage model.RotationStorage, expression tagging.Expression) (*filteredView, error) {
+	images, err := storage.LoadImages()
+	if err != nil {
+		return nil, err
+	}
+	view := &filteredView{RotationStorage: storage, expression: expression, total: len(images)}
+	for _, image := range images {
+		if expression.Matches(image.Tags) {
+			view.images = append(view.images, image)
+		}
+	}
+	return view, nil
+}
+
+func (v *filteredView) LoadImages() ([]model.Image, error) {
+	return v.images, nil
+}
+
+func (v *filteredView) LoadNextImage(id int) (model.Image, error) {
+	return v.skipUnmatched(id, v.RotationStorage.LoadNextImage)
+}
+
+func (v *filteredView) LoadNextShuffledImage(id int) (model.Image, error) {
+	return v.skipUnmatched(id, v.RotationStorage.LoadNextShuffledImage)
+}
+
+// skipUnmatched loads next images until one matches the expression.
+func (v *filteredView) skipUnmatched(id int, next func(id int) (model.Image, error)) (model.Image, error) {
+	image, err := next(id)
+	// Every image is passed at most twice, in case the shuffled deck is reshuffled in between
+	for i := 0; err == nil && !v.expression.Matches(image.Tags); i++ {
+		if i >= 2*v.total {
+			return model.Image{}, ErrNoMatchingImages
+		}
+		image, err = next(image.Id)
+	}
+	return image, err
+}
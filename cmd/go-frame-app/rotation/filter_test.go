@@ -0,0 +1,62 @@
+package rotation
+
+import (
+	"errors"
+	"testing"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// taggedStorage returns five images, where images 2 and 4 are family pictures and image 4 is a screenshot.
+func taggedStorage() *fakeStorage {
+	storage := newFakeStorage(5)
+	storage.images[1].Tags = []string{"family"}
+	storage.images[2].Tags = []string{"family", "screenshots"}
+	storage.images[3].Tags = []string{"family"}
+	return storage
+}
+
+func TestFilterTagsSequential(t *testing.T) {
+	storage := taggedStorage()
+	strategy := ForConfig(model.Config{Rotation: model.Sequential, TagFilter: "family AND NOT screenshots"}, SystemClock)
+
+	var shown []int
+	current := -1
+	for i := 0; i < 4; i++ {
+		next, err := strategy.Next(storage, current)
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		current = next.Id
+		shown = append(shown, current)
+	}
+	expected := []int{2, 4, 2, 4}
+	for i := range expected {
+		if shown[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, shown)
+		}
+	}
+}
+
+func TestFilterTagsWeightedRandom(t *testing.T) {
+	storage := taggedStorage()
+	for i := 0; i < 20; i++ {
+		next, err := ForConfig(model.Config{Rotation: model.WeightedRandom, TagFilter: "screenshots"}, SystemClock).Next(storage, -1)
+		if err != nil || next.Id != 3 {
+			t.Fatalf("Expected image 3, got %d (%v)", next.Id, err)
+		}
+	}
+}
+
+func TestFilterTagsWithoutMatches(t *testing.T) {
+	storage := taggedStorage()
+	_, err := ForConfig(model.Config{Rotation: model.Sequential, TagFilter: "beach"}, SystemClock).Next(storage, -1)
+	if !errors.Is(err, ErrNoMatchingImages) {
+		t.Errorf("Expected ErrNoMatchingImages, got %v", err)
+	}
+	// An invalid filter is ignored
+	next, err := ForConfig(model.Config{Rotation: model.Sequential, TagFilter: "family AND"}, SystemClock).Next(storage, 1)
+	if err != nil || next.Id != 2 {
+		t.Errorf("Expected image 2, got %d (%v)", next.Id, err)
+	}
+}
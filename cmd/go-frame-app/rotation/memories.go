@@ -0,0 +1,68 @@
+package rotation
+
+import (
+	"slices"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// onThisDay shows the photos taken around today's date in previous years, in the defined order.
+// With fewer memories than the minimum, the fallback strategy chooses among all images.
+type onThisDay struct {
+	fallback Strategy
+	window   int
+	minimum  int
+	now      func() time.Time
+}
+
+func (o onThisDay) Next(storage model.RotationStorage, currentId int) (model.Image, error) {
+	images, err := storage.LoadImages()
+	if err != nil {
+		return model.Image{}, err
+	}
+	now := o.now()
+	var memories []model.Image
+	for _, image := range images {
+		if YearsAgo(image, o.window, now) > 0 {
+			memories = append(memories, image)
+		}
+	}
+	if len(memories) == 0 || len(memories) < o.minimum {
+		return o.fallback.Next(storage, currentId)
+	}
+	position := slices.IndexFunc(memories, func(image model.Image) bool {
+		return image.Id == currentId
+	})
+	// Starts with the first memory if the current image is none
+	return memories[(position+1)%len(memories)], nil
+}
+
+// YearsAgo returns how many years ago the photo was taken, if it was taken in a previous year within the given number
+// of days around the month and day of now. The date taken is compared as recorded, photos without date never match.
+//
+// Parameters:
+//   - image: The image to check.
+//   - window: The number of days before and after the month and day of now.
+//   - now: The current time.
+//
+// Returns:
+//   - int: The number of years since the photo was taken, or zero if it is no memory of this day.
+func YearsAgo(image model.Image, window int, now time.Time) int {
+	taken := image.Metadata.TakenAt
+	if taken.IsZero() {
+		return 0
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	// The closest anniversary may lie in the previous or next year, around the turn of the year
+	for year := now.Year() - 1; year <= now.Year()+1; year++ {
+		// Photos of February 29 have their anniversary on February 28 in other years
+		lastDay := time.Date(year, taken.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		anniversary := time.Date(year, taken.Month(), min(taken.Day(), lastDay), 0, 0, 0, 0, time.UTC)
+		days := int(anniversary.Sub(today).Hours() / 24)
+		if days >= -window && days <= window && year > taken.Year() {
+			return year - taken.Year()
+		}
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package rotation
+
+import (
+	"testing"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+func takenAt(year int, month time.Month, day int) model.Metadata {
+	return model.Metadata{TakenAt: time.Date(year, month, day, 15, 0, 0, 0, time.UTC)}
+}
+
+func TestYearsAgo(t *testing.T) {
+	now := time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		metadata model.Metadata
+		window   int
+		expected int
+	}{
+		{takenAt(2023, 1, 2), 0, 3},
+		{takenAt(2025, 1, 2), 0, 1},
+		{takenAt(2026, 1, 2), 0, 0},
+		{takenAt(2023, 1, 3), 0, 0},
+		{takenAt(2023, 1, 5), 3, 3},
+		{takenAt(2023, 1, 6), 3, 0},
+		// Around the turn of the year, the anniversary lies in the previous year
+		{takenAt(2020, 12, 30), 3, 5},
+		{takenAt(2025, 12, 30), 3, 0},
+		{model.Metadata{}, 3, 0},
+	}
+	for _, test := range tests {
+		if years := YearsAgo(model.Image{Metadata: test.metadata}, test.window, now); years != test.expected {
+			t.Errorf("%v with window %d: expected %d, got %d", test.metadata.TakenAt, test.window, test.expected, years)
+		}
+	}
+}
+
+func TestYearsAgoLeapDay(t *testing.T) {
+	leapDay := model.Image{Metadata: takenAt(2024, 2, 29)}
+	tests := []struct {
+		now      time.Time
+		expected int
+	}{
+		{time.Date(2025, 2, 28, 9, 0, 0, 0, time.UTC), 1},
+		{time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC), 0},
+		{time.Date(2028, 2, 28, 9, 0, 0, 0, time.UTC), 0},
+		{time.Date(2028, 2, 29, 9, 0, 0, 0, time.UTC), 4},
+	}
+	for _, test := range tests {
+		if years := YearsAgo(leapDay, 0, test.now); years != test.expected {
+			t.Errorf("%v: expected %d, got %d", test.now, test.expected, years)
+		}
+	}
+}
+
+func TestOnThisDay(t *testing.T) {
+	storage := newFakeStorage(5)
+	storage.images[1].Metadata = takenAt(2020, 6, 1)
+	storage.images[3].Metadata = takenAt(2024, 5, 30)
+	strategy := onThisDay{fallback: sequential{}, window: 2, minimum: 2, now: func() time.Time {
+		return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	}}
+
+	// The memories take turns
+	var shown []int
+	current := -1
+	for i := 0; i < 3; i++ {
+		next, err := strategy.Next(storage, current)
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		current = next.Id
+		shown = append(shown, current)
+	}
+	expected := []int{2, 4, 2}
+	for i := range expected {
+		if shown[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, shown)
+		}
+	}
+
+	// With too few memories, the images are shown in the defined order
+	strategy.window = 0
+	if next, err := strategy.Next(storage, 2); err != nil || next.Id != 3 {
+		t.Errorf("Expected image 3, got %d (%v)", next.Id, err)
+	}
+}
+
+func TestOnThisDayFollowsClock(t *testing.T) {
+	storage := newFakeStorage(3)
+	storage.images[1].Metadata = takenAt(2020, 6, 1)
+	clock := newFakeClock()
+	strategy := ForConfig(model.Config{Rotation: model.OnThisDay, MinMemories: 1}, clock)
+
+	if next, err := strategy.Next(storage, -1); err != nil || next.Id != 2 {
+		t.Errorf("Expected the memory of the clock's day, got %d (%v)", next.Id, err)
+	}
+	// A day later the photo is no memory anymore, the images are shown in the defined order
+	clock.Advance(24 * time.Hour)
+	if next, err := strategy.Next(storage, 2); err != nil || next.Id != 3 {
+		t.Errorf("Expected image 3, got %d (%v)", next.Id, err)
+	}
+}
+
+func TestEngineYearsAgo(t *testing.T) {
+	engine, storage, _ := setupEngine(t, 60)
+	memory := model.Image{Metadata: takenAt(2022, 6, 1)}
+	if years := engine.YearsAgo(memory); years != 0 {
+		t.Errorf("Expected no memory outside the ON_THIS_DAY rotation, got %d", years)
+	}
+	storage.UpdateConfiguration(model.Config{ImageDuration: 60, Rotation: model.OnThisDay})
+	if years := engine.YearsAgo(memory); years != 3 {
+		t.Errorf("Expected 3 years, got %d", years)
+	}
+}
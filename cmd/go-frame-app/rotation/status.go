@@ -0,0 +1,83 @@
+package rotation
+
+import (
+	"errors"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// maxHistory is the number of previously displayed images remembered in the status.
+const maxHistory = 50
+
+// ErrNoHistory is returned when there is no previously displayed image to return to.
+var ErrNoHistory = errors.New("No previous image")
+
+// Duration returns the time the given image is displayed. The duration of the image overrides
+// the configured duration.
+func Duration(image model.Image, config model.Config) time.Duration {
+	if image.Duration > 0 {
+		return time.Duration(image.Duration) * time.Second
+	}
+	return time.Duration(config.ImageDuration) * time.Second
+}
+
+// NextSwitch returns the time at which the current image, displayed for the given duration, has to be replaced.
+// Manually held images are replaced once the hold expires. While paused, no switch is scheduled
+// and false is returned, unless no image has been displayed yet.
+func NextSwitch(status model.Status, duration time.Duration) (time.Time, bool) {
+	if status.CurrentImageId < 0 {
+		return time.Time{}, true
+	}
+	if status.Paused {
+		return time.Time{}, false
+	}
+	switchAt := status.LastSwitch.Add(duration)
+	if status.OverrideUntil.After(switchAt) {
+		switchAt = status.OverrideUntil
+	}
+	return switchAt, true
+}
+
+// IsDue reports whether the current image, displayed for the given duration, has to be replaced at the given time.
+func IsDue(status model.Status, duration time.Duration, now time.Time) bool {
+	switchAt, scheduled := NextSwitch(status, duration)
+	return scheduled && !now.Before(switchAt)
+}
+
+// Switch makes the image with the given ID the current image. The previously displayed image
+// is remembered in the history and a manual hold is released.
+func Switch(status *model.Status, id int, now time.Time) {
+	if status.CurrentImageId >= 0 && status.CurrentImageId != id {
+		status.History = append(status.History, status.CurrentImageId)
+		if len(status.History) > maxHistory {
+			status.History = status.History[len(status.History)-maxHistory:]
+		}
+	}
+	status.CurrentImageId = id
+	status.LastSwitch = now
+	status.OverrideUntil = time.Time{}
+}
+
+// Back makes the most recently displayed image of the history the current image.
+//
+// Returns:
+//   - error: ErrNoHistory if no previous image is known.
+func Back(status *model.Status, now time.Time) error {
+	if len(status.History) == 0 {
+		return ErrNoHistory
+	}
+	last := len(status.History) - 1
+	status.CurrentImageId = status.History[last]
+	status.History = status.History[:last]
+	status.LastSwitch = now
+	status.OverrideUntil = time.Time{}
+	return nil
+}
+
+// Hold keeps the current image on screen for the given duration, starting at the given time.
+func Hold(status *model.Status, hold time.Duration, now time.Time) {
+	if hold > 0 {
+		status.OverrideUntil = now.Add(hold)
+	}
+}
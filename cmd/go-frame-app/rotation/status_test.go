@@ -0,0 +1,79 @@
+package rotation
+
+import (
+	"testing"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+func TestIsDue(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		status model.Status
+		want   bool
+	}{
+		{"no image yet", model.Status{CurrentImageId: -1, LastSwitch: now}, true},
+		{"duration not expired", model.Status{CurrentImageId: 1, LastSwitch: now.Add(-30 * time.Second)}, false},
+		{"duration expired", model.Status{CurrentImageId: 1, LastSwitch: now.Add(-61 * time.Second)}, true},
+		{"paused", model.Status{CurrentImageId: 1, LastSwitch: now.Add(-time.Hour), Paused: true}, false},
+		{"held", model.Status{CurrentImageId: 1, LastSwitch: now.Add(-time.Hour), OverrideUntil: now.Add(time.Minute)}, false},
+		{"hold expired", model.Status{CurrentImageId: 1, LastSwitch: now.Add(-time.Hour), OverrideUntil: now.Add(-time.Minute)}, true},
+	}
+	for _, test := range tests {
+		if got := IsDue(test.status, time.Minute, now); got != test.want {
+			t.Errorf("%s: IsDue = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSwitchAndBack(t *testing.T) {
+	now := time.Now()
+	status := model.Status{CurrentImageId: -1}
+
+	Switch(&status, 1, now)
+	if len(status.History) != 0 {
+		t.Errorf("Expected no history for the first image, got %v", status.History)
+	}
+	Switch(&status, 2, now)
+	Hold(&status, time.Minute, now)
+	Switch(&status, 3, now)
+	if status.CurrentImageId != 3 || len(status.History) != 2 || !status.OverrideUntil.IsZero() {
+		t.Errorf("Unexpected status after switches %+v", status)
+	}
+
+	if err := Back(&status, now); err != nil || status.CurrentImageId != 2 {
+		t.Errorf("Expected back to 2, got %d (%v)", status.CurrentImageId, err)
+	}
+	if err := Back(&status, now); err != nil || status.CurrentImageId != 1 {
+		t.Errorf("Expected back to 1, got %d (%v)", status.CurrentImageId, err)
+	}
+	if err := Back(&status, now); err != ErrNoHistory {
+		t.Errorf("Expected ErrNoHistory, got %v", err)
+	}
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	status := model.Status{CurrentImageId: -1}
+	for i := 0; i < maxHistory+10; i++ {
+		Switch(&status, i, time.Now())
+	}
+	if len(status.History) != maxHistory {
+		t.Errorf("Expected %d history entries, got %d", maxHistory, len(status.History))
+	}
+	if status.History[len(status.History)-1] != maxHistory+8 {
+		t.Errorf("Expected most recent entry last, got %v", status.History[len(status.History)-1])
+	}
+}
+
+func TestDuration(t *testing.T) {
+	config := model.Config{ImageDuration: 60}
+
+	if got := Duration(model.Image{}, config); got != time.Minute {
+		t.Errorf("Expected configured duration, got %v", got)
+	}
+	if got := Duration(model.Image{Duration: 15}, config); got != 15*time.Second {
+		t.Errorf("Expected image duration, got %v", got)
+	}
+}
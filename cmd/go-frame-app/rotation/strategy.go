@@ -0,0 +1,165 @@
+package rotation
+
+import (
+	"errors"
+	"math/rand/v2"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/tagging"
+)
+
+// Strategy chooses the next image to display.
+type Strategy interface {
+	// Next returns the image to display after the image with the given ID.
+	// An ID below zero indicates that no image has been displayed yet.
+	Next(storage model.RotationStorage, currentId int) (model.Image, error)
+}
+
+// ModeOf returns the rotation mode configured in the given configuration.
+// Configurations without an explicit mode fall back to the RandomOrder flag.
+func ModeOf(config model.Config) model.RotationMode {
+	if config.Rotation != "" {
+		return config.Rotation
+	}
+	if config.RandomOrder {
+		return model.Shuffled
+	}
+	return model.Sequential
+}
+
+// IsValidMode reports whether a strategy exists for the given rotation mode.
+func IsValidMode(mode model.RotationMode) bool {
+	switch mode {
+	case model.Sequential, model.Shuffled, model.WeightedRandom, model.LeastRecentlyShown, model.OnThisDay:
+		return true
+	}
+	return false
+}
+
+// ForConfig returns the strategy selected by the given configuration.
+// Unknown modes fall back to the sequential strategy. If CollapseSimilar is set,
+// the strategy shows only one image of each group of near-duplicates per cycle.
+// If a TagFilter is set, the strategy only shows images matching it. An invalid filter is ignored.
+// Strategies depending on the date, like OnThisDay, take it from the given clock.
+func ForConfig(config model.Config, clock Clock) Strategy {
+	strategy := forMode(ModeOf(config))
+	if ModeOf(config) == model.OnThisDay {
+		// Without enough memories, the images are shown in the defined order
+		strategy = onThisDay{fallback: sequential{}, window: config.MemoryWindow, minimum: config.Memories(), now: clock.Now}
+	}
+	if config.CollapseSimilar {
+		strategy = collapseSimilar{strategy: strategy, distance: config.Similarity()}
+	}
+	if config.TagFilter != "" {
+		expression, err := tagging.Parse(config.TagFilter)
+		if err != nil {
+			WarningLogger.Println("Ignoring invalid tag filter", config.TagFilter, ":", err)
+			return strategy
+		}
+		// Filtering first, so near-duplicates are grouped among the matching images only
+		strategy = filterTags{strategy: strategy, expression: expression}
+	}
+	return strategy
+}
+
+func forMode(mode model.RotationMode) Strategy {
+	switch mode {
+	case model.Shuffled:
+		return shuffled{}
+	case model.WeightedRandom:
+		return weightedRandom{intN: rand.IntN}
+	case model.LeastRecentlyShown:
+		return leastRecentlyShown{}
+	default:
+		return sequential{}
+	}
+}
+
+// sequential cycles through the images in the defined order.
+type sequential struct{}
+
+func (sequential) Next(storage model.RotationStorage, currentId int) (model.Image, error) {
+	return storage.LoadNextImage(currentId)
+}
+
+// shuffled draws images from the persisted shuffle deck.
+type shuffled struct{}
+
+func (shuffled) Next(storage model.RotationStorage, currentId int) (model.Image, error) {
+	return storage.LoadNextShuffledImage(currentId)
+}
+
+// weightedRandom picks a random image, proportional to the image weights.
+type weightedRandom struct {
+	intN func(n int) int
+}
+
+func (w weightedRandom) Next(storage model.RotationStorage, currentId int) (model.Image, error) {
+	candidates, err := loadCandidates(storage, currentId)
+	if err != nil {
+		return model.Image{}, err
+	}
+	total := 0
+	for _, image := range candidates {
+		total += weightOf(image)
+	}
+	pick := w.intN(total)
+	for _, image := range candidates {
+		pick -= weightOf(image)
+		if pick < 0 {
+			return image, nil
+		}
+	}
+	return candidates[len(candidates)-1], nil
+}
+
+func weightOf(image model.Image) int {
+	if image.Weight <= 0 {
+		return 1
+	}
+	return image.Weight
+}
+
+// leastRecentlyShown picks the image that has not been displayed for the longest time.
+// Images that have never been displayed come first, ties are resolved by the defined order.
+type leastRecentlyShown struct{}
+
+func (leastRecentlyShown) Next(storage model.RotationStorage, currentId int) (model.Image, error) {
+	candidates, err := loadCandidates(storage, currentId)
+	if err != nil {
+		return model.Image{}, err
+	}
+	lastShown, err := storage.LoadLastShown()
+	if err != nil {
+		return model.Image{}, err
+	}
+	next := candidates[0]
+	for _, image := range candidates[1:] {
+		if lastShown[image.Id].Before(lastShown[next.Id]) {
+			next = image
+		}
+	}
+	return next, nil
+}
+
+// loadCandidates returns all images eligible as next image. The current image is only
+// eligible if it is the only image available.
+func loadCandidates(storage model.RotationStorage, currentId int) ([]model.Image, error) {
+	images, err := storage.LoadImages()
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, errors.New("No images found")
+	}
+	var candidates []model.Image
+	for _, image := range images {
+		if image.Id != currentId {
+			candidates = append(candidates, image)
+		}
+	}
+	if len(candidates) == 0 {
+		return images, nil
+	}
+	return candidates, nil
+}
@@ -0,0 +1,169 @@
+package rotation
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+type fakeStorage struct {
+	images    []model.Image
+	lastShown map[int]time.Time
+	shuffled  int
+}
+
+func (f *fakeStorage) LoadImages() ([]model.Image, error) {
+	return f.images, nil
+}
+
+func (f *fakeStorage) LoadNextImage(id int) (model.Image, error) {
+	for i, image := range f.images {
+		if image.Id == id {
+			return f.images[(i+1)%len(f.images)], nil
+		}
+	}
+	if len(f.images) == 0 {
+		return model.Image{}, errors.New("No images found")
+	}
+	return f.images[0], nil
+}
+
+func (f *fakeStorage) LoadNextShuffledImage(id int) (model.Image, error) {
+	f.shuffled++
+	return f.images[len(f.images)-1], nil
+}
+
+func (f *fakeStorage) LoadLastShown() (map[int]time.Time, error) {
+	return f.lastShown, nil
+}
+
+func newFakeStorage(count int) *fakeStorage {
+	storage := &fakeStorage{lastShown: map[int]time.Time{}}
+	for i := 1; i <= count; i++ {
+		storage.images = append(storage.images, model.Image{Id: i})
+	}
+	return storage
+}
+
+func TestModeOf(t *testing.T) {
+	tests := []struct {
+		config model.Config
+		want   model.RotationMode
+	}{
+		{model.Config{}, model.Sequential},
+		{model.Config{RandomOrder: true}, model.Shuffled},
+		{model.Config{RandomOrder: true, Rotation: model.LeastRecentlyShown}, model.LeastRecentlyShown},
+		{model.Config{Rotation: model.WeightedRandom}, model.WeightedRandom},
+	}
+	for _, test := range tests {
+		if got := ModeOf(test.config); got != test.want {
+			t.Errorf("ModeOf(%v) = %s, want %s", test.config, got, test.want)
+		}
+	}
+}
+
+func TestIsValidMode(t *testing.T) {
+	for _, mode := range []model.RotationMode{model.Sequential, model.Shuffled, model.WeightedRandom, model.LeastRecentlyShown} {
+		if !IsValidMode(mode) {
+			t.Errorf("Expected %s to be valid", mode)
+		}
+	}
+	if IsValidMode("BOGUS") || IsValidMode("") {
+		t.Error("Expected unknown modes to be invalid")
+	}
+}
+
+func TestForConfigDelegatesToStorage(t *testing.T) {
+	storage := newFakeStorage(3)
+
+	next, err := ForConfig(model.Config{Rotation: model.Sequential}, SystemClock).Next(storage, 2)
+	if err != nil || next.Id != 3 {
+		t.Errorf("Expected sequential next image 3, got %d (%v)", next.Id, err)
+	}
+
+	_, err = ForConfig(model.Config{Rotation: model.Shuffled}, SystemClock).Next(storage, 2)
+	if err != nil || storage.shuffled != 1 {
+		t.Errorf("Expected shuffled strategy to draw from the deck, got %d draws (%v)", storage.shuffled, err)
+	}
+
+	next, err = ForConfig(model.Config{Rotation: "BOGUS"}, SystemClock).Next(storage, 3)
+	if err != nil || next.Id != 1 {
+		t.Errorf("Expected unknown mode to fall back to sequential, got %d (%v)", next.Id, err)
+	}
+}
+
+func TestWeightedRandom(t *testing.T) {
+	storage := newFakeStorage(3)
+	storage.images[0].Weight = 5
+	storage.images[2].Weight = 2
+
+	// Candidates are 1 (weight 5) and 3 (weight 2), the current image 2 is excluded
+	var total int
+	strategy := weightedRandom{intN: func(n int) int {
+		total = n
+		return 4
+	}}
+	next, err := strategy.Next(storage, 2)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if total != 7 {
+		t.Errorf("Expected total weight 7, got %d", total)
+	}
+	if next.Id != 1 {
+		t.Errorf("Expected image 1, got %d", next.Id)
+	}
+
+	strategy = weightedRandom{intN: func(n int) int { return 5 }}
+	next, _ = strategy.Next(storage, 2)
+	if next.Id != 3 {
+		t.Errorf("Expected image 3, got %d", next.Id)
+	}
+}
+
+func TestWeightedRandomSingleImage(t *testing.T) {
+	storage := newFakeStorage(1)
+	strategy := weightedRandom{intN: func(n int) int { return 0 }}
+
+	next, err := strategy.Next(storage, 1)
+	if err != nil || next.Id != 1 {
+		t.Errorf("Expected the only image to be repeated, got %d (%v)", next.Id, err)
+	}
+}
+
+func TestLeastRecentlyShown(t *testing.T) {
+	storage := newFakeStorage(4)
+	now := time.Now()
+	storage.lastShown[1] = now.Add(-time.Hour)
+	storage.lastShown[2] = now.Add(-2 * time.Hour)
+	storage.lastShown[3] = now
+	storage.lastShown[4] = now.Add(-3 * time.Hour)
+
+	next, err := leastRecentlyShown{}.Next(storage, 3)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if next.Id != 4 {
+		t.Errorf("Expected least recently shown image 4, got %d", next.Id)
+	}
+
+	// Images never shown take precedence
+	storage.images = append(storage.images, model.Image{Id: 5})
+	next, _ = leastRecentlyShown{}.Next(storage, 3)
+	if next.Id != 5 {
+		t.Errorf("Expected never shown image 5, got %d", next.Id)
+	}
+}
+
+func TestStrategiesWithoutImages(t *testing.T) {
+	storage := newFakeStorage(0)
+
+	if _, err := (weightedRandom{intN: func(n int) int { return 0 }}).Next(storage, -1); err == nil {
+		t.Error("Expected error for weighted random without images")
+	}
+	if _, err := (leastRecentlyShown{}).Next(storage, -1); err == nil {
+		t.Error("Expected error for least recently shown without images")
+	}
+}
@@ -0,0 +1,140 @@
+package similarity
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"os"
+	"strconv"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// hashSize is the number of compared pixels per row and the number of rows of the difference hash.
+const hashSize = 8
+
+// DHash computes the difference hash of the image. The image is reduced to 9x8 gray pixels and each bit
+// tells whether a pixel is brighter than its right neighbour. Similar images differ in few bits only.
+//
+// Parameters:
+//   - img: The image to hash.
+//
+// Returns:
+//   - uint64: The 64 bit difference hash.
+func DHash(img image.Image) uint64 {
+	small := image.NewGray(image.Rect(0, 0, hashSize+1, hashSize))
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+	var hash uint64
+	for y := 0; y < hashSize; y++ {
+		for x := 0; x < hashSize; x++ {
+			hash <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// HashFile computes the difference hash of an image file.
+//
+// Parameters:
+//   - path: The path of the image file.
+//
+// Returns:
+//   - string: The hex encoded difference hash.
+//   - error: An error if the file cannot be read or decoded.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%016x", DHash(img)), nil
+}
+
+// Distance returns the Hamming distance of two hex encoded hashes, the number of differing bits.
+//
+// Parameters:
+//   - first: The first hex encoded hash.
+//   - second: The second hex encoded hash.
+//
+// Returns:
+//   - int: The number of differing bits.
+//   - bool: False if one of the hashes is invalid.
+func Distance(first string, second string) (int, bool) {
+	a, err := strconv.ParseUint(first, 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	b, err := strconv.ParseUint(second, 16, 64)
+	if err != nil {
+		return 0, false
+	}
+	return bits.OnesCount64(a ^ b), true
+}
+
+// Groups clusters images whose perceptual hashes differ in at most the given number of bits.
+// Images are linked transitively, so a group may contain images farther apart than the distance.
+// Images without perceptual hash are never grouped.
+//
+// Parameters:
+//   - images: The images to cluster.
+//   - distance: The maximum Hamming distance of similar images.
+//
+// Returns:
+//   - [][]Image: The groups with at least two images, ordered by their first image. Images keep their relative order.
+func Groups(images []model.Image, distance int) [][]model.Image {
+	hashes := make([]uint64, len(images))
+	valid := make([]bool, len(images))
+	for i, img := range images {
+		hash, err := strconv.ParseUint(img.PerceptualHash, 16, 64)
+		hashes[i], valid[i] = hash, err == nil
+	}
+
+	parents := make([]int, len(images))
+	for i := range parents {
+		parents[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parents[i] != i {
+			parents[i] = root(parents[i])
+		}
+		return parents[i]
+	}
+	for i := range images {
+		for j := i + 1; j < len(images); j++ {
+			if valid[i] && valid[j] && bits.OnesCount64(hashes[i]^hashes[j]) <= distance {
+				first, second := root(i), root(j)
+				parents[max(first, second)] = min(first, second)
+			}
+		}
+	}
+
+	members := map[int][]model.Image{}
+	var roots []int
+	for i, img := range images {
+		r := root(i)
+		if _, found := members[r]; !found {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], img)
+	}
+	groups := [][]model.Image{}
+	for _, r := range roots {
+		if len(members[r]) > 1 {
+			groups = append(groups, members[r])
+		}
+	}
+	return groups
+}
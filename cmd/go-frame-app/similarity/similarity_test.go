@@ -0,0 +1,85 @@
+package similarity
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+func gradient(width int, height int, offset uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(200-x*200/width) + offset})
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	if hash := DHash(image.NewGray(image.Rect(0, 0, 32, 32))); hash != 0 {
+		t.Errorf("Expected 0 for a uniform image, got %016x", hash)
+	}
+	if hash := DHash(gradient(32, 32, 0)); hash != ^uint64(0) {
+		t.Errorf("Expected all bits for a falling gradient, got %016x", hash)
+	}
+	// Scaling and brightness changes keep the hash
+	if DHash(gradient(64, 48, 30)) != DHash(gradient(32, 32, 0)) {
+		t.Error("Expected the same hash for a scaled and brightened image")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		first    string
+		second   string
+		expected int
+		valid    bool
+	}{
+		{"0000000000000000", "0000000000000000", 0, true},
+		{"0000000000000000", "000000000000000f", 4, true},
+		{"ffffffffffffffff", "0000000000000000", 64, true},
+		{"", "0000000000000000", 0, false},
+		{"0000000000000000", "not a hash", 0, false},
+	}
+	for _, test := range tests {
+		distance, valid := Distance(test.first, test.second)
+		if distance != test.expected || valid != test.valid {
+			t.Errorf("%q %q: expected %d %v, got %d %v", test.first, test.second, test.expected, test.valid, distance, valid)
+		}
+	}
+}
+
+func TestGroups(t *testing.T) {
+	images := []model.Image{
+		{Id: 1, PerceptualHash: "ffffffffffffffff"},
+		{Id: 2, PerceptualHash: "0000000000000000"},
+		{Id: 3, PerceptualHash: "00000000000000ff"},
+		{Id: 4, PerceptualHash: "fffffffffffffff0"},
+		{Id: 5, PerceptualHash: "000000000000000f"},
+		{Id: 6},
+		{Id: 7},
+	}
+	groups := Groups(images, 4)
+	// Images 2 and 3 are linked through image 5, images without hash are never grouped
+	expected := [][]int{{1, 4}, {2, 3, 5}}
+	if len(groups) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, groups)
+	}
+	for i, group := range groups {
+		if len(group) != len(expected[i]) {
+			t.Fatalf("Expected %v, got %v", expected, groups)
+		}
+		for j, image := range group {
+			if image.Id != expected[i][j] {
+				t.Errorf("Expected %v, got %v", expected, groups)
+			}
+		}
+	}
+
+	if groups := Groups(images, 0); len(groups) != 0 {
+		t.Errorf("Expected no groups, got %v", groups)
+	}
+}
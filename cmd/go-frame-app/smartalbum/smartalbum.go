@@ -0,0 +1,121 @@
+package smartalbum
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/tagging"
+)
+
+// ErrInvalidRules is returned if the rules of a smart album contradict themselves or cannot be evaluated.
+var ErrInvalidRules = errors.New("Invalid album rules")
+
+// Rule decides whether images belong to a smart album.
+type Rule struct {
+	rules model.AlbumRules
+	tags  tagging.Expression
+	// camera is the lower case part of the camera make or model.
+	camera string
+}
+
+// Compile validates the rules of a smart album and prepares them for evaluation.
+// Time ranges must not end before they start, the tag expression must be valid,
+// the orientation must be known and the minimum rating must not exceed model.MaxRating.
+//
+// Parameters:
+//   - rules: The rules of the smart album.
+//
+// Returns:
+//   - Rule: The rule selecting the images of the album.
+//   - error: ErrInvalidRules if the rules are invalid.
+func Compile(rules model.AlbumRules) (Rule, error) {
+	rule := Rule{rules: rules, camera: strings.ToLower(strings.TrimSpace(rules.Camera))}
+	if !isValidRange(rules.TakenFrom, rules.TakenUntil) || !isValidRange(rules.UploadedFrom, rules.UploadedUntil) {
+		return rule, ErrInvalidRules
+	}
+	switch rules.Orientation {
+	case "", model.Landscape, model.Portrait, model.Square:
+	default:
+		return rule, ErrInvalidRules
+	}
+	if rules.MinRating < 0 || rules.MinRating > model.MaxRating {
+		return rule, ErrInvalidRules
+	}
+	if strings.TrimSpace(rules.Tags) != "" {
+		expression, err := tagging.Parse(rules.Tags)
+		if err != nil {
+			return rule, ErrInvalidRules
+		}
+		rule.tags = expression
+	}
+	return rule, nil
+}
+
+func isValidRange(from time.Time, until time.Time) bool {
+	return from.IsZero() || until.IsZero() || from.Before(until)
+}
+
+// Matches reports whether the image satisfies all rules.
+//
+// Parameters:
+//   - image: The image to check.
+//
+// Returns:
+//   - bool: True if the image belongs to the smart album.
+func (r Rule) Matches(image model.Image) bool {
+	rules := r.rules
+	if !isInRange(image.Metadata.TakenAt, rules.TakenFrom, rules.TakenUntil) ||
+		!isInRange(image.UploadedAt, rules.UploadedFrom, rules.UploadedUntil) {
+		return false
+	}
+	if r.tags != nil && !r.tags.Matches(image.Tags) {
+		return false
+	}
+	if rules.Orientation != "" && OrientationOf(image.Metadata) != rules.Orientation {
+		return false
+	}
+	if r.camera != "" {
+		camera := strings.ToLower(image.Metadata.CameraMake + " " + image.Metadata.CameraModel)
+		if !strings.Contains(camera, r.camera) {
+			return false
+		}
+	}
+	return image.Rating >= rules.MinRating
+}
+
+// isInRange reports whether the time lies within the range. Without range, any time matches, otherwise a zero time never does.
+func isInRange(t time.Time, from time.Time, until time.Time) bool {
+	if from.IsZero() && until.IsZero() {
+		return true
+	}
+	if t.IsZero() || (!from.IsZero() && t.Before(from)) {
+		return false
+	}
+	return until.IsZero() || t.Before(until)
+}
+
+// OrientationOf returns the orientation of the image as displayed. EXIF orientations 5 to 8 rotate the image by 90 degrees.
+//
+// Parameters:
+//   - metadata: The metadata of the image.
+//
+// Returns:
+//   - Orientation: The orientation, or an empty string if the dimensions are unknown.
+func OrientationOf(metadata model.Metadata) model.Orientation {
+	width, height := metadata.Width, metadata.Height
+	if metadata.Orientation >= 5 && metadata.Orientation <= 8 {
+		width, height = height, width
+	}
+	switch {
+	case width == 0 || height == 0:
+		return ""
+	case width > height:
+		return model.Landscape
+	case width < height:
+		return model.Portrait
+	default:
+		return model.Square
+	}
+}
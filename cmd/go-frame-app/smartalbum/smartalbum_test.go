@@ -0,0 +1,87 @@
+package smartalbum
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+func TestCompileInvalid(t *testing.T) {
+	now := time.Now()
+	for _, rules := range []model.AlbumRules{
+		{TakenFrom: now, TakenUntil: now.Add(-time.Hour)},
+		{UploadedFrom: now, UploadedUntil: now},
+		{Tags: "family AND"},
+		{Orientation: "DIAGONAL"},
+		{MinRating: model.MaxRating + 1},
+		{MinRating: -1},
+	} {
+		if _, err := Compile(rules); !errors.Is(err, ErrInvalidRules) {
+			t.Errorf("%+v: expected ErrInvalidRules, got %v", rules, err)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	summer := time.Date(2025, 7, 14, 12, 0, 0, 0, time.UTC)
+	image := model.Image{
+		Metadata:   model.Metadata{TakenAt: summer, CameraMake: "Canon", CameraModel: "EOS R6", Width: 3000, Height: 2000},
+		Tags:       []string{"beach", "family"},
+		Rating:     4,
+		UploadedAt: summer.AddDate(0, 1, 0),
+	}
+	tests := []struct {
+		rules    model.AlbumRules
+		expected bool
+	}{
+		{model.AlbumRules{}, true},
+		{model.AlbumRules{TakenFrom: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), TakenUntil: time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)}, true},
+		{model.AlbumRules{TakenUntil: summer}, false},
+		{model.AlbumRules{Tags: "family AND NOT screenshots"}, true},
+		{model.AlbumRules{Tags: "screenshots"}, false},
+		{model.AlbumRules{Orientation: model.Landscape}, true},
+		{model.AlbumRules{Orientation: model.Portrait}, false},
+		{model.AlbumRules{Camera: " eos "}, true},
+		{model.AlbumRules{Camera: "Nikon"}, false},
+		{model.AlbumRules{MinRating: 4}, true},
+		{model.AlbumRules{MinRating: 5}, false},
+		{model.AlbumRules{UploadedFrom: summer}, true},
+		{model.AlbumRules{UploadedFrom: summer, Camera: "Nikon"}, false},
+	}
+	for _, test := range tests {
+		rule, err := Compile(test.rules)
+		if err != nil {
+			t.Errorf("%+v: %v", test.rules, err)
+			continue
+		}
+		if matches := rule.Matches(image); matches != test.expected {
+			t.Errorf("%+v: expected %v, got %v", test.rules, test.expected, matches)
+		}
+	}
+
+	// Images without the checked information never match
+	rule, _ := Compile(model.AlbumRules{TakenFrom: summer.AddDate(-10, 0, 0)})
+	if rule.Matches(model.Image{}) {
+		t.Error("Expected an image without date taken not to match")
+	}
+}
+
+func TestOrientationOf(t *testing.T) {
+	tests := []struct {
+		metadata model.Metadata
+		expected model.Orientation
+	}{
+		{model.Metadata{Width: 4, Height: 3}, model.Landscape},
+		{model.Metadata{Width: 4, Height: 3, Orientation: 6}, model.Portrait},
+		{model.Metadata{Width: 3, Height: 4, Orientation: 3}, model.Portrait},
+		{model.Metadata{Width: 4, Height: 4}, model.Square},
+		{model.Metadata{}, ""},
+	}
+	for _, test := range tests {
+		if orientation := OrientationOf(test.metadata); orientation != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.metadata, test.expected, orientation)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package tagging
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrInvalidTag is returned for empty tags, tags with whitespace or parentheses and tags named like an operator.
+	ErrInvalidTag = errors.New("Invalid tag")
+	// ErrInvalidExpression is returned if a tag expression cannot be parsed.
+	ErrInvalidExpression = errors.New("Invalid tag expression")
+)
+
+// Normalize returns the canonical form of a tag, trimmed and in lower case, so tags match regardless of their case.
+//
+// Parameters:
+//   - tag: The tag as entered by the user.
+//
+// Returns:
+//   - string: The normalized tag.
+//   - error: ErrInvalidTag if the tag cannot be used in a tag expression.
+func Normalize(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || isOperator(tag) || strings.ContainsFunc(tag, isSeparator) {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+// NormalizeAll normalizes the tags and returns them sorted, without duplicates.
+//
+// Parameters:
+//   - tags: The tags as entered by the user.
+//
+// Returns:
+//   - []string: The normalized tags.
+//   - error: ErrInvalidTag if any of the tags cannot be used in a tag expression.
+func NormalizeAll(tags []string) ([]string, error) {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag, err := Normalize(tag)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized), nil
+}
+
+// Expression is a condition on the tags of an image.
+type Expression interface {
+	// Matches reports whether an image with the given normalized tags satisfies the expression.
+	Matches(tags []string) bool
+}
+
+type tag string
+
+func (t tag) Matches(tags []string) bool {
+	return slices.Contains(tags, string(t))
+}
+
+type not struct {
+	operand Expression
+}
+
+func (n not) Matches(tags []string) bool {
+	return !n.operand.Matches(tags)
+}
+
+type and struct {
+	left, right Expression
+}
+
+func (a and) Matches(tags []string) bool {
+	return a.left.Matches(tags) && a.right.Matches(tags)
+}
+
+type or struct {
+	left, right Expression
+}
+
+func (o or) Matches(tags []string) bool {
+	return o.left.Matches(tags) || o.right.Matches(tags)
+}
+
+// Parse reads a tag expression such as "family AND NOT screenshots". Tags are combined with the operators
+// NOT, AND and OR, in decreasing precedence, and grouped with parentheses. Operators and tags are case-insensitive.
+//
+// Parameters:
+//   - expression: The tag expression.
+//
+// Returns:
+//   - Expression: The parsed expression.
+//   - error: ErrInvalidExpression if the expression is empty or malformed.
+func Parse(expression string) (Expression, error) {
+	p := &parser{tokens: tokenize(expression)}
+	parsed, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.position < len(p.tokens) {
+		return nil, ErrInvalidExpression
+	}
+	return parsed, nil
+}
+
+// parser is a recursive descent parser over the tokens of a tag expression.
+type parser struct {
+	tokens   []string
+	position int
+}
+
+func (p *parser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+// accept consumes the next token if it is the given operator or parenthesis.
+func (p *parser) accept(token string) bool {
+	if strings.EqualFold(p.peek(), token) {
+		p.position++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("OR") {
+		var right Expression
+		right, err = p.parseAnd()
+		left = or{left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+	for err == nil && p.accept("AND") {
+		var right Expression
+		right, err = p.parseUnary()
+		left = and{left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	if p.accept("NOT") {
+		operand, err := p.parseUnary()
+		return not{operand: operand}, err
+	}
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err == nil && !p.accept(")") {
+			err = ErrInvalidExpression
+		}
+		return inner, err
+	}
+	normalized, err := Normalize(p.peek())
+	if err != nil {
+		return nil, ErrInvalidExpression
+	}
+	p.position++
+	return tag(normalized), nil
+}
+
+// tokenize splits the expression into parentheses and words.
+func tokenize(expression string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range expression {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func isOperator(word string) bool {
+	return strings.EqualFold(word, "AND") || strings.EqualFold(word, "OR") || strings.EqualFold(word, "NOT")
+}
+
+func isSeparator(r rune) bool {
+	return r == '(' || r == ')' || unicode.IsSpace(r)
+}
@@ -0,0 +1,61 @@
+package tagging
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNormalizeAll(t *testing.T) {
+	normalized, err := NormalizeAll([]string{" Family", "beach", "family", "BEACH"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(normalized, []string{"beach", "family"}) {
+		t.Errorf("Expected [beach family], got %v", normalized)
+	}
+	for _, invalid := range []string{"", "  ", "two words", "(family)", "and", "Not"} {
+		if _, err := Normalize(invalid); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("%q: expected ErrInvalidTag, got %v", invalid, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expression string
+		tags       []string
+		expected   bool
+	}{
+		{"family", []string{"family"}, true},
+		{"Family", []string{"family", "beach"}, true},
+		{"family", []string{"beach"}, false},
+		{"family AND NOT screenshots", []string{"family"}, true},
+		{"family AND NOT screenshots", []string{"family", "screenshots"}, false},
+		{"family and not screenshots", []string{"screenshots"}, false},
+		{"beach OR mountains AND winter", []string{"beach"}, true},
+		{"beach OR mountains AND winter", []string{"mountains"}, false},
+		{"(beach OR mountains) AND winter", []string{"beach"}, false},
+		{"(beach OR mountains) AND winter", []string{"mountains", "winter"}, true},
+		{"NOT NOT family", []string{"family"}, true},
+		{"NOT (family OR beach)", nil, true},
+	}
+	for _, test := range tests {
+		expression, err := Parse(test.expression)
+		if err != nil {
+			t.Errorf("%q: %v", test.expression, err)
+			continue
+		}
+		if matches := expression.Matches(test.tags); matches != test.expected {
+			t.Errorf("%q %v: expected %v, got %v", test.expression, test.tags, test.expected, matches)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expression := range []string{"", "family AND", "AND family", "NOT", "(family", "family)", "family beach", "()"} {
+		if _, err := Parse(expression); !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("%q: expected ErrInvalidExpression, got %v", expression, err)
+		}
+	}
+}
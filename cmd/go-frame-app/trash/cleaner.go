@@ -0,0 +1,70 @@
+package trash
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+var (
+	WarningLogger *log.Logger
+	InfoLogger    *log.Logger
+	ErrorLogger   *log.Logger
+)
+
+func init() {
+	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	WarningLogger = log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+}
+
+// cleanupInterval is the time between two runs of the retention cleanup.
+const cleanupInterval = time.Hour
+
+// Cleaner empties the trash of images deleted longer ago than the configured retention period.
+type Cleaner struct {
+	storage model.TrashStorage
+	now     func() time.Time
+}
+
+// NewCleaner creates a cleaner for the trash of the given storage.
+func NewCleaner(storage model.TrashStorage) *Cleaner {
+	return &Cleaner{storage: storage, now: time.Now}
+}
+
+// Run purges expired images periodically until the context is cancelled.
+//
+// Parameters:
+//   - ctx: The context stopping the cleanup.
+func (c *Cleaner) Run(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		c.Cleanup()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup purges all images deleted longer ago than the configured retention period.
+func (c *Cleaner) Cleanup() {
+	config, err := c.storage.GetConfiguration()
+	if err != nil {
+		ErrorLogger.Println("Cannot load configuration:", err)
+		return
+	}
+	purged, err := c.storage.PurgeTrash(c.now().Add(-config.Retention()))
+	if err != nil {
+		ErrorLogger.Println("Cannot empty trash:", err)
+		return
+	}
+	for _, image := range purged {
+		InfoLogger.Println("Purged", image.Path, "deleted at", image.TrashedAt.Format(time.RFC3339))
+	}
+}
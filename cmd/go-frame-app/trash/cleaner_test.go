@@ -0,0 +1,55 @@
+package trash
+
+import (
+	"testing"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// fakeTrash records the purges of the cleaner.
+type fakeTrash struct {
+	config model.Config
+	before []time.Time
+}
+
+func (f *fakeTrash) GetConfiguration() (model.Config, error) {
+	return f.config, nil
+}
+
+func (f *fakeTrash) LoadTrash() ([]model.Image, error) {
+	return nil, nil
+}
+
+func (f *fakeTrash) RestoreImage(id int) (model.Image, error) {
+	return model.Image{}, nil
+}
+
+func (f *fakeTrash) PurgeImage(id int) error {
+	return nil
+}
+
+func (f *fakeTrash) PurgeTrash(before time.Time) ([]model.Image, error) {
+	f.before = append(f.before, before)
+	return []model.Image{{Path: "photo.jpg", TrashedAt: before}}, nil
+}
+
+func TestCleanup(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		retention int
+		expected  time.Time
+	}{
+		{0, now.AddDate(0, 0, -model.DefaultTrashRetention)},
+		{7, now.AddDate(0, 0, -7)},
+	}
+	for _, test := range tests {
+		storage := &fakeTrash{config: model.Config{TrashRetention: test.retention}}
+		cleaner := NewCleaner(storage)
+		cleaner.now = func() time.Time { return now }
+		cleaner.Cleanup()
+		if len(storage.before) != 1 || !storage.before[0].Equal(test.expected) {
+			t.Errorf("Retention %d: expected purge before %v, got %v", test.retention, test.expected, storage.before)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package upload
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const infoSuffix = ".json"
+
+// info describes a partial upload. The offset is not stored, it is the size of the data file.
+type info struct {
+	Id string
+	// Length is the total size of the upload in bytes.
+	Length int64
+	// Metadata is the raw Upload-Metadata header of the creation request.
+	Metadata string
+	// Filename is the file name taken from the metadata.
+	Filename string
+	Expires  time.Time
+}
+
+// store keeps partial uploads on disk, next to a JSON file describing the upload.
+type store struct {
+	dir string
+}
+
+func (s *store) dataPath(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (s *store) infoPath(id string) string {
+	return s.dataPath(id) + infoSuffix
+}
+
+// create registers a new empty upload.
+func (s *store) create(upload info) (info, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return upload, err
+	}
+	upload.Id = newId()
+	if err := os.WriteFile(s.dataPath(upload.Id), nil, 0644); err != nil {
+		return upload, err
+	}
+	if err := s.save(upload); err != nil {
+		os.Remove(s.dataPath(upload.Id))
+		return upload, err
+	}
+	return upload, nil
+}
+
+// load returns the upload with the given ID and its current offset.
+func (s *store) load(id string) (info, int64, bool) {
+	var upload info
+	if !isValidId(id) {
+		return upload, 0, false
+	}
+	infoBytes, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		return upload, 0, false
+	}
+	if err := json.Unmarshal(infoBytes, &upload); err != nil {
+		return upload, 0, false
+	}
+	dataInfo, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		return upload, 0, false
+	}
+	return upload, dataInfo.Size(), true
+}
+
+func (s *store) save(upload info) error {
+	infoBytes, _ := json.Marshal(upload)
+	return os.WriteFile(s.infoPath(upload.Id), infoBytes, 0644)
+}
+
+// append writes the content to the end of the upload, but never more than the given limit.
+// Everything written before an error stays on disk, so the client can resume from there.
+func (s *store) append(id string, content io.Reader, limit int64) (int64, error) {
+	file, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(file, io.LimitReader(content, limit))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+func (s *store) open(id string) (*os.File, error) {
+	return os.Open(s.dataPath(id))
+}
+
+// remove deletes the upload with the given ID.
+func (s *store) remove(id string) {
+	os.Remove(s.infoPath(id))
+	os.Remove(s.dataPath(id))
+}
+
+// expired returns the IDs of all uploads that expired before the given time.
+func (s *store) expired(now time.Time) []string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, entry := range entries {
+		id, found := strings.CutSuffix(entry.Name(), infoSuffix)
+		if !found {
+			continue
+		}
+		upload, _, ok := s.load(id)
+		if !ok || upload.Expires.Before(now) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func newId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// isValidId reports whether the ID has the generated format, so it cannot point outside of the upload directory.
+func isValidId(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,349 @@
+package upload
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+)
+
+var (
+	WarningLogger *log.Logger
+	InfoLogger    *log.Logger
+	ErrorLogger   *log.Logger
+)
+
+func init() {
+	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	WarningLogger = log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+}
+
+const (
+	// UploadDir is the default directory where partial uploads are stored on disk.
+	UploadDir = "uploads"
+	// DefaultMaxAge is the default time an upload without progress is kept before it expires.
+	DefaultMaxAge = 24 * time.Hour
+	// cleanupInterval is the time between two runs of the expiry cleanup.
+	cleanupInterval = time.Hour
+)
+
+// Headers and values of the tus protocol.
+const (
+	tusVersion        = "1.0.0"
+	tusExtensions     = "creation,expiration,termination"
+	offsetContentType = "application/offset+octet-stream"
+	// imageIdHeader carries the ID of the imported image in the response completing an upload.
+	imageIdHeader = "Upload-Image-Id"
+)
+
+// Options configures the resumable uploads. Zero values use the defaults.
+type Options struct {
+	// Dir is the directory holding the partial uploads.
+	Dir string
+	// MaxSize is the maximum size of an upload in bytes, persistence.MaxImageSize by default.
+	MaxSize int64
+	// MaxAge is the time an upload without progress is kept before it expires.
+	MaxAge time.Duration
+}
+
+// Handler implements resumable uploads following the tus protocol 1.0.0 with the creation,
+// expiration and termination extensions. Completed uploads are imported as new images.
+type Handler struct {
+	storage  model.UploadStorage
+	notifier model.ChangeNotifier
+	store    *store
+	maxSize  int64
+	maxAge   time.Duration
+	now      func() time.Time
+	mu       sync.Mutex
+	busy     map[string]bool
+}
+
+// NewHandler creates a new handler for resumable uploads.
+//
+// Parameters:
+//   - storage: The storage importing the completed uploads.
+//   - notifier: The notifier informed about imported images.
+//   - options: The upload configuration.
+//
+// Returns:
+//   - *Handler: The upload handler.
+func NewHandler(storage model.UploadStorage, notifier model.ChangeNotifier, options Options) *Handler {
+	if options.Dir == "" {
+		options.Dir = UploadDir
+	}
+	if options.MaxSize <= 0 {
+		options.MaxSize = persistence.MaxImageSize
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = DefaultMaxAge
+	}
+	return &Handler{
+		storage:  storage,
+		notifier: notifier,
+		store:    &store{dir: options.Dir},
+		maxSize:  options.MaxSize,
+		maxAge:   options.MaxAge,
+		now:      time.Now,
+		busy:     map[string]bool{},
+	}
+}
+
+// RegisterApiEndpoint registers the upload endpoints on the provided router group.
+//
+// Parameters:
+//   - router: The Gin router group to attach the endpoints to.
+func (h *Handler) RegisterApiEndpoint(router *gin.RouterGroup) {
+	router.OPTIONS("", h.options)
+	router.POST("", h.requireVersion, h.createUpload)
+	router.HEAD("/:id", h.requireVersion, h.uploadOffset)
+	router.PATCH("/:id", h.requireVersion, h.appendUpload)
+	router.DELETE("/:id", h.requireVersion, h.terminateUpload)
+}
+
+// Run removes expired uploads periodically, until the context is done.
+//
+// Parameters:
+//   - ctx: The context that stops the cleanup when done.
+func (h *Handler) Run(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		h.Cleanup()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup removes all expired uploads.
+func (h *Handler) Cleanup() {
+	for _, id := range h.store.expired(h.now()) {
+		if !h.lock(id) {
+			continue
+		}
+		InfoLogger.Println("Removing expired upload", id)
+		h.store.remove(id)
+		h.unlock(id)
+	}
+}
+
+func (h *Handler) options(context *gin.Context) {
+	context.Header("Tus-Resumable", tusVersion)
+	context.Header("Tus-Version", tusVersion)
+	context.Header("Tus-Extension", tusExtensions)
+	context.Header("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	context.Status(http.StatusNoContent)
+}
+
+// requireVersion rejects requests of clients using another protocol version.
+func (h *Handler) requireVersion(context *gin.Context) {
+	context.Header("Tus-Resumable", tusVersion)
+	if context.GetHeader("Tus-Resumable") != tusVersion {
+		context.Header("Tus-Version", tusVersion)
+		context.AbortWithStatus(http.StatusPreconditionFailed)
+	}
+}
+
+func (h *Handler) createUpload(context *gin.Context) {
+	length, err := strconv.ParseInt(context.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if length > h.maxSize {
+		context.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		return
+	}
+	metadata, ok := parseMetadata(context.GetHeader("Upload-Metadata"))
+	if !ok {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+	upload, err := h.store.create(info{
+		Length:   length,
+		Metadata: context.GetHeader("Upload-Metadata"),
+		Filename: filename,
+		Expires:  h.now().Add(h.maxAge),
+	})
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	context.Header("Location", strings.TrimSuffix(context.Request.URL.Path, "/")+"/"+upload.Id)
+	context.Header("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+	context.Status(http.StatusCreated)
+}
+
+func (h *Handler) uploadOffset(context *gin.Context) {
+	upload, offset, found := h.load(context.Param("id"))
+	if !found {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	context.Header("Cache-Control", "no-store")
+	context.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	context.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	context.Header("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+	if upload.Metadata != "" {
+		context.Header("Upload-Metadata", upload.Metadata)
+	}
+	context.Status(http.StatusOK)
+}
+
+// appendUpload writes the request body at the current offset. The upload is imported once it is complete.
+func (h *Handler) appendUpload(context *gin.Context) {
+	if context.ContentType() != offsetContentType {
+		context.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+	requestOffset, err := strconv.ParseInt(context.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || requestOffset < 0 {
+		context.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	id := context.Param("id")
+	if !h.lock(id) {
+		context.AbortWithStatus(http.StatusLocked)
+		return
+	}
+	defer h.unlock(id)
+	upload, offset, found := h.load(id)
+	if !found {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	if requestOffset != offset {
+		context.AbortWithStatus(http.StatusConflict)
+		return
+	}
+
+	written, err := h.store.append(id, context.Request.Body, upload.Length-offset)
+	offset += written
+	upload.Expires = h.now().Add(h.maxAge)
+	if saveErr := h.store.save(upload); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		WarningLogger.Println("Upload", id, "interrupted at offset", offset, ":", err)
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	context.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	context.Header("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+	if offset == upload.Length {
+		h.complete(context, upload)
+		return
+	}
+	context.Status(http.StatusNoContent)
+}
+
+// complete imports the finished upload as a new image and removes it. If the import fails for a
+// temporary reason, the upload is kept, so the client can retry with an empty request at the final offset.
+func (h *Handler) complete(context *gin.Context, upload info) {
+	file, err := h.store.open(upload.Id)
+	if err != nil {
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	image, err := h.storage.ImportImage(upload.Filename, file)
+	file.Close()
+	switch {
+	case errors.Is(err, persistence.ErrImageTooLarge):
+		h.store.remove(upload.Id)
+		context.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, persistence.ErrFormatNotAllowed):
+		h.store.remove(upload.Id)
+		context.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, persistence.ErrDuplicateImage):
+		// The image is already part of the library
+	case err != nil:
+		context.AbortWithError(http.StatusInternalServerError, err)
+		return
+	default:
+		h.notifier.NotifyChange()
+	}
+	h.store.remove(upload.Id)
+	context.Header(imageIdHeader, strconv.Itoa(image.Id))
+	context.Status(http.StatusNoContent)
+}
+
+func (h *Handler) terminateUpload(context *gin.Context) {
+	id := context.Param("id")
+	if !h.lock(id) {
+		context.AbortWithStatus(http.StatusLocked)
+		return
+	}
+	defer h.unlock(id)
+	if _, _, found := h.load(id); !found {
+		context.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	h.store.remove(id)
+	context.Status(http.StatusNoContent)
+}
+
+// load returns the upload with the given ID, if it exists and is not expired.
+func (h *Handler) load(id string) (info, int64, bool) {
+	upload, offset, found := h.store.load(id)
+	if !found || upload.Expires.Before(h.now()) {
+		return upload, offset, false
+	}
+	return upload, offset, true
+}
+
+// lock marks the upload with the given ID as busy, so only one request at a time writes to it.
+func (h *Handler) lock(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.busy[id] {
+		return false
+	}
+	h.busy[id] = true
+	return true
+}
+
+func (h *Handler) unlock(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.busy, id)
+}
+
+// parseMetadata decodes the Upload-Metadata header, a comma separated list of keys with base64 encoded values.
+func parseMetadata(header string) (map[string]string, bool) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, true
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, false
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, false
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, true
+}
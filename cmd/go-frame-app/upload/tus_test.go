@@ -0,0 +1,254 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+)
+
+type countingNotifier struct {
+	changes int
+}
+
+func (n *countingNotifier) NotifyChange() {
+	n.changes++
+}
+
+func setupTestDB(t *testing.T) *persistence.Storage {
+	_ = os.MkdirAll("images", 0755)
+
+	dbPath := filepath.Join(t.TempDir(), "test_upload.db")
+	storage, err := persistence.NewStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open test DB: %v", err)
+	}
+	t.Cleanup(func() {
+		storage.Close()
+		os.RemoveAll("images")
+	})
+	return storage
+}
+
+func setupRouter(t *testing.T, options Options) (*gin.Engine, *Handler, *persistence.Storage, *countingNotifier) {
+	storage := setupTestDB(t)
+	notifier := &countingNotifier{}
+	if options.Dir == "" {
+		options.Dir = t.TempDir()
+	}
+	handler := NewHandler(storage, notifier, options)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler.RegisterApiEndpoint(r.Group("/admin/api/uploads"))
+	return r, handler, storage, notifier
+}
+
+func jpegContent(t *testing.T) []byte {
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 16, 16)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func request(r *gin.Engine, method string, target string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func create(t *testing.T, r *gin.Engine, length int, filename string) string {
+	t.Helper()
+	w := request(r, "POST", "/admin/api/uploads", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte(filename)) + ",filetype aW1hZ2UvanBlZw==",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", w.Code)
+	}
+	if w.Header().Get("Upload-Expires") == "" {
+		t.Error("Expected Upload-Expires header")
+	}
+	return w.Header().Get("Location")
+}
+
+func patch(r *gin.Engine, location string, offset int, body []byte) *httptest.ResponseRecorder {
+	return request(r, "PATCH", location, body, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	})
+}
+
+func TestOptions(t *testing.T) {
+	r, _, _, _ := setupRouter(t, Options{MaxSize: 1000})
+	req, _ := http.NewRequest("OPTIONS", "/admin/api/uploads", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	expected := map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Tus-Version":   "1.0.0",
+		"Tus-Extension": "creation,expiration,termination",
+		"Tus-Max-Size":  "1000",
+	}
+	for header, value := range expected {
+		if w.Header().Get(header) != value {
+			t.Errorf("Expected %s %s, got %s", header, value, w.Header().Get(header))
+		}
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	r, _, storage, notifier := setupRouter(t, Options{})
+	content := jpegContent(t)
+	location := create(t, r, len(content), "../holiday.jpg")
+
+	// The client sends the first chunk, asks for the offset and resumes
+	half := len(content) / 2
+	if w := patch(r, location, 0, content[:half]); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Fatalf("Expected 204 at offset %d, got %d at %s", half, w.Code, w.Header().Get("Upload-Offset"))
+	}
+	w := request(r, "HEAD", location, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(half) || w.Header().Get("Upload-Length") != strconv.Itoa(len(content)) {
+		t.Fatalf("Expected offset %d of %d, got %d: %v", half, len(content), w.Code, w.Header())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("Upload-Metadata") == "" {
+		t.Errorf("Expected no-store and metadata, got %v", w.Header())
+	}
+	if w := patch(r, location, 0, content); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for wrong offset, got %d", w.Code)
+	}
+	if notifier.changes != 0 {
+		t.Error("Expected no change before completion")
+	}
+
+	w = patch(r, location, half, content[half:])
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	id, _ := strconv.Atoi(w.Header().Get("Upload-Image-Id"))
+	img, err := storage.LoadImage(id)
+	if err != nil || img.Path != "holiday.jpg" || img.MimeType != "image/jpeg" {
+		t.Errorf("Expected imported holiday.jpg, got %+v (%v)", img, err)
+	}
+	if notifier.changes != 1 {
+		t.Errorf("Expected one change, got %d", notifier.changes)
+	}
+	// The completed upload is removed
+	if w := request(r, "HEAD", location, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after completion, got %d", w.Code)
+	}
+}
+
+func TestUploadValidation(t *testing.T) {
+	r, _, _, _ := setupRouter(t, Options{MaxSize: 100})
+
+	tests := []struct {
+		headers  map[string]string
+		expected int
+	}{
+		{map[string]string{}, http.StatusBadRequest},
+		{map[string]string{"Upload-Length": "-1"}, http.StatusBadRequest},
+		{map[string]string{"Upload-Length": "101"}, http.StatusRequestEntityTooLarge},
+		{map[string]string{"Upload-Length": "10", "Upload-Metadata": "filename not-base64!"}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if w := request(r, "POST", "/admin/api/uploads", nil, test.headers); w.Code != test.expected {
+			t.Errorf("%v: expected %d, got %d", test.headers, test.expected, w.Code)
+		}
+	}
+
+	// Other protocol versions are rejected
+	req, _ := http.NewRequest("POST", "/admin/api/uploads", nil)
+	req.Header.Set("Upload-Length", "10")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusPreconditionFailed || w.Header().Get("Tus-Version") != "1.0.0" {
+		t.Errorf("Expected 412, got %d", w.Code)
+	}
+
+	location := create(t, r, 10, "photo.jpg")
+	if w := request(r, "PATCH", location, []byte("data"), map[string]string{"Upload-Offset": "0"}); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 without offset content type, got %d", w.Code)
+	}
+	for _, target := range []string{"/admin/api/uploads/unknown", "/admin/api/uploads/00000000000000000000000000000000"} {
+		if w := request(r, "HEAD", target, nil, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", target, w.Code)
+		}
+	}
+}
+
+func TestRejectedUpload(t *testing.T) {
+	r, _, storage, notifier := setupRouter(t, Options{})
+	content := []byte("not an image")
+	location := create(t, r, len(content), "notes.jpg")
+
+	if w := patch(r, location, 0, content); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415, got %d", w.Code)
+	}
+	if w := request(r, "HEAD", location, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected rejected upload to be removed, got %d", w.Code)
+	}
+	if images, _ := storage.LoadImages(); len(images) != 0 || notifier.changes != 0 {
+		t.Errorf("Expected no images, got %d", len(images))
+	}
+}
+
+func TestTerminateUpload(t *testing.T) {
+	dir := t.TempDir()
+	r, _, _, _ := setupRouter(t, Options{Dir: dir})
+	location := create(t, r, 10, "photo.jpg")
+	patch(r, location, 0, []byte("12345"))
+
+	if w := request(r, "DELETE", location, nil, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", w.Code)
+	}
+	if w := request(r, "HEAD", location, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after termination, got %d", w.Code)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no files, got %d", len(entries))
+	}
+}
+
+func TestExpiredUpload(t *testing.T) {
+	dir := t.TempDir()
+	r, handler, _, _ := setupRouter(t, Options{Dir: dir, MaxAge: time.Hour})
+	now := time.Now()
+	handler.now = func() time.Time { return now }
+	stale := create(t, r, 10, "stale.jpg")
+	active := create(t, r, 10, "active.jpg")
+
+	// Progress extends the expiry
+	now = now.Add(50 * time.Minute)
+	patch(r, active, 0, []byte("12345"))
+	now = now.Add(20 * time.Minute)
+	if w := request(r, "HEAD", stale, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for expired upload, got %d", w.Code)
+	}
+	if w := request(r, "HEAD", active, nil, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected active upload, got %d", w.Code)
+	}
+
+	handler.Cleanup()
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Expected only the active upload to be kept, got %d files", len(entries))
+	}
+}
@@ -0,0 +1,158 @@
+package watcher
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/persistence"
+)
+
+var (
+	WarningLogger *log.Logger
+	InfoLogger    *log.Logger
+	ErrorLogger   *log.Logger
+)
+
+func init() {
+	InfoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	WarningLogger = log.New(os.Stdout, "WARN: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+	ErrorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.Lshortfile)
+}
+
+// DefaultDebounce is the default quiet period after the last change before the library is reconciled.
+const DefaultDebounce = 2 * time.Second
+
+// Options configures the watcher. Zero values use the defaults.
+type Options struct {
+	// Debounce is the quiet period after the last change in the image directory before the library is reconciled.
+	// Defaults to DefaultDebounce.
+	Debounce time.Duration
+}
+
+// Watcher keeps the library in line with files added to or removed from the image directory by hand,
+// e.g. through a network share.
+type Watcher struct {
+	storage  model.LibraryStorage
+	notifier model.ChangeNotifier
+	dir      string
+	debounce time.Duration
+}
+
+// stamp is the size and modification time of a file, used to tell whether it is still being written.
+type stamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewWatcher creates a watcher for persistence.ImageDir.
+// The notifier is informed whenever the library changed.
+func NewWatcher(storage model.LibraryStorage, notifier model.ChangeNotifier, options Options) *Watcher {
+	if options.Debounce <= 0 {
+		options.Debounce = DefaultDebounce
+	}
+	return &Watcher{storage: storage, notifier: notifier, dir: persistence.ImageDir, debounce: options.Debounce}
+}
+
+// Run watches the image directory until the context is cancelled. Bursts of changes are collected until the
+// directory has been quiet for the debounce period and all changed files have stopped growing. The library is
+// then reconciled once, importing new files through the same path as uploads and removing entries of deleted files.
+//
+// Parameters:
+//   - ctx: The context stopping the watcher.
+//
+// Returns:
+//   - error: An error if the image directory cannot be watched.
+func (w *Watcher) Run(ctx context.Context) error {
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return err
+	}
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsWatcher.Close()
+	if err := fsWatcher.Add(w.dir); err != nil {
+		return err
+	}
+	InfoLogger.Println("Watching", w.dir, "for changes")
+
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+	pending := map[string]stamp{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return nil
+			}
+			if isIgnored(event) {
+				continue
+			}
+			pending[filepath.Base(event.Name)] = stampOf(event.Name)
+			timer.Reset(w.debounce)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return nil
+			}
+			// Events may have been lost, e.g. on queue overflow, so the library is reconciled anyway
+			WarningLogger.Println("Watching", w.dir, "failed:", err)
+			timer.Reset(w.debounce)
+		case <-timer.C:
+			if !w.settled(pending) {
+				timer.Reset(w.debounce)
+				continue
+			}
+			pending = map[string]stamp{}
+			w.reconcile()
+		}
+	}
+}
+
+// settled reports whether none of the changed files was modified since it was last seen.
+// Files still being written are stamped again, so they are checked after the next quiet period.
+func (w *Watcher) settled(pending map[string]stamp) bool {
+	settled := true
+	for name, previous := range pending {
+		current := stampOf(filepath.Join(w.dir, name))
+		if current != previous {
+			pending[name] = current
+			settled = false
+		}
+	}
+	return settled
+}
+
+func (w *Watcher) reconcile() {
+	report, err := w.storage.Reconcile()
+	if err != nil {
+		ErrorLogger.Println("Cannot reconcile image library:", err)
+		return
+	}
+	if report.Changed() {
+		InfoLogger.Printf("Reconciled image library: %d imported, %d removed", len(report.Imported), len(report.Removed))
+		w.notifier.NotifyChange()
+	}
+}
+
+// isIgnored reports whether the event cannot change the library. Hidden files, like the temporary files of running
+// imports or metadata written by file sharing clients, and permission changes are ignored.
+func isIgnored(event fsnotify.Event) bool {
+	return strings.HasPrefix(filepath.Base(event.Name), ".") || event.Op == fsnotify.Chmod
+}
+
+// stampOf returns the stamp of the file, or the zero stamp if it does not exist.
+func stampOf(path string) stamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{size: info.Size(), modTime: info.ModTime()}
+}
@@ -0,0 +1,125 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.evodicka.dev/go-frame/cmd/go-frame-app/model"
+)
+
+// fakeLibrary records reconciliations and the names of the files present at that time.
+type fakeLibrary struct {
+	reconciled chan []string
+}
+
+func (l *fakeLibrary) Reconcile() (model.LibraryReport, error) {
+	entries, _ := os.ReadDir("images")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	l.reconciled <- names
+	return model.LibraryReport{Imported: []model.Image{{}}}, nil
+}
+
+type countingNotifier struct {
+	changes chan struct{}
+}
+
+func (n *countingNotifier) NotifyChange() {
+	n.changes <- struct{}{}
+}
+
+const debounce = 100 * time.Millisecond
+
+func startWatcher(t *testing.T) (*fakeLibrary, *countingNotifier) {
+	_ = os.MkdirAll("images", 0755)
+	library := &fakeLibrary{reconciled: make(chan []string, 10)}
+	notifier := &countingNotifier{changes: make(chan struct{}, 10)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- NewWatcher(library, notifier, Options{Debounce: debounce}).Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run failed: %v", err)
+		}
+		os.RemoveAll("images")
+	})
+	// Give the watcher time to register the directory
+	time.Sleep(debounce)
+	return library, notifier
+}
+
+func expectReconcile(t *testing.T, library *fakeLibrary) []string {
+	t.Helper()
+	select {
+	case names := <-library.reconciled:
+		return names
+	case <-time.After(20 * debounce):
+		t.Fatal("Expected the library to be reconciled")
+		return nil
+	}
+}
+
+func expectQuiet(t *testing.T, library *fakeLibrary) {
+	t.Helper()
+	select {
+	case <-library.reconciled:
+		t.Error("Expected no reconciliation")
+	case <-time.After(5 * debounce):
+	}
+}
+
+func TestWatcherDebouncesBursts(t *testing.T) {
+	library, notifier := startWatcher(t)
+	for _, name := range []string{"first.jpg", "second.jpg", "third.jpg"} {
+		os.WriteFile(filepath.Join("images", name), []byte("content"), 0644)
+	}
+
+	if names := expectReconcile(t, library); len(names) != 3 {
+		t.Errorf("Expected all files to be present, got %v", names)
+	}
+	expectQuiet(t, library)
+	if len(notifier.changes) != 1 {
+		t.Errorf("Expected 1 change notification, got %d", len(notifier.changes))
+	}
+
+	os.Remove(filepath.Join("images", "second.jpg"))
+	if names := expectReconcile(t, library); len(names) != 2 {
+		t.Errorf("Expected the file to be removed, got %v", names)
+	}
+}
+
+func TestWatcherWaitsForWrittenFiles(t *testing.T) {
+	library, _ := startWatcher(t)
+	file, err := os.Create(filepath.Join("images", "photo.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file keeps growing in intervals shorter than the debounce period
+	start := time.Now()
+	for i := 0; i < 8; i++ {
+		file.Write([]byte("chunk"))
+		time.Sleep(debounce / 2)
+	}
+	file.Close()
+
+	expectReconcile(t, library)
+	if elapsed := time.Since(start); elapsed < 4*debounce {
+		t.Errorf("Expected reconciliation after the file was written, got it after %v", elapsed)
+	}
+	expectQuiet(t, library)
+}
+
+func TestWatcherIgnoresHiddenFiles(t *testing.T) {
+	library, _ := startWatcher(t)
+	os.WriteFile(filepath.Join("images", ".import-123"), []byte("partial"), 0644)
+	os.WriteFile(filepath.Join("images", ".DS_Store"), []byte("metadata"), 0644)
+	expectQuiet(t, library)
+}
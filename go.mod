@@ -3,8 +3,10 @@ module go.evodicka.dev/go-frame
 go 1.25
 
 require (
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/gin-gonic/gin v1.11.0
 	go.etcd.io/bbolt v1.4.3
+	golang.org/x/image v0.25.0
 )
 
 require (